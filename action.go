@@ -4,35 +4,64 @@ import (
 	"strings"
 )
 
-// toggleComment toggles line comment.
-// It will comment lines when none of the lines are commented.
-// It will uncomment lines when at least one of the lines are commented.
-func toggleComment(comment string, t *Text, c *Cursor, sel *Selection) []*Action {
-	lns := make([]int, 0)
-	if sel.on {
-		lns = sel.Lines()
-	} else {
-		lns = append(lns, c.l)
+// indentLines returns an edit that inserts tab at the start of lines.
+func indentLines(lines []int, tab string) prefixEdit {
+	e := prefixEdit{}
+	for _, l := range lines {
+		e.prefixes = append(e.prefixes, linePrefix{l, 0, tab})
 	}
+	return e
+}
 
-	commentedLns := make([]int, 0)
-	for _, l := range lns {
-		if strings.HasPrefix(t.lines[l].data, comment+" ") {
-			commentedLns = append(commentedLns, l)
-			break
+// unindentLines returns an edit that removes an indent from lines.
+// An indent is a tab, or spaces up to the text's tab width.
+func unindentLines(t *Text, lines []int) prefixEdit {
+	e := prefixEdit{remove: true}
+	for _, l := range lines {
+		line := t.LineData(l)
+		n := 0
+		if strings.HasPrefix(line, "\t") {
+			n = 1
+		} else {
+			for n < t.tabWidth && n < len(line) && line[n] == ' ' {
+				n++
+			}
+		}
+		if n != 0 {
+			e.prefixes = append(e.prefixes, linePrefix{l, 0, line[:n]})
 		}
 	}
+	return e
+}
 
-	if len(commentedLns) > 0 {
-		for _, l := range commentedLns {
-			t.lines[l].data = strings.Replace(t.lines[l].data, comment+" ", "", 1)
+// toggleComment returns an edit that toggles line comment of lines.
+// It will uncomment lines when at least one of the lines are commented.
+// Otherwise it will comment the lines, except blank ones.
+func toggleComment(comment string, t *Text, lines []int) prefixEdit {
+	uncomment := prefixEdit{remove: true}
+	for _, l := range lines {
+		line := t.LineData(l)
+		b := t.Line(l).Boc()
+		if !strings.HasPrefix(line[b:], comment) {
+			continue
 		}
-	} else {
-		for _, l := range lns {
-			t.lines[l].data = comment + " " + t.lines[l].data
+		c := comment
+		if strings.HasPrefix(line[b+len(comment):], " ") {
+			c += " "
 		}
+		uncomment.prefixes = append(uncomment.prefixes, linePrefix{l, b, c})
 	}
-
-	// TODO: return actions instead modify it.
-	return nil
+	if len(uncomment.prefixes) != 0 {
+		return uncomment
+	}
+	e := prefixEdit{}
+	for _, l := range lines {
+		ln := t.Line(l)
+		b := ln.Boc()
+		if b == len(ln.data) {
+			continue
+		}
+		e.prefixes = append(e.prefixes, linePrefix{l, b, comment + " "})
+	}
+	return e
 }
@@ -10,7 +10,16 @@ import (
 type Area struct {
 	min  cell.Pt
 	size cell.Pt
-	Win  *Window
+	// gutter is width of the gutter at the left of the area.
+	// The window is placed at the right of the gutter.
+	gutter int
+	Win    *Window
+
+	// buf is a buffer the area shows. It is nil for the status area.
+	// Areas those show the same buffer have their own cursor and selection.
+	buf       *Buffer
+	cursor    *Cursor
+	selection *Selection
 }
 
 // NewArea creates a new Area.
@@ -26,13 +35,33 @@ func NewArea(min cell.Pt, size cell.Pt) *Area {
 func (a *Area) Set(min cell.Pt, size cell.Pt) {
 	a.min = min
 	a.size = size
-	a.Win.size = size
+	a.Win.size = a.textSize()
 }
 
 // Resize resizes it and it's window size.
 func (a *Area) Resize(size cell.Pt) {
 	a.size = size
-	a.Win.size = size
+	a.Win.size = a.textSize()
+}
+
+// SetGutter sets width of it's gutter, and resizes it's window to fit the rest.
+// The gutter is not shown when it leaves no room for the window.
+func (a *Area) SetGutter(w int) {
+	if w >= a.size.O {
+		w = 0
+	}
+	a.gutter = w
+	a.Win.size = a.textSize()
+}
+
+// textSize returns size of the area without the gutter.
+func (a *Area) textSize() cell.Pt {
+	return cell.Pt{a.size.L, a.size.O - a.gutter}
+}
+
+// TextMin returns where the text starts on screen, that is right of the gutter.
+func (a *Area) TextMin() cell.Pt {
+	return cell.Pt{a.min.L, a.min.O + a.gutter}
 }
 
 func (a *Area) Draw(tx Text, sel *Selection, matches []syntax.Match) {}
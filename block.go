@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/kybin/tor/cell"
+)
+
+// blockB returns byte offset of line at visual column col, for block selection and insertion.
+// When col is inside of a wide rune or a tab, it returns the offset after the rune.
+// When the line is shorter than col, it returns the end of the line,
+// and number of spaces those are needed to reach col.
+func blockB(line string, col, tabWidth int) (int, int) {
+	o := 0
+	for b, r := range line {
+		if o >= col {
+			return b, 0
+		}
+		o += vlen(string(r), tabWidth)
+	}
+	if o >= col {
+		return len(line), 0
+	}
+	return len(line), col - o
+}
+
+// deleteBlock deletes the block selection, and returns the deleted parts of the lines joined with newlines.
+// Cursors are placed at the left of the block on every line, so typing inserts to all of them.
+func (m *NormalMode) deleteBlock() string {
+	data := m.selection.Data()
+	lines := m.selection.Lines()
+	froms := make([]int, len(lines))
+	// from the bottom, deleting a part doesn't change the other lines.
+	for i := len(lines) - 1; i >= 0; i-- {
+		from, to := m.selection.LineBlock(lines[i])
+		m.text.Remove(lines[i], from, to)
+		froms[i] = from
+	}
+	m.selection.on = false
+	m.extras = nil
+	m.cursor.SetBytePos(cell.Pt{lines[0], froms[0]})
+	for i := 1; i < len(lines); i++ {
+		c := *m.cursor
+		c.SetBytePos(cell.Pt{lines[i], froms[i]})
+		m.extras = append(m.extras, cursorSel{&c, NewSelection(m.text)})
+	}
+	return data
+}
+
+// insertBlock inserts lines of s as a block, at the cursor's column of the cursor line and the lines below.
+// Lines shorter than the column are padded with spaces, and lines are added at the end of the text if needed.
+// The cursor stays at the top left of the block.
+func (m *NormalMode) insertBlock(s string) {
+	m.extras = nil
+	start := m.cursor.BytePos()
+	col := m.cursor.O()
+	for i, part := range strings.Split(s, "\n") {
+		l := start.L + i
+		if l == m.text.NumLines() {
+			m.text.Insert("\n", l-1, m.text.lineLen(l-1))
+		}
+		if part == "" {
+			continue
+		}
+		b, pad := blockB(m.text.LineData(l), col, m.text.tabWidth)
+		m.text.Insert(strings.Repeat(" ", pad)+part, l, b)
+	}
+	m.cursor.SetBytePos(start)
+}
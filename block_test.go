@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kybin/tor/cell"
+)
+
+func TestBlockB(t *testing.T) {
+	cases := []struct {
+		line string
+		col  int
+		b    int
+		pad  int
+	}{
+		{"abc", 0, 0, 0},
+		{"abc", 2, 2, 0},
+		{"abc", 3, 3, 0},
+		{"abc", 5, 3, 2},
+		// a tab is 4 columns.
+		{"\tabc", 2, 1, 0},
+		{"\tabc", 5, 2, 0},
+		// a wide rune is 2 columns.
+		{"가나다", 3, 6, 0},
+		{"가나다", 4, 6, 0},
+	}
+	for _, c := range cases {
+		b, pad := blockB(c.line, c.col, 4)
+		if b != c.b || pad != c.pad {
+			t.Fatalf("blockB(%q, %v): got %v, %v, want %v, %v", c.line, c.col, b, pad, c.b, c.pad)
+		}
+	}
+}
+
+func TestBlockSelection(t *testing.T) {
+	useTempConfigDir(t)
+	in := []string{"name  string", "\tid  int", "x", "가나다라 bool"}
+	m := newTestNormalMode(in)
+	m.cursor.SetBytePos(cell.Pt{0, 4})
+	m.do(&Action{kind: "selection", value: "block"})
+	for i := 0; i < 3; i++ {
+		m.doAll(&Action{kind: "move", value: "down"})
+	}
+	m.doAll(&Action{kind: "move", value: "right"})
+	m.doAll(&Action{kind: "move", value: "right"})
+	// columns 4 to 8, the cursor's column on the last line.
+	if got, want := m.selection.Data(), "  st\nid  \n\n다라"; got != want {
+		t.Fatalf("Data: got %q, want %q", got, want)
+	}
+	if m.selection.Contains(cell.Pt{3, 3}) || !m.selection.Contains(cell.Pt{3, 6}) {
+		t.Fatalf("Contains: wrong for the line of wide runes")
+	}
+
+	m.doAll(&Action{kind: "copy"})
+	if !m.copied().Block {
+		t.Fatalf("copy: copied is not a block")
+	}
+	// typing deletes the block, and inserts at every line of it.
+	typeRunes(m, "|")
+	if len(m.extras) != 3 {
+		t.Fatalf("typing: got %v extra cursors, want 3", len(m.extras))
+	}
+	want := "name|ring\n\t|int\nx|\n가나| bool"
+	if got := strings.Join(textLines(m.text), "\n"); got != want {
+		t.Fatalf("typing: got %q, want %q", got, want)
+	}
+	m.do(&Action{kind: "undo"})
+	if got := textLines(m.text); strings.Join(got, "\n") != strings.Join(in, "\n") {
+		t.Fatalf("undo: got %q, want %q", got, in)
+	}
+
+	// paste the block at the end of the text, with padding and new lines.
+	m.cursor.SetBytePos(cell.Pt{3, len(in[3])})
+	for _, a := range commands["paste"](m) {
+		m.doAll(a)
+	}
+	want = "name  string\n\tid  int\nx\n가나다라 bool  st\n             id  \n\n             다라"
+	if got := strings.Join(textLines(m.text), "\n"); got != want {
+		t.Fatalf("paste: got %q, want %q", got, want)
+	}
+}
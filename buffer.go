@@ -0,0 +1,224 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/kybin/tor/cell"
+	"github.com/kybin/tor/syntax"
+)
+
+// Buffer is a file opened in tor.
+// Every buffer has it's own text, cursor, selection, history and parser,
+// so switching between buffers doesn't lose any of them.
+type Buffer struct {
+	f         string
+	text      *Text
+	cursor    *Cursor
+	selection *Selection
+	history   *History
+	parser    *syntax.Parser
+	comment   string // line comment prefix of the file's language.
+	lang      string // name of the file's language.
+
+	// message indicates the buffer shows messages from tor, instead of a file.
+	// It is not saved, and it's state is not remembered.
+	message bool
+
+	// modified marks lines those are changed after the buffer is opened or saved.
+	modified []bool
+
+	// winMin remembers where the window was,
+	// when the buffer is hidden by another buffer.
+	winMin cell.Pt
+}
+
+// NewBuffer creates a new Buffer for file f that has text.
+func NewBuffer(f string, text *Text) *Buffer {
+	lang := syntax.DetectLanguage(f, text.LineData(0))
+	b := &Buffer{
+		f:         f,
+		text:      text,
+		cursor:    NewCursor(text),
+		selection: NewSelection(text),
+		history:   NewHistory(),
+		parser:    syntax.NewParser(text, lang),
+		comment:   lang.Comment,
+		lang:      lang.Name,
+		modified:  make([]bool, text.NumLines()),
+	}
+	text.onChange = b.changed
+	return b
+}
+
+// changed is called when lines [l, l+removed) of the text are replaced with inserted lines.
+func (b *Buffer) changed(l, removed, inserted int) {
+	b.parser.Changed(l, removed, inserted)
+	if l > len(b.modified) {
+		l = len(b.modified)
+	}
+	if l+removed > len(b.modified) {
+		removed = len(b.modified) - l
+	}
+	if inserted == removed {
+		for i := l; i < l+inserted; i++ {
+			b.modified[i] = true
+		}
+		tor.shiftAreas(b, l, removed, inserted)
+		return
+	}
+	marks := make([]bool, inserted)
+	for i := range marks {
+		marks[i] = true
+	}
+	b.modified = append(b.modified[:l], append(marks, b.modified[l+removed:]...)...)
+	tor.shiftAreas(b, l, removed, inserted)
+}
+
+// clearModified clears modified marks of lines, as the text is saved.
+func (b *Buffer) clearModified() {
+	b.modified = make([]bool, b.text.NumLines())
+}
+
+// saveState saves the cursor position and history of the buffer to config directory,
+// so they are restored when the file is opened again.
+func (b *Buffer) saveState() {
+	if b.message {
+		return
+	}
+	saveLastPosition(b.f, b.cursor.l, b.cursor.b)
+	// history of an unsaved buffer doesn't match with the file.
+	if !b.text.edited {
+		saveHistory(b.f, b.text, b.history)
+	}
+}
+
+// openBuffer opens a buffer from a file arg, that looks like "filepath:linenum:offset".
+// When linenum is not given, the cursor will placed at the last position of the file.
+func openBuffer(farg string, allowCreate bool) (*Buffer, error) {
+	f, l, b := parseFileArg(farg)
+	if l == -1 {
+		l, b = loadLastPosition(f)
+	}
+	text, err := readOrCreate(f, allowCreate)
+	if err != nil {
+		return nil, err
+	}
+	buf := NewBuffer(f, text)
+	buf.history = loadHistory(f, text)
+	buf.cursor.GotoLine(l)
+	buf.cursor.SetCloseToB(b)
+	return buf, nil
+}
+
+// Name returns a short name of the buffer, to show it to user.
+func (b *Buffer) Name() string {
+	name := b.f
+	if b.text.edited {
+		name += "*"
+	}
+	return name
+}
+
+// samePath checks whether b is opened from f.
+func (b *Buffer) samePath(f string) bool {
+	p1, err := filepath.Abs(b.f)
+	if err != nil {
+		return false
+	}
+	p2, err := filepath.Abs(f)
+	if err != nil {
+		return false
+	}
+	return p1 == p2
+}
+
+// AddBuffer adds a buffer to tor.
+// If a buffer for the same file is already opened,
+// it will return the opened one instead.
+func (t *Tor) AddBuffer(b *Buffer) *Buffer {
+	for _, ob := range t.buffers {
+		if ob.samePath(b.f) {
+			return ob
+		}
+	}
+	t.buffers = append(t.buffers, b)
+	return b
+}
+
+// SwitchBuffer makes b as a current buffer of normal mode.
+// The focused area shows b, from where b was shown last time.
+func (t *Tor) SwitchBuffer(b *Buffer) {
+	a := t.normal.area
+	if a.buf == b {
+		return
+	}
+	if a.buf != nil {
+		a.buf.winMin = a.Win.min
+	}
+	t.showBuffer(a, b)
+	t.Focus(a)
+}
+
+// CloseBuffer closes b.
+// Areas those show b will show the next buffer.
+// It will return false if b is the last buffer, as tor needs at least one buffer.
+func (t *Tor) CloseBuffer(b *Buffer) bool {
+	if len(t.buffers) == 1 {
+		return false
+	}
+	idx := t.bufferIndex(b)
+	if idx == -1 {
+		return false
+	}
+	b.saveState()
+	t.buffers = append(t.buffers[:idx], t.buffers[idx+1:]...)
+	if idx == len(t.buffers) {
+		idx--
+	}
+	for _, a := range t.Areas() {
+		if a.buf == b {
+			t.showBuffer(a, t.buffers[idx])
+		}
+	}
+	t.Focus(t.normal.area)
+	return true
+}
+
+// bufferIndex returns index of b in tor's buffers.
+// It returns -1 if b is not found.
+func (t *Tor) bufferIndex(b *Buffer) int {
+	for i, ob := range t.buffers {
+		if ob == b {
+			return i
+		}
+	}
+	return -1
+}
+
+// modifiedBuffers returns buffers that have unsaved changes.
+func (t *Tor) modifiedBuffers() []*Buffer {
+	bufs := make([]*Buffer, 0)
+	for _, b := range t.buffers {
+		if b.text.edited {
+			bufs = append(bufs, b)
+		}
+	}
+	return bufs
+}
+
+// filterBuffers returns buffers those names contain s.
+// If modifiedOnly is true, it will only return modified buffers.
+func filterBuffers(bufs []*Buffer, s string, modifiedOnly bool) []*Buffer {
+	filtered := make([]*Buffer, 0)
+	for _, b := range bufs {
+		if modifiedOnly && !b.text.edited {
+			continue
+		}
+		if !strings.Contains(b.f, s) {
+			continue
+		}
+		filtered = append(filtered, b)
+	}
+	return filtered
+}
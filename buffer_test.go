@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFilterBuffers(t *testing.T) {
+	bufs := []*Buffer{
+		{f: "main.go", text: &Text{edited: true}},
+		{f: "main_test.go", text: &Text{}},
+		{f: "config.toml", text: &Text{edited: true}},
+	}
+	cases := []struct {
+		filter       string
+		modifiedOnly bool
+		want         []string
+	}{
+		{
+			filter:       "",
+			modifiedOnly: false,
+			want:         []string{"main.go", "main_test.go", "config.toml"},
+		},
+		{
+			filter:       "main",
+			modifiedOnly: false,
+			want:         []string{"main.go", "main_test.go"},
+		},
+		{
+			filter:       "",
+			modifiedOnly: true,
+			want:         []string{"main.go", "config.toml"},
+		},
+		{
+			filter:       "test",
+			modifiedOnly: true,
+			want:         []string{},
+		},
+	}
+	for _, c := range cases {
+		got := filterBuffers(bufs, c.filter, c.modifiedOnly)
+		if len(got) != len(c.want) {
+			t.Fatalf("filterBuffers(%q, %v): got %d buffers, want %d", c.filter, c.modifiedOnly, len(got), len(c.want))
+		}
+		for i := range got {
+			if got[i].f != c.want[i] {
+				t.Fatalf("filterBuffers(%q, %v): got %v at %d, want %v", c.filter, c.modifiedOnly, got[i].f, i, c.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// BufferMode is a mode for switching, closing and listing buffers.
+//
+// It shows opened buffers in status line. Typing filters the buffers by their names,
+// and Tab toggles whether it shows only modified buffers.
+type BufferMode struct {
+	filter       string
+	modifiedOnly bool
+	idx          int // index of the chosen buffer in filtered buffers.
+
+	// closing is a modified buffer that user tried to close.
+	// It will closed when user tries to close it again.
+	closing *Buffer
+
+	err string
+}
+
+func (m *BufferMode) Start() {
+	m.filter = ""
+	m.modifiedOnly = false
+	m.closing = nil
+	m.err = ""
+	m.idx = tor.bufferIndex(tor.normal.Buffer)
+}
+
+func (m *BufferMode) End() {}
+
+// buffers returns buffers that are currently listed.
+func (m *BufferMode) buffers() []*Buffer {
+	return filterBuffers(tor.buffers, m.filter, m.modifiedOnly)
+}
+
+// chosen returns a buffer that is currently chosen.
+// It will return nil if there is no listed buffer.
+func (m *BufferMode) chosen() *Buffer {
+	bufs := m.buffers()
+	if len(bufs) == 0 {
+		return nil
+	}
+	if m.idx >= len(bufs) {
+		m.idx = len(bufs) - 1
+	}
+	if m.idx < 0 {
+		m.idx = 0
+	}
+	return bufs[m.idx]
+}
+
+func (m *BufferMode) Handle(ev *tcell.EventKey) {
+	m.err = ""
+	switch ev.Key() {
+	case tcell.KeyEsc, tcell.KeyCtrlK:
+		tor.ChangeMode(tor.normal)
+	case tcell.KeyEnter:
+		b := m.chosen()
+		if b == nil {
+			m.err = "no buffer to switch"
+			return
+		}
+		tor.SwitchBuffer(b)
+		tor.ChangeMode(tor.normal)
+	case tcell.KeyUp, tcell.KeyLeft:
+		m.idx--
+		if m.idx < 0 {
+			m.idx = len(m.buffers()) - 1
+		}
+	case tcell.KeyDown, tcell.KeyRight:
+		m.idx++
+		if m.idx >= len(m.buffers()) {
+			m.idx = 0
+		}
+	case tcell.KeyTab:
+		m.modifiedOnly = !m.modifiedOnly
+		m.idx = 0
+	case tcell.KeyDelete, tcell.KeyCtrlW:
+		b := m.chosen()
+		if b == nil {
+			return
+		}
+		if b.text.edited && m.closing != b {
+			m.closing = b
+			m.err = fmt.Sprintf("%v modified. close again to discard changes.", b.f)
+			return
+		}
+		m.closing = nil
+		if !tor.CloseBuffer(b) {
+			m.err = "could not close the last buffer"
+		}
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if m.filter == "" {
+			return
+		}
+		_, rlen := utf8.DecodeLastRuneInString(m.filter)
+		m.filter = m.filter[:len(m.filter)-rlen]
+		m.idx = 0
+	default:
+		if ev.Modifiers()&tcell.ModAlt != 0 {
+			return
+		}
+		if ev.Rune() != 0 {
+			m.filter += string(ev.Rune())
+			m.idx = 0
+		}
+	}
+}
+
+func (m *BufferMode) Status() string {
+	bufs := m.buffers()
+	names := make([]string, 0, len(bufs))
+	for i, b := range bufs {
+		name := b.Name()
+		if i == m.idx {
+			name = "[" + name + "]"
+		}
+		names = append(names, name)
+	}
+	label := "buffer"
+	if m.modifiedOnly {
+		label = "modified buffer"
+	}
+	// filter placed at the end, where the cursor is.
+	return fmt.Sprintf("%v : %v | %v", label, strings.Join(names, " "), m.filter)
+}
+
+func (m *BufferMode) Error() string {
+	return m.err
+}
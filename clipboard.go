@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// clipboardConfig is the config file that selects the clipboard backend.
+// It has one of clipboardNames, and "auto" is used when it is not saved.
+const clipboardConfig = "clipboard"
+
+// clipboardNames are names of clipboard backends those could be selected in clipboardConfig.
+// "file" uses only the "copy" file in config directory, that is also the fallback of the others.
+var clipboardNames = []string{"auto", "osc52", "wl-clipboard", "xclip", "xsel", "file"}
+
+// clipboard is the system clipboard that copies are shared with other programs.
+type clipboard interface {
+	Copy(s string) error
+	Paste() (string, error)
+}
+
+// cmdClipboard is a clipboard that uses external helpers.
+// copy takes the string from stdin, and paste prints it to stdout.
+type cmdClipboard struct {
+	copy  []string
+	paste []string
+}
+
+func (c cmdClipboard) Copy(s string) error {
+	cmd := exec.Command(c.copy[0], c.copy[1:]...)
+	cmd.Stdin = strings.NewReader(s)
+	// helpers like xclip keep running in background to serve the clipboard.
+	// Waiting for their output will wait for them to exit, so it is not captured.
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%v: %v", c.copy[0], err)
+	}
+	return nil
+}
+
+func (c cmdClipboard) Paste() (string, error) {
+	cmd := exec.Command(c.paste[0], c.paste[1:]...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if line := strings.SplitN(strings.TrimSpace(stderr.String()), "\n", 2)[0]; line != "" {
+			return "", fmt.Errorf("%v: %v", c.paste[0], line)
+		}
+		return "", fmt.Errorf("%v: %v", c.paste[0], err)
+	}
+	return string(out), nil
+}
+
+// helperClipboards are clipboards of external helpers, in the order of discovery.
+// env is an environment variable that should be set to use the helper.
+var helperClipboards = []struct {
+	name string
+	env  string
+	cmdClipboard
+}{
+	{"wl-clipboard", "WAYLAND_DISPLAY", cmdClipboard{[]string{"wl-copy"}, []string{"wl-paste", "--no-newline"}}},
+	{"xclip", "DISPLAY", cmdClipboard{[]string{"xclip", "-selection", "clipboard", "-in"}, []string{"xclip", "-selection", "clipboard", "-out"}}},
+	{"xsel", "DISPLAY", cmdClipboard{[]string{"xsel", "--clipboard", "--input"}, []string{"xsel", "--clipboard", "--output"}}},
+}
+
+// osc52Clipboard is a clipboard of the terminal, that is set by an OSC 52 escape sequence.
+// It works in remote sessions, as the terminal is on the user's desktop.
+// Terminals don't let programs read their clipboard, so Paste always fails.
+type osc52Clipboard struct {
+	// tty is the terminal. When it is nil, /dev/tty is opened for each copy.
+	// tcell screen doesn't pass escape sequences through,
+	// so they are written to the terminal device that the screen draws on.
+	tty io.Writer
+}
+
+func (c osc52Clipboard) Copy(s string) error {
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(s)) + "\a"
+	if os.Getenv("TMUX") != "" {
+		// tmux passes a sequence to the outer terminal, when it is wrapped and the escapes are doubled.
+		seq = "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+	}
+	w := c.tty
+	if w == nil {
+		f, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	_, err := io.WriteString(w, seq)
+	return err
+}
+
+func (c osc52Clipboard) Paste() (string, error) {
+	return "", fmt.Errorf("osc52: cannot paste from the terminal's clipboard")
+}
+
+// loadClipboard loads the clipboard backend selected in clipboardConfig.
+// It returns nil when only the "copy" file is used.
+func loadClipboard() (clipboard, error) {
+	name := strings.TrimSpace(loadConfig(clipboardConfig))
+	if name == "" {
+		name = "auto"
+	}
+	return newClipboard(name)
+}
+
+// newClipboard returns the clipboard backend of the name.
+// "auto" discovers the first helper those exists, or OSC 52 in a remote session.
+// It returns nil when only the "copy" file is used.
+func newClipboard(name string) (clipboard, error) {
+	switch name {
+	case "file":
+		return nil, nil
+	case "osc52":
+		return osc52Clipboard{}, nil
+	case "auto":
+		for _, h := range helperClipboards {
+			if os.Getenv(h.env) == "" {
+				continue
+			}
+			if _, err := exec.LookPath(h.copy[0]); err == nil {
+				return h.cmdClipboard, nil
+			}
+		}
+		if os.Getenv("SSH_TTY") != "" || os.Getenv("SSH_CONNECTION") != "" {
+			return osc52Clipboard{}, nil
+		}
+		return nil, nil
+	}
+	for _, h := range helperClipboards {
+		if name == h.name {
+			if _, err := exec.LookPath(h.copy[0]); err != nil {
+				return nil, fmt.Errorf("clipboard: %v not found", h.copy[0])
+			}
+			return h.cmdClipboard, nil
+		}
+	}
+	return nil, fmt.Errorf("clipboard: unknown backend %q, should be one of %v", name, strings.Join(clipboardNames, ", "))
+}
+
+// copyToClipboard copies s to the system clipboard, if there is.
+func (m *NormalMode) copyToClipboard(s string) {
+	if m.clipboard == nil {
+		return
+	}
+	if err := m.clipboard.Copy(s); err != nil {
+		m.err = fmt.Sprintf("could not copy to clipboard: %v", err)
+	}
+}
+
+// syncClipboard adds the system clipboard's string to the kill ring, when it is copied by another program.
+// When the clipboard couldn't be read, the kill ring is used as is.
+func (m *NormalMode) syncClipboard() {
+	if m.clipboard == nil {
+		return
+	}
+	s, err := m.clipboard.Paste()
+	if err != nil || s == "" || s == m.copied().S {
+		return
+	}
+	m.pushRing(clip{S: s})
+}
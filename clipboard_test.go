@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/kybin/tor/cell"
+)
+
+// setEnv sets an environment variable during the test.
+func setEnv(t *testing.T, key, value string) {
+	orig, ok := os.LookupEnv(key)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, orig)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+	os.Setenv(key, value)
+}
+
+func TestOSC52Clipboard(t *testing.T) {
+	setEnv(t, "TMUX", "")
+	var buf bytes.Buffer
+	c := osc52Clipboard{tty: &buf}
+	if err := c.Copy("hi"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "\x1b]52;c;aGk=\a"; got != want {
+		t.Fatalf("Copy: got %q, want %q", got, want)
+	}
+	buf.Reset()
+	setEnv(t, "TMUX", "/tmp/tmux-0/default,1,0")
+	c.Copy("hi")
+	if got, want := buf.String(), "\x1bPtmux;\x1b\x1b]52;c;aGk=\a\x1b\\"; got != want {
+		t.Fatalf("Copy in tmux: got %q, want %q", got, want)
+	}
+}
+
+func TestHelperClipboard(t *testing.T) {
+	useTempConfigDir(t)
+	// a fake xclip keeps the clipboard in a file next to it.
+	dir := t.TempDir()
+	script := "#!/bin/sh\nclip=\"$(dirname \"$0\")/clip\"\ncase \"$*\" in\n*-in) cat > \"$clip\" ;;\n*-out) cat \"$clip\" ;;\nesac\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "xclip"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	setEnv(t, "PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	setEnv(t, "WAYLAND_DISPLAY", "")
+	setEnv(t, "DISPLAY", ":0")
+
+	if _, err := exec.LookPath("xsel"); err != nil {
+		if _, err := newClipboard("xsel"); err == nil {
+			t.Fatalf("newClipboard: want an error for xsel that is not found")
+		}
+	}
+	if _, err := newClipboard("clipboard"); err == nil {
+		t.Fatalf("newClipboard: want an error for an unknown backend")
+	}
+	cb, err := newClipboard("auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cb.(cmdClipboard); !ok {
+		t.Fatalf("newClipboard: got %T, want xclip", cb)
+	}
+
+	m := newTestNormalMode([]string{"one two", ""})
+	m.clipboard = cb
+	selectRange(m, cell.Pt{0, 0}, cell.Pt{0, 3})
+	m.handleActions(commands["copy"](m))
+	if got, _ := cb.Paste(); got != "one" {
+		t.Fatalf("copy: got %q in the clipboard, want %q", got, "one")
+	}
+
+	// another program copied.
+	if err := cb.Copy("three"); err != nil {
+		t.Fatal(err)
+	}
+	m.cursor.SetBytePos(cell.Pt{1, 0})
+	m.handleActions(commands["paste"](m))
+	if got := m.text.LineData(1); got != "three" {
+		t.Fatalf("paste: got %q, want %q", got, "three")
+	}
+	if got := loadKillRing(); len(got) != 2 || got[1].S != "one" {
+		t.Fatalf("paste: got kill ring %v, want [three one]", got)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"os/exec"
 )
 
@@ -29,7 +30,7 @@ type cmdGroup struct {
 // If an error occurred, it will not run the rest of commands.
 func (r cmdGroup) CombinedOutput() ([]byte, error) {
 	for _, c := range r.cmds {
-		if c.Path == "" {
+		if !found(c) {
 			// Didn't find the command.
 			if r.kind == orCmdGroup {
 				continue
@@ -47,3 +48,35 @@ func (r cmdGroup) CombinedOutput() ([]byte, error) {
 	}
 	return nil, nil
 }
+
+// Filter runs registered commands as filters, those read in from stdin and write to stdout.
+// In andCmdGroup, output of a command is the input of the next command.
+// It returns the last output, or stderr of the command as the output if an error occurred.
+// When no command ran, like all commands are missing in orCmdGroup, it returns in as is.
+func (r cmdGroup) Filter(in []byte) ([]byte, error) {
+	out := in
+	for _, c := range r.cmds {
+		if !found(c) && r.kind == orCmdGroup {
+			continue
+		}
+		var stdout, stderr bytes.Buffer
+		c.Stdin = bytes.NewReader(out)
+		c.Stdout = &stdout
+		c.Stderr = &stderr
+		if err := c.Run(); err != nil {
+			return stderr.Bytes(), err
+		}
+		out = stdout.Bytes()
+		if r.kind == orCmdGroup {
+			break
+		}
+	}
+	return out, nil
+}
+
+// found checks the command's executable exists.
+// exec.Command leaves the name as the path when it didn't find the executable.
+func found(c *exec.Cmd) bool {
+	_, err := exec.LookPath(c.Path)
+	return err == nil
+}
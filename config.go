@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -9,6 +11,9 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/kybin/tor/syntax"
 )
 
 // configDir is where config files will saved.
@@ -123,3 +128,250 @@ func loadConfig(fname string) string {
 	}
 	return string(b)
 }
+
+// langDir is the directory for language files, in config directory.
+const langDir = "syntax"
+
+// loadLanguages loads language files in langDir.
+func loadLanguages() []error {
+	return syntax.LoadLanguages(path.Join(configDir, langDir))
+}
+
+// maxSavedHistory is how many action groups of a history are saved at most.
+const maxSavedHistory = 1000
+
+// historyVersion is the version of history file format.
+// History files with a different version are discarded.
+const historyVersion = 2
+
+// savedString is a string at byte offset B of line L.
+type savedString struct {
+	L int    `json:"l"`
+	B int    `json:"b"`
+	S string `json:"s"`
+}
+
+// savedEdit is an edit saved in a history file.
+// Kind is one of "insert", "delete", "prefix" and "unprefix".
+// Insert and delete edits have only one string.
+type savedEdit struct {
+	Kind string        `json:"kind"`
+	Strs []savedString `json:"strs"`
+}
+
+// savedAction is an Action saved in a history file.
+// Cursors are saved as {line, byte offset, visual offset}.
+type savedAction struct {
+	Kind   string      `json:"kind"`
+	Value  string      `json:"value"`
+	Before [3]int      `json:"before"`
+	After  [3]int      `json:"after"`
+	Edits  []savedEdit `json:"edits"`
+}
+
+// savedNode is a historyNode saved in a history file.
+type savedNode struct {
+	Parent  int           `json:"parent"` // seq of the parent.
+	Time    time.Time     `json:"time"`
+	Actions []savedAction `json:"actions"`
+}
+
+// savedHistory is a History saved in a history file.
+// Hash is the hash of the text when the history is saved.
+// Nodes are saved in creation order except the root, so seq of a node is it's index + 1.
+type savedHistory struct {
+	Version int         `json:"version"`
+	Path    string      `json:"path"`
+	Hash    string      `json:"hash"`
+	Head    int         `json:"head"`
+	Nodes   []savedNode `json:"nodes"`
+}
+
+// textHash returns sha256 hash of text's data as hex string.
+func textHash(text *Text) string {
+	return fmt.Sprintf("%x", sha256.Sum256(text.Bytes()))
+}
+
+// historyFile returns the history file path for abspath.
+func historyFile(abspath string) string {
+	return path.Join(configDir, "history", fmt.Sprintf("%x.json", sha256.Sum256([]byte(abspath))))
+}
+
+// encodeEdit converts e to savedEdit.
+func encodeEdit(e edit) savedEdit {
+	switch e := e.(type) {
+	case insertEdit:
+		return savedEdit{Kind: "insert", Strs: []savedString{{e.l, e.b, e.s}}}
+	case deleteEdit:
+		return savedEdit{Kind: "delete", Strs: []savedString{{e.l, e.b, e.s}}}
+	case prefixEdit:
+		se := savedEdit{Kind: "prefix"}
+		if e.remove {
+			se.Kind = "unprefix"
+		}
+		for _, p := range e.prefixes {
+			se.Strs = append(se.Strs, savedString{p.l, p.b, p.s})
+		}
+		return se
+	}
+	panic(fmt.Sprintf("unknown edit type: %T", e))
+}
+
+// decodeEdit converts se to an edit.
+// It returns nil if se is not a valid edit.
+func decodeEdit(se savedEdit) edit {
+	switch se.Kind {
+	case "insert", "delete":
+		if len(se.Strs) != 1 {
+			return nil
+		}
+		s := se.Strs[0]
+		if se.Kind == "insert" {
+			return insertEdit{s.L, s.B, s.S}
+		}
+		return deleteEdit{s.L, s.B, s.S}
+	case "prefix", "unprefix":
+		e := prefixEdit{remove: se.Kind == "unprefix"}
+		for _, s := range se.Strs {
+			e.prefixes = append(e.prefixes, linePrefix{s.L, s.B, s.S})
+		}
+		return e
+	}
+	return nil
+}
+
+// encodeHistory converts h to savedHistory.
+// When h has more than maxSavedHistory groups, only the last groups to the head are kept.
+func encodeHistory(h *History) savedHistory {
+	nodes := h.nodes[1:]
+	if len(nodes) > maxSavedHistory {
+		nodes = make([]*historyNode, maxSavedHistory)
+		i := len(nodes)
+		for n := h.head; n.parent != nil && i > 0; n = n.parent {
+			i--
+			nodes[i] = n
+		}
+		nodes = nodes[i:]
+	}
+	seqs := make(map[*historyNode]int)
+	for i, n := range nodes {
+		seqs[n] = i + 1
+	}
+	// seqs of the root, or nodes those are not kept, will be 0.
+	// It means the oldest kept node's parent becomes the root.
+	sh := savedHistory{Version: historyVersion, Head: seqs[h.head], Nodes: make([]savedNode, 0, len(nodes))}
+	for _, n := range nodes {
+		sn := savedNode{Parent: seqs[n.parent], Time: n.time}
+		for _, a := range n.actions {
+			sa := savedAction{
+				Kind:   a.kind,
+				Value:  a.value,
+				Before: [3]int{a.beforeCursor.l, a.beforeCursor.b, a.beforeCursor.o},
+				After:  [3]int{a.afterCursor.l, a.afterCursor.b, a.afterCursor.o},
+			}
+			for _, e := range a.edits {
+				sa.Edits = append(sa.Edits, encodeEdit(e))
+			}
+			sn.Actions = append(sn.Actions, sa)
+		}
+		sh.Nodes = append(sh.Nodes, sn)
+	}
+	return sh
+}
+
+// decodeHistory converts sh to History of text.
+// It returns nil if sh is not a valid history.
+func decodeHistory(sh savedHistory, text *Text) *History {
+	if sh.Version != historyVersion {
+		return nil
+	}
+	h := NewHistory()
+	for i, sn := range sh.Nodes {
+		if sn.Parent < 0 || sn.Parent > i {
+			return nil
+		}
+		actions := make([]*Action, 0, len(sn.Actions))
+		for _, sa := range sn.Actions {
+			a := &Action{
+				kind:         sa.Kind,
+				value:        sa.Value,
+				beforeCursor: Cursor{l: sa.Before[0], b: sa.Before[1], o: sa.Before[2], text: text},
+				afterCursor:  Cursor{l: sa.After[0], b: sa.After[1], o: sa.After[2], text: text},
+			}
+			for _, se := range sa.Edits {
+				e := decodeEdit(se)
+				if e == nil {
+					return nil
+				}
+				a.edits = append(a.edits, e)
+			}
+			actions = append(actions, a)
+		}
+		h.head = h.nodes[sn.Parent]
+		h.Add(actions)
+		h.head.time = sn.Time
+	}
+	if sh.Head < 0 || sh.Head >= len(h.nodes) {
+		return nil
+	}
+	h.head = h.nodes[sh.Head]
+	// redo from the head should go to the way it was.
+	for n := h.head; n.parent != nil; n = n.parent {
+		n.parent.last = n
+	}
+	return h
+}
+
+// saveHistory saves history of the file to it's history file in config directory.
+// The text should be same as the file's content, so the history is valid when the file is opened again.
+func saveHistory(pth string, text *Text, h *History) error {
+	abspath, err := filepath.Abs(pth)
+	if err != nil {
+		return err
+	}
+	f := historyFile(abspath)
+	if h.Len() == 0 {
+		// nothing to undo, clear the old one.
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	sh := encodeHistory(h)
+	sh.Path = abspath
+	sh.Hash = textHash(text)
+	data, err := json.Marshal(sh)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(f), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(f, data, 0644)
+}
+
+// loadHistory loads history of the file from it's history file in config directory.
+// When the file is changed after the history is saved, the history is stale.
+// Then it removes the history file, and returns an empty history.
+func loadHistory(pth string, text *Text) *History {
+	abspath, err := filepath.Abs(pth)
+	if err != nil {
+		return NewHistory()
+	}
+	f := historyFile(abspath)
+	data, err := ioutil.ReadFile(f)
+	if err != nil {
+		return NewHistory()
+	}
+	var sh savedHistory
+	if err := json.Unmarshal(data, &sh); err != nil || sh.Path != abspath || sh.Hash != textHash(text) {
+		os.Remove(f)
+		return NewHistory()
+	}
+	h := decodeHistory(sh, text)
+	if h == nil {
+		os.Remove(f)
+		return NewHistory()
+	}
+	return h
+}
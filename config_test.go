@@ -1,10 +1,23 @@
 package main
 
 import (
+	"strings"
 	"testing"
+
+	"github.com/kybin/tor/cell"
 )
 
+// useTempConfigDir makes config files saved in a temporary directory during the test.
+func useTempConfigDir(t *testing.T) {
+	orig := configDir
+	t.Cleanup(func() {
+		configDir = orig
+	})
+	configDir = t.TempDir()
+}
+
 func TestSaveAndLoadLastPosition(t *testing.T) {
+	useTempConfigDir(t)
 	err := saveLastPosition("/home/kybin/not-exist.file", 10, 3)
 	if err != nil {
 		t.Error(err)
@@ -16,6 +29,7 @@ func TestSaveAndLoadLastPosition(t *testing.T) {
 }
 
 func TestSaveAndLoadConfig(t *testing.T) {
+	useTempConfigDir(t)
 	err := saveConfig("deleteme", "yay")
 	if err != nil {
 		t.Error(err)
@@ -25,3 +39,38 @@ func TestSaveAndLoadConfig(t *testing.T) {
 		t.Error("Could not load copy string.")
 	}
 }
+
+func TestSaveAndLoadHistory(t *testing.T) {
+	useTempConfigDir(t)
+	f := "/home/kybin/not-exist-history.file"
+	in := []string{"func main() {", "}"}
+	m := &NormalMode{Buffer: NewBuffer(f, NewText(in))}
+	m.cursor.SetBytePos(cell.Pt{0, len(in[0])})
+	for _, s := range []string{"\n", "\tprintln(1)"} {
+		a := &Action{kind: "insert", value: s}
+		m.do(a)
+		m.remember([]*Action{a})
+	}
+	if err := saveHistory(f, m.text, m.history); err != nil {
+		t.Fatal(err)
+	}
+
+	// open the file again.
+	text := NewText(textLines(m.text))
+	m = &NormalMode{Buffer: NewBuffer(f, text)}
+	m.history = loadHistory(f, text)
+	if m.history.Len() == 0 {
+		t.Fatalf("loadHistory: got empty history")
+	}
+	for m.history.head.parent != nil {
+		m.do(&Action{kind: "undo"})
+	}
+	if got := textLines(m.text); strings.Join(got, "\n") != strings.Join(in, "\n") {
+		t.Fatalf("undo: got %q, want %q", got, in)
+	}
+
+	// the file is changed outside.
+	if h := loadHistory(f, NewText([]string{"changed"})); h.Len() != 0 {
+		t.Fatalf("loadHistory: stale history is not discarded")
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"regexp"
 	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf8"
 
@@ -17,6 +19,14 @@ type Cursor struct {
 	b int // byte offset in line
 	o int // visual offset in line
 
+	// wrapWidth is width of rows that lines are wrapped at, or 0 if lines are not wrapped.
+	// When lines are wrapped, the cursor moves up and down by rows.
+	wrapWidth int
+	// rowCol is a column in a row that the cursor tries to keep while moving up and down by rows.
+	// It is valid only when the cursor is at rowColAt.
+	rowCol   int
+	rowColAt cell.Pt
+
 	text *Text
 }
 
@@ -131,12 +141,12 @@ func (c *Cursor) Position() cell.Pt {
 	return cell.Pt{c.l, c.O()}
 }
 
-func (c *Cursor) Line() *Line {
-	return &(c.text.lines[c.l])
+func (c *Cursor) Line() Line {
+	return c.text.Line(c.l)
 }
 
 func (c *Cursor) LineData() string {
-	return c.text.lines[c.l].data
+	return c.text.LineData(c.l)
 }
 
 func (c *Cursor) RuneAfter() (rune, int) {
@@ -160,7 +170,7 @@ func (c *Cursor) OnFirstLine() bool {
 }
 
 func (c *Cursor) OnLastLine() bool {
-	return c.l == len(c.text.lines)-1
+	return c.l == c.text.NumLines()-1
 }
 
 func (c *Cursor) AtBow() bool {
@@ -237,6 +247,10 @@ func (c *Cursor) MoveRight() {
 }
 
 func (c *Cursor) MoveUp() {
+	if c.wrapWidth > 0 {
+		c.moveRow(-1)
+		return
+	}
 	if c.OnFirstLine() {
 		return
 	}
@@ -245,6 +259,10 @@ func (c *Cursor) MoveUp() {
 }
 
 func (c *Cursor) MoveDown() {
+	if c.wrapWidth > 0 {
+		c.moveRow(1)
+		return
+	}
 	if c.OnLastLine() {
 		return
 	}
@@ -356,7 +374,7 @@ func (c *Cursor) MoveEol() {
 
 func (c *Cursor) PageUp() {
 	for i := 0; i < pageoffset; i++ {
-		if c.OnFirstLine() {
+		if c.OnFirstLine() && c.wrapWidth == 0 {
 			break
 		}
 		c.MoveUp()
@@ -365,7 +383,7 @@ func (c *Cursor) PageUp() {
 
 func (c *Cursor) PageDown() {
 	for i := 0; i < pageoffset; i++ {
-		if c.OnLastLine() {
+		if c.OnLastLine() && c.wrapWidth == 0 {
 			break
 		}
 		c.MoveDown()
@@ -379,26 +397,25 @@ func (c *Cursor) MoveBof() {
 }
 
 func (c *Cursor) MoveEof() {
-	c.l = len(c.text.lines) - 1
+	c.l = c.text.NumLines() - 1
 	c.b = len(c.LineData())
 	c.o = vlen(c.LineData(), c.text.tabWidth)
 }
 
 func (c *Cursor) SplitLine() {
 	c.text.SplitLine(c.l, c.b)
-	c.MoveDown()
-	c.SetB(0)
+	c.SetBytePos(cell.Pt{c.l + 1, 0})
 }
 
 func (c *Cursor) Insert(str string) {
-	for _, r := range str {
-		if r == '\n' {
-			c.SplitLine()
-			continue
-		}
-		c.text.Insert(string(r), c.l, c.b)
-		c.MoveRight()
+	c.text.Insert(str, c.l, c.b)
+	n := strings.Count(str, "\n")
+	if n == 0 {
+		c.SetB(c.b + len(str))
+		return
 	}
+	c.l += n
+	c.SetB(len(str) - strings.LastIndex(str, "\n") - 1)
 }
 
 func (c *Cursor) Delete() string {
@@ -423,131 +440,197 @@ func (c *Cursor) Backspace() string {
 
 func (c *Cursor) DeleteSelection(sel *Selection) string {
 	min, max := sel.MinMax()
-	bmin := cell.Pt{min.L, BFromO(c.text.lines[min.L].data, min.O, c.text.tabWidth)}
-	bmax := cell.Pt{max.L, BFromO(c.text.lines[max.L].data, max.O, c.text.tabWidth)}
+	bmin := cell.Pt{min.L, BFromO(c.text.LineData(min.L), min.O, c.text.tabWidth)}
+	bmax := cell.Pt{max.L, BFromO(c.text.LineData(max.L), max.O, c.text.tabWidth)}
 	deleted := c.text.RemoveRange(bmin, bmax)
 	c.l = min.L
 	c.SetB(bmin.O)
 	return deleted
 }
 
-func (c *Cursor) GotoNext(find string) bool {
-	if find == "" {
-		return true
+// contextRe caches a regexp made by contextRegexp, for the last regexp.
+var contextRe struct {
+	sync.Mutex
+	re, ctx *regexp.Regexp
+}
+
+// contextRegexp returns a regexp that matches a rune, followed by a match of re.
+// It lets re match at an offset of a line, while it's assertions like ^ and \b see the rune before the offset.
+// It returns nil if it could not make the regexp.
+func contextRegexp(re *regexp.Regexp) *regexp.Regexp {
+	contextRe.Lock()
+	defer contextRe.Unlock()
+	if contextRe.re != re {
+		contextRe.re = re
+		contextRe.ctx, _ = regexp.Compile(`\A(?s:.)(?:` + re.String() + `)`)
 	}
-	for l := c.l; l < len(c.text.lines); l++ {
-		linedata := string(c.text.lines[l].data)
-		offset := 0
-		if l == c.l {
-			if c.b == len(linedata) {
-				continue
+	return contextRe.ctx
+}
+
+// findFrom returns the leftmost match of re in line, which starts at or after byte offset b.
+// Unlike finding in line[b:], the match could overlap with a match before b,
+// and assertions like ^ and \b at b see the text before b.
+// The match is a submatch index pair slice, as regexp.FindStringSubmatchIndex.
+func findFrom(re *regexp.Regexp, line string, b int) []int {
+	for b < len(line) && !utf8.RuneStart(line[b]) {
+		b++
+	}
+	for b <= len(line) {
+		if b == 0 {
+			return re.FindStringSubmatchIndex(line)
+		}
+		ctx := contextRegexp(re)
+		if ctx != nil {
+			_, size := utf8.DecodeLastRuneInString(line[:b])
+			if m := ctx.FindStringSubmatchIndex(line[b-size:]); m != nil {
+				m[0] = size
+				return shiftMatch(m, b-size)
 			}
-			linedata = linedata[c.b+1:]
-			offset = c.b + 1
 		}
-		b := strings.Index(linedata, find)
-		if b != -1 {
-			c.l = l
-			c.SetB(b + offset)
-			return true
+		m := re.FindStringSubmatchIndex(line[b:])
+		if m == nil {
+			return nil
+		}
+		if m[0] != 0 || ctx == nil {
+			// assertions after b see the text from b, so the match is same as in line.
+			return shiftMatch(m, b)
+		}
+		// it only matches without the text before b.
+		_, size := utf8.DecodeRuneInString(line[b:])
+		if size == 0 {
+			return nil
 		}
+		b += size
 	}
-	return false
+	return nil
 }
 
-func (c *Cursor) GotoPrev(find string) bool {
-	if find == "" {
-		return true
+// shiftMatch adds b to offsets of submatch index pairs m, those are not -1.
+func shiftMatch(m []int, b int) []int {
+	for i := range m {
+		if m[i] >= 0 {
+			m[i] += b
+		}
 	}
-	for l := c.l; l >= 0; l-- {
-		linedata := string(c.text.lines[l].data)
-		if l == c.l {
-			linedata = linedata[:c.b]
+	return m
+}
+
+// eachMatch calls f with matches of re in line those start at or after byte offset b, from the left.
+// Matches could overlap, so there is a match at every offset that re matches from.
+// Empty matches are ignored. It stops when f returns false.
+func eachMatch(re *regexp.Regexp, line string, b int, f func(m []int) bool) {
+	for b <= len(line) {
+		m := findFrom(re, line, b)
+		if m == nil {
+			return
 		}
-		b := strings.LastIndex(linedata, find)
-		if b != -1 {
-			c.l = l
-			c.SetB(b)
-			return true
+		if m[1] > m[0] && !f(m) {
+			return
+		}
+		_, size := utf8.DecodeRuneInString(line[m[0]:])
+		if size == 0 {
+			return
 		}
+		b = m[0] + size
 	}
-	return false
 }
 
-func (c *Cursor) GotoNextWord(find string) bool {
-	oldc := *c
-	for l := c.l; l < len(c.text.lines); l++ {
-		linedata := string(c.text.lines[l].data)
-		offset := 0
+// matchAfter returns the first match of re in line, which starts at or after byte offset b.
+// The match is a submatch index pair slice, as regexp.FindStringSubmatchIndex.
+// It ignores empty matches. If there is no match, it will return nil.
+func matchAfter(re *regexp.Regexp, line string, b int) []int {
+	var match []int
+	eachMatch(re, line, b, func(m []int) bool {
+		match = m
+		return false
+	})
+	return match
+}
+
+// matchBefore returns the last match of re in line, which starts before byte offset b.
+// The match is a submatch index pair slice, as regexp.FindStringSubmatchIndex.
+// It ignores empty matches. If there is no match, it will return nil.
+func matchBefore(re *regexp.Regexp, line string, b int) []int {
+	var last []int
+	eachMatch(re, line, 0, func(m []int) bool {
+		if m[0] >= b {
+			return false
+		}
+		last = m
+		return true
+	})
+	return last
+}
+
+// GotoNext moves the cursor to the next match of re.
+// It returns byte length of the match, and whether it found the match.
+func (c *Cursor) GotoNext(re *regexp.Regexp) (int, bool) {
+	for l := c.l; l < c.text.NumLines(); l++ {
+		from := 0
 		if l == c.l {
-			if c.b == len(linedata) {
-				continue
-			}
-			linedata = linedata[c.b+1:]
-			offset = c.b + 1
+			from = c.b + 1
 		}
-		b := strings.Index(linedata, find)
-		if b != -1 {
+		m := matchAfter(re, c.text.LineData(l), from)
+		if m != nil {
 			c.l = l
-			c.SetB(b + offset)
-			if c.Word() == find {
-				return true
-			}
+			c.SetB(m[0])
+			return m[1] - m[0], true
 		}
 	}
-	c.Copy(oldc)
-	return false
+	return 0, false
 }
 
-func (c *Cursor) GotoPrevWord(find string) bool {
-	oldc := *c
+// GotoPrev moves the cursor to the previous match of re.
+// It returns byte length of the match, and whether it found the match.
+func (c *Cursor) GotoPrev(re *regexp.Regexp) (int, bool) {
 	for l := c.l; l >= 0; l-- {
-		linedata := string(c.text.lines[l].data)
+		linedata := c.text.LineData(l)
+		to := len(linedata) + 1
 		if l == c.l {
-			linedata = linedata[:c.b]
+			to = c.b
 		}
-		b := strings.LastIndex(linedata, find)
-		if b != -1 {
+		m := matchBefore(re, linedata, to)
+		if m != nil {
 			c.l = l
-			c.SetB(b)
-			if c.Word() == find {
-				return true
-			}
+			c.SetB(m[0])
+			return m[1] - m[0], true
 		}
 	}
-	c.Copy(oldc)
-	return false
+	return 0, false
 }
 
-func (c *Cursor) GotoFirst(find string) bool {
-	for l := 0; l < len(c.text.lines); l++ {
-		linedata := string(c.text.lines[l].data)
-		b := strings.Index(linedata, find)
-		if b != -1 {
+// GotoFirst moves the cursor to the first match of re in the text.
+// It returns byte length of the match, and whether it found the match.
+func (c *Cursor) GotoFirst(re *regexp.Regexp) (int, bool) {
+	for l := 0; l < c.text.NumLines(); l++ {
+		m := matchAfter(re, c.text.LineData(l), 0)
+		if m != nil {
 			c.l = l
-			c.SetB(b)
-			return true
+			c.SetB(m[0])
+			return m[1] - m[0], true
 		}
 	}
-	return false
+	return 0, false
 }
 
-func (c *Cursor) GotoLast(find string) bool {
-	for l := len(c.text.lines) - 1; l >= 0; l-- {
-		linedata := string(c.text.lines[l].data)
-		b := strings.LastIndex(linedata, find)
-		if b != -1 {
+// GotoLast moves the cursor to the last match of re in the text.
+// It returns byte length of the match, and whether it found the match.
+func (c *Cursor) GotoLast(re *regexp.Regexp) (int, bool) {
+	for l := c.text.NumLines() - 1; l >= 0; l-- {
+		linedata := c.text.LineData(l)
+		m := matchBefore(re, linedata, len(linedata)+1)
+		if m != nil {
 			c.l = l
-			c.SetB(b)
-			return true
+			c.SetB(m[0])
+			return m[1] - m[0], true
 		}
 	}
-	return false
+	return 0, false
 }
 
 func (c *Cursor) GotoNextAny(chars string) bool {
-	for l := c.l; l < len(c.text.lines); l++ {
-		linedata := string(c.text.lines[l].data)
+	for l := c.l; l < c.text.NumLines(); l++ {
+		linedata := c.text.LineData(l)
 		offset := 0
 		if l == c.l {
 			if c.b == len(linedata) {
@@ -568,7 +651,7 @@ func (c *Cursor) GotoNextAny(chars string) bool {
 
 func (c *Cursor) GotoPrevAny(chars string) bool {
 	for l := c.l; l >= 0; l-- {
-		linedata := string(c.text.lines[l].data)
+		linedata := c.text.LineData(l)
 		if l == c.l {
 			linedata = linedata[:c.b]
 		}
@@ -584,15 +667,15 @@ func (c *Cursor) GotoPrevAny(chars string) bool {
 
 func (c *Cursor) GotoNextGlobalLine() {
 	findLine := -1
-	for l := c.l + 1; l < len(c.text.lines); l++ {
-		d := c.text.lines[l].data
+	for l := c.l + 1; l < c.text.NumLines(); l++ {
+		d := c.text.LineData(l)
 		if d != "" && !unicode.IsSpace(rune(d[0])) {
 			findLine = l
 			break
 		}
 	}
 	if findLine == -1 {
-		findLine = len(c.text.lines) - 1
+		findLine = c.text.NumLines() - 1
 	}
 	c.l = findLine
 	c.SetB(0)
@@ -607,7 +690,7 @@ func (c *Cursor) GotoPrevGlobalLine() {
 	}
 	findLine := -1
 	for l := startLine; l >= 0; l-- {
-		d := c.text.lines[l].data
+		d := c.text.LineData(l)
 		if d != "" && !unicode.IsSpace(rune(d[0])) {
 			findLine = l
 			break
@@ -621,12 +704,11 @@ func (c *Cursor) GotoPrevGlobalLine() {
 }
 
 func (c *Cursor) GotoNextDefinition(defn []string) bool {
-	nextLines := c.text.lines[c.l+1:]
-	for i, line := range nextLines {
-		l := c.l + 1 + i
+	for l := c.l + 1; l < c.text.NumLines(); l++ {
+		line := c.text.LineData(l)
 		find := false
 		for _, d := range defn {
-			if strings.HasPrefix(string(line.data), d) {
+			if strings.HasPrefix(line, d) {
 				find = true
 				break
 			}
@@ -650,7 +732,7 @@ func (c *Cursor) GotoPrevDefinition(defn []string) bool {
 	find := false
 	for l := startLine; l >= 0; l-- {
 		for _, d := range defn {
-			if strings.HasPrefix(string(c.text.lines[l].data), d) {
+			if strings.HasPrefix(c.text.LineData(l), d) {
 				find = true
 				break
 			}
@@ -677,7 +759,7 @@ func (c *Cursor) GotoPrevIndentMatch() bool {
 	jumped := false
 	lastMatched := c.l
 	for l := c.l - 1; l >= 0; l-- {
-		line := c.text.lines[l].data
+		line := c.text.LineData(l)
 		if line == "" {
 			continue
 		}
@@ -723,8 +805,8 @@ func (c *Cursor) GotoNextIndentMatch() bool {
 	n := 0
 	jumped := false
 	lastMatched := c.l
-	for l := c.l + 1; l < len(c.text.lines); l++ {
-		line := c.text.lines[l].data
+	for l := c.l + 1; l < c.text.NumLines(); l++ {
+		line := c.text.LineData(l)
 		if line == "" {
 			continue
 		}
@@ -839,8 +921,8 @@ func (c *Cursor) GotoMatchingBracket() bool {
 }
 
 func (c *Cursor) GotoLine(l int) {
-	if l >= len(c.text.lines) {
-		l = len(c.text.lines) - 1
+	if l >= c.text.NumLines() {
+		l = c.text.NumLines() - 1
 	}
 	c.l = l
 	c.SetB(0)
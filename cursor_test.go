@@ -1,6 +1,7 @@
 package main
 
 import (
+	"regexp"
 	"testing"
 )
 
@@ -43,3 +44,72 @@ func TestBFromO(t *testing.T) {
 		}
 	}
 }
+
+func TestGotoNextPrev(t *testing.T) {
+	text := NewText([]string{
+		"func fooHandler() {}",
+		"// TODO(kybin): find me",
+		"func barHandler() {}",
+	})
+	re := regexp.MustCompile(`func \w+Handler`)
+	c := NewCursor(text)
+	n, ok := c.GotoNext(re)
+	if !ok || c.l != 2 || c.b != 0 || n != len("func barHandler") {
+		t.Fatalf("GotoNext: got (%v, %v) at %v:%v", n, ok, c.l, c.b)
+	}
+	_, ok = c.GotoNext(re)
+	if ok {
+		t.Fatalf("GotoNext: should not find anymore")
+	}
+	n, ok = c.GotoPrev(re)
+	if !ok || c.l != 0 || c.b != 0 || n != len("func fooHandler") {
+		t.Fatalf("GotoPrev: got (%v, %v) at %v:%v", n, ok, c.l, c.b)
+	}
+	n, ok = c.GotoLast(regexp.MustCompile(`TODO\(\w+\)`))
+	if !ok || c.l != 1 || c.b != 3 || n != len("TODO(kybin)") {
+		t.Fatalf("GotoLast: got (%v, %v) at %v:%v", n, ok, c.l, c.b)
+	}
+}
+
+func TestMatchAfterBefore(t *testing.T) {
+	cases := []struct {
+		re     string
+		line   string
+		b      int
+		after  int
+		before int
+	}{
+		// a match could overlap with the one before it.
+		{"aa", "aaa", 1, 1, 0},
+		{"aa", "aaa", 2, -1, 1},
+		// assertions see the text before b.
+		{`^a`, "aa", 1, -1, 0},
+		{`\ba`, "ba ab", 1, 3, -1},
+		{`\Ba`, "ba", 1, 1, -1},
+		{"é", "éé", 1, 2, 0},
+	}
+	for _, c := range cases {
+		re := regexp.MustCompile(c.re)
+		after, before := -1, -1
+		if m := matchAfter(re, c.line, c.b); m != nil {
+			after = m[0]
+		}
+		if m := matchBefore(re, c.line, c.b); m != nil {
+			before = m[0]
+		}
+		if after != c.after || before != c.before {
+			t.Fatalf("%q in %q from %v: got after %v, before %v, want %v, %v", c.re, c.line, c.b, after, before, c.after, c.before)
+		}
+	}
+
+	text := NewText([]string{"aaa"})
+	cur := NewCursor(text)
+	cur.SetB(1)
+	if _, ok := cur.GotoNext(regexp.MustCompile("aa")); ok {
+		t.Fatalf("GotoNext from 1: should not find a match from 2")
+	}
+	cur.SetB(0)
+	if _, ok := cur.GotoNext(regexp.MustCompile("aa")); !ok || cur.b != 1 {
+		t.Fatalf("GotoNext from 0: got %v, %v, want the overlapping match at 1", cur.b, ok)
+	}
+}
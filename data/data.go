@@ -42,7 +42,7 @@ func (c Clip) Cut(o int) (a, b Clip) {
 	aNewlines := make([]int, 0)
 	bNewlines := make([]int, 0)
 	for _, n := range c.newlines {
-		if o < n {
+		if n < o {
 			aNewlines = append(aNewlines, n)
 		} else {
 			bNewlines = append(bNewlines, n-o)
@@ -0,0 +1,294 @@
+package data
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+const (
+	// chunkSize is the maximum size of a clip when a text is created.
+	// Cutting a clip costs it's size, so big data is split into chunks.
+	chunkSize = 64 * 1024
+	// mergeSize is the maximum size of a clip that could be merged with it's neighbor.
+	// Without merging, every keystroke will create a new clip.
+	mergeSize = 1024
+)
+
+// Text is a text made of clips.
+//
+// It never copies the whole data when it is edited,
+// but cuts clips at the edit point and inserts or removes clips there.
+// So the cost of an edit is proportional to the edit size.
+//
+// Positions in a Text are byte offsets from the start of the text,
+// or (line, byte offset in the line) pairs. Lines are separated by "\n".
+type Text struct {
+	clips  []Clip
+	len    int // byte length of the text
+	nlines int // number of newlines in the text
+
+	// cache remembers a clip that was looked up lastly.
+	// Most lookups are sequential, so it makes them fast.
+	ci     int // clip index
+	cbytes int // bytes before the clip
+	cnls   int // newlines before the clip
+}
+
+// NewText creates a new Text from data.
+// The data is copied, so it is safe to modify data after.
+func NewText(data []byte) *Text {
+	t := &Text{clips: []Clip{}}
+	for len(data) != 0 {
+		n := chunkSize
+		if n > len(data) {
+			n = len(data)
+		}
+		chunk := make([]byte, n)
+		copy(chunk, data[:n])
+		data = data[n:]
+		c := DataClip(chunk)
+		t.clips = append(t.clips, c)
+		t.len += len(c.data)
+		t.nlines += len(c.newlines)
+	}
+	return t
+}
+
+// Len returns byte length of the text.
+func (t *Text) Len() int {
+	return t.len
+}
+
+// Lines returns number of lines in the text.
+// An empty text has one (empty) line.
+func (t *Text) Lines() int {
+	return t.nlines + 1
+}
+
+// seekClip moves the cache to the clip that contains the byte offset.
+// It returns the clip index and the offset in the clip.
+// If off is the end of the text, it will return len(t.clips), 0.
+func (t *Text) seekClip(off int) (int, int) {
+	if off < 0 || off > t.len {
+		panic("offset out of range")
+	}
+	for t.ci > 0 && t.cbytes > off {
+		t.ci--
+		t.cbytes -= len(t.clips[t.ci].data)
+		t.cnls -= len(t.clips[t.ci].newlines)
+	}
+	for t.ci < len(t.clips) && t.cbytes+len(t.clips[t.ci].data) <= off {
+		t.cbytes += len(t.clips[t.ci].data)
+		t.cnls += len(t.clips[t.ci].newlines)
+		t.ci++
+	}
+	return t.ci, off - t.cbytes
+}
+
+// newline returns the byte offset of k-th newline in the text.
+func (t *Text) newline(k int) int {
+	if k < 0 || k >= t.nlines {
+		panic("newline out of range")
+	}
+	for t.ci > 0 && t.cnls > k {
+		t.ci--
+		t.cbytes -= len(t.clips[t.ci].data)
+		t.cnls -= len(t.clips[t.ci].newlines)
+	}
+	for t.cnls+len(t.clips[t.ci].newlines) <= k {
+		t.cbytes += len(t.clips[t.ci].data)
+		t.cnls += len(t.clips[t.ci].newlines)
+		t.ci++
+	}
+	return t.cbytes + t.clips[t.ci].newlines[k-t.cnls]
+}
+
+// LineStart returns byte offset of the start of line l.
+func (t *Text) LineStart(l int) int {
+	if l < 0 || l > t.nlines {
+		panic("line out of range")
+	}
+	if l == 0 {
+		return 0
+	}
+	return t.newline(l-1) + 1
+}
+
+// LineEnd returns byte offset of the end of line l.
+// The offset is where the line's newline is, or the end of the text.
+func (t *Text) LineEnd(l int) int {
+	if l < 0 || l > t.nlines {
+		panic("line out of range")
+	}
+	if l == t.nlines {
+		return t.len
+	}
+	return t.newline(l)
+}
+
+// Line returns data of line l, without it's newline.
+func (t *Text) Line(l int) []byte {
+	return t.Range(t.LineStart(l), t.LineEnd(l))
+}
+
+// Offset returns byte offset of the position (l, b),
+// which b is byte offset in line l.
+func (t *Text) Offset(l, b int) int {
+	start := t.LineStart(l)
+	if b < 0 || start+b > t.LineEnd(l) {
+		panic("byte offset out of line")
+	}
+	return start + b
+}
+
+// Pos returns the (line, byte offset in the line) position of byte offset off.
+func (t *Text) Pos(off int) (int, int) {
+	i, o := t.seekClip(off)
+	l := t.cnls
+	if i < len(t.clips) {
+		l += sort.SearchInts(t.clips[i].newlines, o)
+	}
+	return l, off - t.LineStart(l)
+}
+
+// RuneOffset returns byte offset of n-th rune in line l.
+// If the line has fewer runes than n, it will return the line's length.
+func (t *Text) RuneOffset(l, n int) int {
+	data := t.Line(l)
+	b := 0
+	for i := 0; i < n && b < len(data); i++ {
+		_, size := utf8.DecodeRune(data[b:])
+		b += size
+	}
+	return b
+}
+
+// RuneColumn returns how many runes are in front of byte offset b in line l.
+func (t *Text) RuneColumn(l, b int) int {
+	data := t.Line(l)
+	if b > len(data) {
+		b = len(data)
+	}
+	return utf8.RuneCount(data[:b])
+}
+
+// Range returns a copy of data between byte offsets [from, to).
+func (t *Text) Range(from, to int) []byte {
+	if from > to {
+		panic("invalid range")
+	}
+	data := make([]byte, 0, to-from)
+	i, o := t.seekClip(from)
+	for len(data) < to-from {
+		c := t.clips[i].data[o:]
+		need := to - from - len(data)
+		if need < len(c) {
+			c = c[:need]
+		}
+		data = append(data, c...)
+		i++
+		o = 0
+	}
+	return data
+}
+
+// Bytes returns a copy of the whole data.
+func (t *Text) Bytes() []byte {
+	return t.Range(0, t.len)
+}
+
+// joinClips joins clips into a new clip.
+func joinClips(clips ...Clip) Clip {
+	n := 0
+	for _, c := range clips {
+		n += len(c.data)
+	}
+	data := make([]byte, 0, n)
+	for _, c := range clips {
+		data = append(data, c.data...)
+	}
+	return DataClip(data)
+}
+
+// stepBack moves the cache to the previous clip of clip i, if the cache is at i.
+// Clips from i-1 could be changed after this, while the cache is still valid.
+func (t *Text) stepBack(i int) {
+	if t.ci == i && i > 0 {
+		t.ci--
+		t.cbytes -= len(t.clips[t.ci].data)
+		t.cnls -= len(t.clips[t.ci].newlines)
+	}
+}
+
+// Insert inserts data at byte offset off.
+// The data is copied, so it is safe to modify data after.
+func (t *Text) Insert(off int, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	d := make([]byte, len(data))
+	copy(d, data)
+	ins := DataClip(d)
+
+	i, o := t.seekClip(off)
+	t.stepBack(i)
+	switch {
+	case o == 0 && i > 0 && len(t.clips[i-1].data) < mergeSize:
+		// append to the prev clip.
+		t.clips[i-1] = joinClips(t.clips[i-1], ins)
+	case o == 0 && i < len(t.clips) && len(t.clips[i].data) < mergeSize:
+		// prepend to the next clip.
+		t.clips[i] = joinClips(ins, t.clips[i])
+	case o == 0:
+		t.clips = append(t.clips[:i], append([]Clip{ins}, t.clips[i:]...)...)
+	case len(t.clips[i].data) < mergeSize:
+		a, b := t.clips[i].Cut(o)
+		t.clips[i] = joinClips(a, ins, b)
+	default:
+		a, b := t.clips[i].Cut(o)
+		t.clips = append(t.clips[:i], append([]Clip{a, ins, b}, t.clips[i+1:]...)...)
+	}
+	t.len += len(ins.data)
+	t.nlines += len(ins.newlines)
+}
+
+// cut makes a clip boundary at byte offset off.
+// It returns index of the clip that starts at off.
+func (t *Text) cut(off int) int {
+	i, o := t.seekClip(off)
+	if o == 0 {
+		return i
+	}
+	a, b := t.clips[i].Cut(o)
+	t.clips = append(t.clips[:i], append([]Clip{a, b}, t.clips[i+1:]...)...)
+	return i + 1
+}
+
+// Delete deletes data between byte offsets [from, to), and returns the deleted data.
+func (t *Text) Delete(from, to int) []byte {
+	if from > to || from < 0 || to > t.len {
+		panic("invalid range")
+	}
+	if from == to {
+		return []byte{}
+	}
+	deleted := t.Range(from, to)
+	i := t.cut(from)
+	j := t.cut(to)
+	// move the cache back to clip i, which will not change.
+	t.seekClip(from)
+	t.stepBack(i)
+	t.clips = append(t.clips[:i], t.clips[j:]...)
+	t.len -= len(deleted)
+	for _, b := range deleted {
+		if b == '\n' {
+			t.nlines--
+		}
+	}
+	// merge small neighbors, not to make too many clips.
+	if i > 0 && i < len(t.clips) && len(t.clips[i-1].data)+len(t.clips[i].data) < mergeSize {
+		t.clips[i-1] = joinClips(t.clips[i-1], t.clips[i])
+		t.clips = append(t.clips[:i], t.clips[i+1:]...)
+	}
+	return deleted
+}
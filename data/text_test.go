@@ -0,0 +1,114 @@
+package data
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClipCut(t *testing.T) {
+	cases := []struct {
+		clip  Clip
+		o     int
+		wantA Clip
+		wantB Clip
+	}{
+		{
+			clip:  DataClip([]byte("what a nice day\ndo you have breakfast?\n")),
+			o:     10,
+			wantA: DataClip([]byte("what a nic")),
+			wantB: DataClip([]byte("e day\ndo you have breakfast?\n")),
+		},
+		{
+			clip:  DataClip([]byte("what a nice day\ndo you have breakfast?\n")),
+			o:     20,
+			wantA: DataClip([]byte("what a nice day\ndo y")),
+			wantB: DataClip([]byte("ou have breakfast?\n")),
+		},
+	}
+	for _, c := range cases {
+		a, b := c.clip.Cut(c.o)
+		if !reflect.DeepEqual(a, c.wantA) || !reflect.DeepEqual(b, c.wantB) {
+			t.Fatalf("Cut(%d): got %v, %v, want %v, %v", c.o, a, b, c.wantA, c.wantB)
+		}
+	}
+}
+
+func TestTextLines(t *testing.T) {
+	text := NewText([]byte("이 건\n한글\n\ntest"))
+	wantLines := []string{"이 건", "한글", "", "test"}
+	if text.Lines() != len(wantLines) {
+		t.Fatalf("Lines: got %d, want %d", text.Lines(), len(wantLines))
+	}
+	for l, want := range wantLines {
+		got := string(text.Line(l))
+		if got != want {
+			t.Fatalf("Line(%d): got %q, want %q", l, got, want)
+		}
+	}
+	if text.Len() != len("이 건\n한글\n\ntest") {
+		t.Fatalf("Len: got %d, want %d", text.Len(), len("이 건\n한글\n\ntest"))
+	}
+	if o := text.Offset(1, 3); o != 11 {
+		t.Fatalf("Offset(1, 3): got %d, want 11", o)
+	}
+	if l, b := text.Pos(11); l != 1 || b != 3 {
+		t.Fatalf("Pos(11): got (%d, %d), want (1, 3)", l, b)
+	}
+	if b := text.RuneOffset(0, 2); b != 4 {
+		t.Fatalf("RuneOffset(0, 2): got %d, want 4", b)
+	}
+	if n := text.RuneColumn(1, 6); n != 2 {
+		t.Fatalf("RuneColumn(1, 6): got %d, want 2", n)
+	}
+	if r := string(text.Range(8, 15)); r != "한글\n" {
+		t.Fatalf("Range(8, 15): got %q, want %q", r, "한글\n")
+	}
+}
+
+// TestTextEdit edits a Text and a byte slice at the same time randomly,
+// then checks whether they are same.
+func TestTextEdit(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	words := []string{"a", "bc", "\n", "def\n", "\n\n", "ghijk", strings.Repeat("long line\n", 200)}
+
+	want := []byte(strings.Repeat("this is a line\n", chunkSize/10))
+	text := NewText(want)
+	for i := 0; i < 2000; i++ {
+		if rnd.Intn(3) != 0 || len(want) == 0 {
+			off := rnd.Intn(len(want) + 1)
+			w := words[rnd.Intn(len(words))]
+			text.Insert(off, []byte(w))
+			want = append(want[:off:off], append([]byte(w), want[off:]...)...)
+		} else {
+			from := rnd.Intn(len(want))
+			to := from + rnd.Intn(len(want)-from+1)
+			if to-from > 3000 {
+				to = from + 3000
+			}
+			got := text.Delete(from, to)
+			if !bytes.Equal(got, want[from:to]) {
+				t.Fatalf("step %d: Delete(%d, %d): got %q, want %q", i, from, to, got, want[from:to])
+			}
+			want = append(want[:from:from], want[to:]...)
+		}
+		if text.Len() != len(want) {
+			t.Fatalf("step %d: Len: got %d, want %d", i, text.Len(), len(want))
+		}
+		if text.Lines() != bytes.Count(want, []byte("\n"))+1 {
+			t.Fatalf("step %d: Lines: got %d, want %d", i, text.Lines(), bytes.Count(want, []byte("\n"))+1)
+		}
+	}
+	if !bytes.Equal(text.Bytes(), want) {
+		t.Fatalf("Bytes: not matched with the expected data")
+	}
+	wantLines := bytes.Split(want, []byte("\n"))
+	// check lines in backward, as forward lookups are checked by Bytes.
+	for l := len(wantLines) - 1; l >= 0; l-- {
+		if !bytes.Equal(text.Line(l), wantLines[l]) {
+			t.Fatalf("Line(%d): got %q, want %q", l, text.Line(l), wantLines[l])
+		}
+	}
+}
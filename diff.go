@@ -0,0 +1,170 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/kybin/tor/cell"
+)
+
+// maxDiffCells is the biggest table of lines, that diffLines finds the longest common subsequence on.
+// Bigger changes are treated as a hunk, after the common lines at the start and end.
+const maxDiffCells = 4000000
+
+// lineHunk is a change of lines, that replaces old lines [oldL, oldL+oldN) with new lines [newL, newL+newN).
+type lineHunk struct {
+	oldL, oldN int
+	newL, newN int
+}
+
+// diffLines returns hunks those change a to b, from the top.
+// Lines those are not in the hunks are the longest common subsequence of a and b.
+func diffLines(a, b []string) []lineHunk {
+	p := 0
+	for p < len(a) && p < len(b) && a[p] == b[p] {
+		p++
+	}
+	s := 0
+	for s < len(a)-p && s < len(b)-p && a[len(a)-1-s] == b[len(b)-1-s] {
+		s++
+	}
+	ma, mb := a[p:len(a)-s], b[p:len(b)-s]
+	if len(ma) == 0 && len(mb) == 0 {
+		return nil
+	}
+	if len(ma)*len(mb) > maxDiffCells {
+		return []lineHunk{{p, len(ma), p, len(mb)}}
+	}
+	// lcs[i][j] is length of the longest common subsequence of ma[i:] and mb[j:].
+	lcs := make([][]int, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	hunks := make([]lineHunk, 0)
+	var h *lineHunk
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		if i < len(ma) && j < len(mb) && ma[i] == mb[j] {
+			h = nil
+			i++
+			j++
+			continue
+		}
+		if h == nil {
+			hunks = append(hunks, lineHunk{oldL: p + i, newL: p + j})
+			h = &hunks[len(hunks)-1]
+		}
+		if j == len(mb) || (i < len(ma) && lcs[i+1][j] >= lcs[i][j+1]) {
+			h.oldN++
+			i++
+		} else {
+			h.newN++
+			j++
+		}
+	}
+	return hunks
+}
+
+// hunkEdits returns edits those change old lines a to new lines b by the hunks.
+// Edits are made from the bottom, so line numbers of a hunk are not changed by the edits before it.
+func hunkEdits(hunks []lineHunk, a, b []string) []edit {
+	edits := make([]edit, 0, len(hunks)*2)
+	for k := len(hunks) - 1; k >= 0; k-- {
+		h := hunks[k]
+		del := strings.Join(a[h.oldL:h.oldL+h.oldN], "\n")
+		ins := strings.Join(b[h.newL:h.newL+h.newN], "\n")
+		l, o := h.oldL, 0
+		if h.oldL+h.oldN < len(a) {
+			// the hunk is followed by a common line.
+			if h.oldN != 0 {
+				del += "\n"
+			}
+			if h.newN != 0 {
+				ins += "\n"
+			}
+		} else if h.oldL > 0 {
+			// the hunk is at the end, so the newline is before it.
+			l, o = h.oldL-1, len(a[h.oldL-1])
+			if h.oldN != 0 {
+				del = "\n" + del
+			}
+			if h.newN != 0 {
+				ins = "\n" + ins
+			}
+		}
+		if del != "" {
+			edits = append(edits, deleteEdit{l, o, del})
+		}
+		if ins != "" {
+			edits = append(edits, insertEdit{l, o, ins})
+		}
+	}
+	return edits
+}
+
+// remapPt returns where p of old lines a is in new lines b, those are changed by the hunks.
+// A position in an unchanged line stays at the line. A position in a changed line
+// is found in the new lines of it's hunk by content, as formattedPos.
+func remapPt(hunks []lineHunk, a, b []string, p cell.Pt) cell.Pt {
+	d := 0
+	for _, h := range hunks {
+		if p.L < h.oldL {
+			break
+		}
+		if p.L >= h.oldL+h.oldN {
+			d += h.newN - h.oldN
+			continue
+		}
+		if h.newN == 0 {
+			if h.newL == len(b) {
+				return cell.Pt{len(b) - 1, len(b[len(b)-1])}
+			}
+			return cell.Pt{h.newL, 0}
+		}
+		old := strings.Join(a[h.oldL:h.oldL+h.oldN], "\n")
+		new := strings.Join(b[h.newL:h.newL+h.newN], "\n")
+		np := bytePt(new, formattedPos(old, new, byteOffset(old, cell.Pt{p.L - h.oldL, p.O})))
+		return cell.Pt{h.newL + np.L, np.O}
+	}
+	return cell.Pt{p.L + d, p.O}
+}
+
+// replaceText replaces the text with s, by edits of changed lines only.
+// So it could be undone, and the cursors and selections stay at the same content.
+func (m *NormalMode) replaceText(s string) {
+	a := strings.Split(string(m.text.Bytes()), "\n")
+	b := strings.Split(s, "\n")
+	hunks := diffLines(a, b)
+	if len(hunks) == 0 {
+		return
+	}
+	all := m.cursorSels()
+	poses := make([][3]cell.Pt, len(all))
+	for i, cs := range all {
+		poses[i] = [3]cell.Pt{
+			remapPt(hunks, a, b, cs.cursor.BytePos()),
+			remapPt(hunks, a, b, cs.selection.rng.Start),
+			remapPt(hunks, a, b, cs.selection.rng.End),
+		}
+	}
+	for _, e := range hunkEdits(hunks, a, b) {
+		m.text.Apply(e)
+	}
+	for i, cs := range all {
+		cs.cursor.SetBytePos(poses[i][0])
+		if cs.selection.on {
+			cs.selection.SetStart(poses[i][1])
+			cs.selection.SetEnd(poses[i][2])
+		}
+	}
+}
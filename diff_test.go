@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kybin/tor/cell"
+)
+
+func TestDiffLines(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want []lineHunk
+	}{
+		{"a\nb\nc", "a\nb\nc", nil},
+		{"a\nb\nc", "a\nB\nc", []lineHunk{{1, 1, 1, 1}}},
+		{"a\nb\nc\nd", "x\nb\nc\nd\ne", []lineHunk{{0, 1, 0, 1}, {4, 0, 4, 1}}},
+		{"a\nb\nc", "c", []lineHunk{{0, 2, 0, 0}}},
+		{"a\nb\nc", "a", []lineHunk{{1, 2, 1, 0}}},
+		{"c\nb\na", "a\nb\nc", []lineHunk{{0, 2, 0, 0}, {3, 0, 1, 2}}},
+	}
+	for _, c := range cases {
+		a, b := strings.Split(c.a, "\n"), strings.Split(c.b, "\n")
+		hunks := diffLines(a, b)
+		if !reflect.DeepEqual(hunks, c.want) && !(len(hunks) == 0 && len(c.want) == 0) {
+			t.Fatalf("diffLines(%q, %q): got %v, want %v", c.a, c.b, hunks, c.want)
+		}
+		text := NewText(a)
+		for _, e := range hunkEdits(hunks, a, b) {
+			text.Apply(e)
+		}
+		if got := strings.Join(textLines(text), "\n"); got != c.b {
+			t.Fatalf("hunkEdits(%q, %q): got %q", c.a, c.b, got)
+		}
+	}
+}
+
+func TestRemapPt(t *testing.T) {
+	a := strings.Split("one\nfunc f(){\n\tx:=1\n}\nlast", "\n")
+	b := strings.Split("zero\none\nfunc f() {\n\tx := 1\n}\nlast", "\n")
+	hunks := diffLines(a, b)
+	cases := []struct {
+		p, want cell.Pt
+	}{
+		// unchanged lines stay at the line, even if lines above are added.
+		{cell.Pt{0, 2}, cell.Pt{1, 2}},
+		{cell.Pt{4, 3}, cell.Pt{5, 3}},
+		// in changed lines, it stays at the same content.
+		{cell.Pt{1, 8}, cell.Pt{2, 9}},
+		{cell.Pt{2, 4}, cell.Pt{3, 6}},
+	}
+	for _, c := range cases {
+		if got := remapPt(hunks, a, b, c.p); got != c.want {
+			t.Fatalf("remapPt(%v): got %v, want %v", c.p, got, c.want)
+		}
+	}
+}
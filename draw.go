@@ -1,9 +1,10 @@
 package main
 
 import (
+	"regexp"
+
 	"github.com/gdamore/tcell/v2"
 	"github.com/kybin/tor/cell"
-	"github.com/kybin/tor/syntax"
 	"github.com/mattn/go-runewidth"
 )
 
@@ -11,47 +12,88 @@ func SetCell(s tcell.Screen, l, o int, r rune, style tcell.Style) {
 	s.SetContent(o, l, r, nil, style)
 }
 
-// draw text inside of window at mainarea.
-func drawScreen(s tcell.Screen, norm *NormalMode) {
-	w := norm.area.Win
-	// parse syntax
-	if norm.dirty {
-		norm.parser.ClearFrom(cell.Pt{L: w.Min().L, O: 0})
-		norm.dirty = false
-	}
-	norm.parser.ParseTo(cell.Pt{L: w.Max().L + 1, O: 0})
+// drawScreen draws text of a's buffer inside of it's window.
+// Matches of hl will be highlighted, if hl is not nil.
+// Extra cursors are drawn as reversed cells, with their selections.
+func drawScreen(s tcell.Screen, a *Area, extras []cursorSel, lineNumbers string, hl *regexp.Regexp, th *Theme) {
+	buf := a.buf
+	w := a.Win
+	// parse syntax. only changed lines will be parsed again.
+	buf.parser.ParseTo(w.Max().L + 1)
 
 	// draw
-	for l, ln := range norm.text.lines {
-		if l < w.Min().L || l >= w.Max().L {
-			continue
+	tm := a.TextMin()
+	// sl is a line on screen from the window's top.
+	// When lines are wrapped, a line could have multiple rows, and rows of the top line before w.row are hidden.
+	sl := -w.row
+	// set sets a cell at visual offset o of the screen line, only when it is inside of the window.
+	// Otherwise it would be drawn on a separator, or on the next area.
+	set := func(o int, r rune, style tcell.Style) {
+		if sl < 0 || o < w.Min().O || o-w.Min().O >= w.size.O {
+			return
+		}
+		SetCell(s, sl+tm.L, o-w.Min().O+tm.O, r, style)
+	}
+	for l := w.Min().L; sl < w.size.L && l < buf.text.NumLines(); l++ {
+		ln := buf.text.Line(l)
+		origStyle := th.Text.Style()
+		var hlMatches [][]int
+		if hl != nil {
+			// matches could overlap, as the ones find mode moves to.
+			eachMatch(hl, ln.data, 0, func(m []int) bool {
+				hlMatches = append(hlMatches, []int{m[0], m[1]})
+				return true
+			})
+		}
+		if sl >= 0 {
+			drawGutter(s, a, lineNumbers, l, sl+tm.L, hl, th)
+		}
+		matches := buf.parser.LineMatches(l)
+		// rowStarts are where the next rows start, when lines are wrapped.
+		var rowStarts []int
+		if w.wrap {
+			rowStarts = wrapLine(ln.data, w.size.O, buf.text.tabWidth)[1:]
 		}
-		origStyle := tcell.StyleDefault.Background(tcell.ColorReset).Foreground(tcell.ColorReset)
 		o := 0
 		for b, r := range ln.data {
-			if o >= w.Max().O {
+			if len(rowStarts) != 0 && rowStarts[0] == b {
+				rowStarts = rowStarts[1:]
+				sl++
+				o = 0
+			}
+			if sl >= w.size.L || o >= w.Max().O {
 				break
 			}
 
 			style := origStyle
-			for _, m := range norm.parser.Matches {
-				if m.Range.Contains(cell.Pt{l, b}) {
-					attr, ok := syntax.DefaultTheme[m.Type]
-					if ok {
-						style = tcell.StyleDefault.Background(attr.Bg).Foreground(attr.Fg)
-					}
-					break
-				}
+			// matches are in order, drop the ones before b.
+			for len(matches) != 0 && matches[0].Range.Max().O <= b {
+				matches = matches[1:]
+			}
+			if len(matches) != 0 && matches[0].Range.Min().O <= b {
+				style = th.SyntaxAttr(matches[0].Type).Style()
 			}
 
-			if norm.selection.Contains(cell.Pt{l, b}) {
-				style = tcell.StyleDefault.Background(tcell.ColorGreen).Foreground(tcell.ColorReset)
+			for len(hlMatches) != 0 && hlMatches[0][1] <= b {
+				hlMatches = hlMatches[1:]
+			}
+			if len(hlMatches) != 0 && hlMatches[0][0] <= b {
+				style = th.Search.Style()
+			}
+			if a.selection.Contains(cell.Pt{l, b}) {
+				style = th.Selection.Style()
+			}
+			for _, cs := range extras {
+				if cs.selection.Contains(cell.Pt{l, b}) {
+					style = th.Selection.Style()
+				}
+			}
+			if extraCursorAt(extras, l, b) {
+				style = style.Reverse(true)
 			}
 			if r == '\t' {
-				for i := 0; i < norm.text.tabWidth; i++ {
-					if o >= w.Min().O {
-						SetCell(s, l-w.Min().L, o-w.Min().O+norm.area.min.O, rune(' '), style)
-					}
+				for i := 0; i < buf.text.tabWidth; i++ {
+					set(o, ' ', style)
 					o += 1
 				}
 			} else {
@@ -62,28 +104,71 @@ func drawScreen(s tcell.Screen, norm *NormalMode) {
 					r = '\u2591'
 					width = 1
 				}
-				if o >= w.Min().O {
-					SetCell(s, l-w.Min().L, o-w.Min().O+norm.area.min.O, rune(r), style)
+				if o+width-1-w.Min().O >= w.size.O {
+					// a wide rune that doesn't fit at the right end.
+					r = ' '
 				}
+				set(o, r, style)
 				o += width
 			}
 		}
-		// set original color to the last cell. (white and black)
+		if len(rowStarts) != 0 {
+			// the last row is full. the end of the line is at the next row.
+			sl++
+			o = 0
+		}
+		// set original color to the last cell.
 		// if not set, the cursor's color will look different.
-		SetCell(s, l-w.Min().L, o-w.Min().O+norm.area.min.O, rune(' '), origStyle)
+		if sl < w.size.L {
+			style := origStyle
+			if extraCursorAt(extras, l, len(ln.data)) {
+				style = style.Reverse(true)
+			}
+			set(o, ' ', style)
+		}
+		sl++
+	}
+}
+
+// extraCursorAt checks whether one of extras is at byte offset b of line l.
+func extraCursorAt(extras []cursorSel, l, b int) bool {
+	for _, cs := range extras {
+		if cs.cursor.l == l && cs.cursor.b == b {
+			return true
+		}
+	}
+	return false
+}
+
+// drawSeparators draws lines between areas of layout n.
+func drawSeparators(s tcell.Screen, n *layout, th *Theme) {
+	if n.area != nil {
+		return
+	}
+	style := th.LineNumber.Style()
+	if n.vertical {
+		for l := 0; l < n.size.L; l++ {
+			SetCell(s, n.min.L+l, n.min.O+n.sep, '\u2502', style)
+		}
+	} else {
+		for o := 0; o < n.size.O; o++ {
+			SetCell(s, n.min.L+n.sep, n.min.O+o, '\u2500', style)
+		}
 	}
+	drawSeparators(s, n.children[0], th)
+	drawSeparators(s, n.children[1], th)
 }
 
 // drawStatus draws current status of m at bottom of terminal.
-// If m has Error, it will printed with red background.
-func drawStatus(s tcell.Screen, m Mode) {
+// If m has Error, it will printed with the theme's error colors.
+func drawStatus(s tcell.Screen, m Mode, th *Theme) {
 	var style tcell.Style
 	var status string
 	if m.Error() != "" {
-		style = tcell.StyleDefault.Background(tcell.ColorRed).Foreground(tcell.ColorBlack)
+		style = th.Error.Style()
 		status = m.Error()
 	} else {
-		style = tcell.StyleDefault.Background(tcell.ColorWhite).Foreground(tcell.ColorBlack)
+		style = th.Status.Style()
 		status = m.Status()
 	}
 
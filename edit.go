@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kybin/tor/cell"
+)
+
+// edit is an invertible change of a text.
+// Every change of a text is made by an edit, so it could be undone by it's inverse.
+type edit interface {
+	apply(t *Text)
+	invert() edit
+	// shift returns where byte position p of the text goes, after the edit is applied.
+	shift(p cell.Pt) cell.Pt
+}
+
+// endOf returns the position after s, when s is at byte offset b of line l.
+func endOf(l, b int, s string) cell.Pt {
+	n := strings.Count(s, "\n")
+	if n == 0 {
+		return cell.Pt{l, b + len(s)}
+	}
+	return cell.Pt{l + n, len(s) - strings.LastIndex(s, "\n") - 1}
+}
+
+// insertEdit inserts s at byte offset b of line l.
+type insertEdit struct {
+	l, b int
+	s    string
+}
+
+func (e insertEdit) apply(t *Text) {
+	t.data.Insert(t.data.Offset(e.l, e.b), []byte(e.s))
+	t.changed(e.l, 1, 1+strings.Count(e.s, "\n"))
+}
+
+func (e insertEdit) invert() edit {
+	return deleteEdit(e)
+}
+
+// shift moves p after the inserted string, if p is at or after where it is inserted.
+func (e insertEdit) shift(p cell.Pt) cell.Pt {
+	if p.Compare(cell.Pt{e.l, e.b}) < 0 {
+		return p
+	}
+	end := endOf(e.l, e.b, e.s)
+	if p.L != e.l {
+		return cell.Pt{p.L + end.L - e.l, p.O}
+	}
+	return cell.Pt{end.L, end.O + p.O - e.b}
+}
+
+// deleteEdit deletes s, which is at byte offset b of line l.
+type deleteEdit struct {
+	l, b int
+	s    string
+}
+
+func (e deleteEdit) apply(t *Text) {
+	off := t.data.Offset(e.l, e.b)
+	deleted := t.data.Delete(off, off+len(e.s))
+	if string(deleted) != e.s {
+		panic(fmt.Sprintf("deleted %q, but it should be %q", deleted, e.s))
+	}
+	t.changed(e.l, 1+strings.Count(e.s, "\n"), 1)
+}
+
+func (e deleteEdit) invert() edit {
+	return insertEdit(e)
+}
+
+// shift moves p to where the deleted string was, if p is inside of it.
+func (e deleteEdit) shift(p cell.Pt) cell.Pt {
+	start := cell.Pt{e.l, e.b}
+	if p.Compare(start) <= 0 {
+		return p
+	}
+	end := endOf(e.l, e.b, e.s)
+	if p.Compare(end) <= 0 {
+		return start
+	}
+	if p.L != end.L {
+		return cell.Pt{p.L - (end.L - e.l), p.O}
+	}
+	return cell.Pt{e.l, e.b + p.O - end.O}
+}
+
+// linePrefix is a string at byte offset b of line l.
+// The string should not have a newline.
+type linePrefix struct {
+	l, b int
+	s    string
+}
+
+// prefixEdit inserts strings to lines, like indenting or commenting lines.
+// If remove is true, it removes the strings from the lines instead.
+// Each line should have only one string.
+type prefixEdit struct {
+	remove   bool
+	prefixes []linePrefix
+}
+
+func (e prefixEdit) apply(t *Text) {
+	for _, p := range e.prefixes {
+		if e.remove {
+			deleteEdit(p).apply(t)
+		} else {
+			insertEdit(p).apply(t)
+		}
+	}
+}
+
+func (e prefixEdit) invert() edit {
+	return prefixEdit{remove: !e.remove, prefixes: e.prefixes}
+}
+
+func (e prefixEdit) shift(p cell.Pt) cell.Pt {
+	for _, pr := range e.prefixes {
+		if e.remove {
+			p = deleteEdit(pr).shift(p)
+		} else {
+			p = insertEdit(pr).shift(p)
+		}
+	}
+	return p
+}
+
+// replaceEdits returns edits that change old to new.
+// It only replaces the changed part, which is between the common prefix and suffix of them.
+func replaceEdits(old, new string) []edit {
+	p := 0
+	for p < len(old) && p < len(new) && old[p] == new[p] {
+		p++
+	}
+	s := 0
+	for s < len(old)-p && s < len(new)-p && old[len(old)-1-s] == new[len(new)-1-s] {
+		s++
+	}
+	l := strings.Count(old[:p], "\n")
+	b := p - (strings.LastIndex(old[:p], "\n") + 1)
+	edits := make([]edit, 0, 2)
+	if d := old[p : len(old)-s]; d != "" {
+		edits = append(edits, deleteEdit{l, b, d})
+	}
+	if i := new[p : len(new)-s]; i != "" {
+		edits = append(edits, insertEdit{l, b, i})
+	}
+	return edits
+}
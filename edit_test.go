@@ -0,0 +1,124 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kybin/tor/cell"
+)
+
+func TestReplaceEdits(t *testing.T) {
+	cases := []struct {
+		old string
+		new string
+	}{
+		{"", ""},
+		{"abc", "abc"},
+		{"func main() {\nprintln(1)\n}", "func main() {\n\tprintln(1)\n}"},
+		{"a\nb\nc", "a\nc"},
+		{"aaa", "aaaa"},
+		{"x := 1\n", ""},
+	}
+	for _, c := range cases {
+		text := NewText(strings.Split(c.old, "\n"))
+		edits := replaceEdits(c.old, c.new)
+		for _, e := range edits {
+			text.Apply(e)
+		}
+		if got := string(text.Bytes()); got != c.new {
+			t.Fatalf("replaceEdits(%q, %q): got %q", c.old, c.new, got)
+		}
+		for i := len(edits) - 1; i >= 0; i-- {
+			text.Apply(edits[i].invert())
+		}
+		if got := string(text.Bytes()); got != c.old {
+			t.Fatalf("replaceEdits(%q, %q): got %q after invert", c.old, c.new, got)
+		}
+	}
+}
+
+func TestToggleComment(t *testing.T) {
+	cases := []struct {
+		in   []string
+		want []string
+	}{
+		{
+			[]string{"func f() {", "", "\treturn 1", "}"},
+			[]string{"// func f() {", "", "\t// return 1", "// }"},
+		},
+		{
+			[]string{"// a", "\t//b", "c"},
+			[]string{"a", "\tb", "c"},
+		},
+	}
+	for _, c := range cases {
+		text := NewText(c.in)
+		e := toggleComment("//", text, []int{0, 1, 2, 3}[:len(c.in)])
+		text.Apply(e)
+		if got := textLines(text); strings.Join(got, "\n") != strings.Join(c.want, "\n") {
+			t.Fatalf("toggleComment(%q): got %q, want %q", c.in, got, c.want)
+		}
+		text.Apply(e.invert())
+		if got := textLines(text); strings.Join(got, "\n") != strings.Join(c.in, "\n") {
+			t.Fatalf("toggleComment(%q): got %q after invert", c.in, got)
+		}
+	}
+}
+
+func TestUnindentLines(t *testing.T) {
+	text := NewText([]string{"\t\ta", "      b", "  c", "d"})
+	text.tabWidth = 4
+	text.Apply(unindentLines(text, []int{0, 1, 2, 3}))
+	want := []string{"\ta", "  b", "c", "d"}
+	if got := textLines(text); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unindentLines: got %q, want %q", got, want)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	text := NewText([]string{"ab"})
+	mark := text.StartRecord()
+	text.Insert("x", 0, 1)
+	inner := text.StartRecord()
+	text.SplitLine(0, 2)
+	if got := text.StopRecord(inner); len(got) != 1 {
+		t.Fatalf("StopRecord: got %d inner edits, want 1", len(got))
+	}
+	edits := text.StopRecord(mark)
+	if len(edits) != 2 || text.recording != 0 {
+		t.Fatalf("StopRecord: got %d edits, want 2", len(edits))
+	}
+	for i := len(edits) - 1; i >= 0; i-- {
+		text.Apply(edits[i].invert())
+	}
+	if got := string(text.Bytes()); got != "ab" {
+		t.Fatalf("invert: got %q, want %q", got, "ab")
+	}
+}
+
+func TestEditShift(t *testing.T) {
+	cases := []struct {
+		e    edit
+		p    cell.Pt
+		want cell.Pt
+	}{
+		{insertEdit{1, 2, "ab"}, cell.Pt{1, 1}, cell.Pt{1, 1}},
+		{insertEdit{1, 2, "ab"}, cell.Pt{1, 2}, cell.Pt{1, 4}},
+		{insertEdit{1, 2, "ab"}, cell.Pt{2, 2}, cell.Pt{2, 2}},
+		{insertEdit{1, 2, "a\nbc"}, cell.Pt{1, 5}, cell.Pt{2, 5}},
+		{insertEdit{1, 2, "a\nbc"}, cell.Pt{3, 0}, cell.Pt{4, 0}},
+		{deleteEdit{1, 2, "ab"}, cell.Pt{1, 2}, cell.Pt{1, 2}},
+		{deleteEdit{1, 2, "ab"}, cell.Pt{1, 3}, cell.Pt{1, 2}},
+		{deleteEdit{1, 2, "ab"}, cell.Pt{1, 5}, cell.Pt{1, 3}},
+		{deleteEdit{1, 2, "a\nbc"}, cell.Pt{2, 1}, cell.Pt{1, 2}},
+		{deleteEdit{1, 2, "a\nbc"}, cell.Pt{2, 4}, cell.Pt{1, 4}},
+		{deleteEdit{1, 2, "a\nbc"}, cell.Pt{3, 4}, cell.Pt{2, 4}},
+		{prefixEdit{prefixes: []linePrefix{{0, 0, "//"}, {1, 0, "//"}}}, cell.Pt{1, 3}, cell.Pt{1, 5}},
+		{prefixEdit{remove: true, prefixes: []linePrefix{{0, 0, "//"}, {1, 0, "//"}}}, cell.Pt{1, 1}, cell.Pt{1, 0}},
+	}
+	for _, c := range cases {
+		if got := c.e.shift(c.p); got != c.want {
+			t.Fatalf("%#v.shift(%v): got %v, want %v", c.e, c.p, got, c.want)
+		}
+	}
+}
@@ -1,36 +1,66 @@
 package main
 
 import (
+	"fmt"
+
 	"github.com/gdamore/tcell/v2"
 )
 
+// ExitMode asks about every unsaved buffer before exit.
+// It shows the buffer it asks about, so user could check the buffer before answer.
 type ExitMode struct {
-	f      string // name of this file.
-	cursor *Cursor
-	tor    *Tor
-	exit   func()
+	unsaved []*Buffer
+	exit    func()
+	err     string
 }
 
 func (m *ExitMode) Start() {
-	if !tor.normal.text.edited {
-		m.exit()
-	}
+	m.err = ""
+	m.unsaved = tor.modifiedBuffers()
+	m.next()
 }
 
 func (m *ExitMode) End() {}
 
+// next shows the next unsaved buffer to ask.
+// It will exit tor when there is no more unsaved buffer.
+func (m *ExitMode) next() {
+	if len(m.unsaved) == 0 {
+		m.exit()
+		return
+	}
+	tor.SwitchBuffer(m.unsaved[0])
+}
+
 func (m *ExitMode) Handle(ev *tcell.EventKey) {
+	m.err = ""
 	if ev.Rune() == 'y' {
-		m.exit()
+		m.unsaved = m.unsaved[1:]
+		m.next()
+	} else if ev.Rune() == 's' {
+		// save it as the save command, so it's formatted before and after save.
+		// next switched to the buffer, so it's the normal mode's buffer.
+		n := tor.normal
+		n.err = ""
+		n.handleActions([]*Action{{kind: "save"}})
+		if n.err != "" {
+			m.err = n.err
+			return
+		}
+		m.unsaved = m.unsaved[1:]
+		m.next()
 	} else if ev.Rune() == 'n' || ev.Key() == tcell.KeyEsc || ev.Key() == tcell.KeyCtrlK {
 		tor.ChangeMode(tor.normal)
 	}
 }
 
 func (m *ExitMode) Status() string {
-	return "Buffer modified. Do you really want to quit? (y/n)"
+	if len(m.unsaved) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%v modified. Do you really want to quit without saving? (y/n/s(ave)) [%v left]", m.unsaved[0].f, len(m.unsaved))
 }
 
 func (m *ExitMode) Error() string {
-	return ""
+	return m.err
 }
@@ -6,8 +6,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
-	"strings"
 	"unicode/utf8"
 
 	"github.com/kybin/tor/syntax"
@@ -83,12 +81,13 @@ func create(f string) (*Text, error) {
 	if !writable {
 		return nil, errors.New("could not create the file. please check the directory permission.")
 	}
-	ext := filepath.Ext(f)
-	if ext != "" {
-		ext = strings.TrimPrefix(ext, ".")
-	}
-	lang := syntax.NewLanguage(ext)
-	return &Text{lines: []Line{{""}}, tabToSpace: lang.TabToSpace, tabWidth: lang.TabWidth, writable: writable, lineEnding: "\n"}, nil
+	lang := syntax.DetectLanguage(f, "")
+	text := NewText([]string{""})
+	text.tabToSpace = lang.TabToSpace
+	text.tabWidth = lang.TabWidth
+	text.writable = writable
+	text.lineEnding = "\n"
+	return text, nil
 }
 
 // read reads a file and returns it as *Text.
@@ -108,7 +107,7 @@ func read(f string) (*Text, error) {
 	// aggregate the text info.
 	// tor uses tab (4 space) for indentation.
 	// but when parse an exist file, follow the file's rule.
-	lines := make([]Line, 0)
+	lines := make([]string, 0)
 	tabToSpace := false
 	tabWidth := 4
 
@@ -136,7 +135,7 @@ func read(f string) (*Text, error) {
 				}
 			}
 		}
-		lines = append(lines, Line{t})
+		lines = append(lines, t)
 	}
 	if err := scanner.Err(); err != nil {
 		return nil, err
@@ -159,10 +158,15 @@ func read(f string) (*Text, error) {
 	// `touch` cmd creates a file with no content.
 	// avoid program panic from empty text.
 	if len(lines) == 0 {
-		lines = []Line{{""}}
+		lines = []string{""}
 	}
 
-	return &Text{lines: lines, tabToSpace: tabToSpace, tabWidth: tabWidth, writable: writable, lineEnding: lineEnding}, nil
+	text := NewText(lines)
+	text.tabToSpace = tabToSpace
+	text.tabWidth = tabWidth
+	text.writable = writable
+	text.lineEnding = lineEnding
+	return text, nil
 }
 
 // save saves Text to a file.
@@ -172,8 +176,8 @@ func save(f string, t *Text) error {
 		return err
 	}
 	defer file.Close()
-	for _, line := range t.lines {
-		file.WriteString(line.data)
+	for l := 0; l < t.NumLines(); l++ {
+		file.WriteString(t.LineData(l))
 		file.WriteString(t.lineEnding)
 	}
 	return nil
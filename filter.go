@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// filterTimeout is how long a filter command could run.
+const filterTimeout = 10 * time.Second
+
+// runFilter runs commands of g as filters with s as input, and returns the output.
+// Commands get s with a newline at the end, as lines of a file,
+// and the newline is removed from the output when s doesn't have it.
+func runFilter(g cmdGroup, s string) (string, error) {
+	in := s
+	if !strings.HasSuffix(s, "\n") {
+		in += "\n"
+	}
+	out, err := g.Filter([]byte(in))
+	if err != nil {
+		return string(out), err
+	}
+	o := strings.ReplaceAll(string(out), "\r\n", "\n")
+	if !strings.HasSuffix(s, "\n") {
+		o = strings.TrimSuffix(o, "\n")
+	}
+	return o, nil
+}
+
+// filter pipes the selection, or whole text if nothing is selected, through shell command c,
+// and replaces it with the output. Only changed lines are edited, so it could be undone.
+func (m *NormalMode) filter(c string) {
+	if m.selection.on && m.selection.block {
+		m.err = "cannot filter a block selection"
+		return
+	}
+	old := string(m.text.Bytes())
+	start, end := 0, len(old)
+	if m.selection.on {
+		min, max := m.selection.MinMax()
+		start, end = byteOffset(old, min), byteOffset(old, max)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), filterTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", c)
+	if abspath, err := filepath.Abs(m.f); err == nil {
+		cmd.Dir = filepath.Dir(abspath)
+	}
+	out, err := runFilter(cmdGroup{kind: orCmdGroup, cmds: []*exec.Cmd{cmd}}, old[start:end])
+	if err != nil {
+		m.formatFailed(commandError(ctx, "filter", err, []byte(out)))
+		return
+	}
+	m.replaceText(old[:start] + out + old[end:])
+}
+
+// FilterMode is a prompt for a shell command, that filters the selection or whole text.
+type FilterMode struct {
+	cmd string
+	// last is the last command, that is shown when the prompt starts again.
+	last string
+}
+
+func (m *FilterMode) Start() {
+	m.cmd = m.last
+}
+
+func (m *FilterMode) End() {}
+
+func (m *FilterMode) Handle(ev *tcell.EventKey) {
+	switch ev.Key() {
+	case tcell.KeyEsc, tcell.KeyCtrlK:
+		tor.ChangeMode(tor.normal)
+	case tcell.KeyEnter:
+		n := tor.normal
+		tor.ChangeMode(n)
+		if strings.TrimSpace(m.cmd) == "" {
+			return
+		}
+		m.last = m.cmd
+		n.status = ""
+		n.err = ""
+		n.handleActions([]*Action{{kind: "filter", value: m.cmd}})
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if m.cmd == "" {
+			return
+		}
+		_, rlen := utf8.DecodeLastRuneInString(m.cmd)
+		m.cmd = m.cmd[:len(m.cmd)-rlen]
+	case tcell.KeyRune:
+		m.cmd += string(ev.Rune())
+	}
+}
+
+func (m *FilterMode) Status() string {
+	what := "buffer"
+	if tor.normal.selection.on {
+		what = "selection"
+	}
+	return fmt.Sprintf("filter %v through : %v", what, m.cmd)
+}
+
+func (m *FilterMode) Error() string {
+	return ""
+}
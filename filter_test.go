@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kybin/tor/cell"
+)
+
+func TestFilter(t *testing.T) {
+	b := NewBuffer("a.txt", NewText([]string{"head", "c", "a", "b", "tail"}))
+	b.text.writable = true
+	setTestTor(t, 80, 24, b)
+	m := tor.normal
+	m.keymap = NewKeymap()
+	text := func() string {
+		return strings.Join(textLines(m.text), "\n")
+	}
+
+	// the selected lines are sorted, and the selection stays on them.
+	selectRange(m, cell.Pt{1, 0}, cell.Pt{4, 0})
+	m.handleActions([]*Action{{kind: "filter", value: "sort"}})
+	if got, want := text(), "head\na\nb\nc\ntail"; got != want {
+		t.Fatalf("sort: got %q, want %q", got, want)
+	}
+	if min, max := m.selection.MinMax(); min != (cell.Pt{1, 0}) || max != (cell.Pt{4, 0}) {
+		t.Fatalf("sort: got selection %v-%v, want {1 0}-{4 0}", min, max)
+	}
+	// only changed lines are edited.
+	for _, e := range m.history.Last()[0].edits {
+		if s := fmt.Sprint(e); strings.Contains(s, "head") || strings.Contains(s, "tail") {
+			t.Fatalf("sort: got edit %v of an unchanged line", e)
+		}
+	}
+
+	// whole text is filtered without a selection, and the cursor stays at the line.
+	m.selection.on = false
+	m.cursor.SetBytePos(cell.Pt{4, 2})
+	m.handleActions([]*Action{{kind: "filter", value: "sed 's/^head$/top/'"}})
+	if got, want := text(), "top\na\nb\nc\ntail"; got != want {
+		t.Fatalf("sed: got %q, want %q", got, want)
+	}
+	if got := m.cursor.BytePos(); got != (cell.Pt{4, 2}) {
+		t.Fatalf("sed: got cursor at %v, want {4 2}", got)
+	}
+	m.handleActions([]*Action{{kind: "undo"}})
+	m.handleActions([]*Action{{kind: "undo"}})
+	if got, want := text(), "head\nc\na\nb\ntail"; got != want {
+		t.Fatalf("undo: got %q, want %q", got, want)
+	}
+
+	m.handleActions([]*Action{{kind: "filter", value: "echo 'no such input' >&2; exit 1"}})
+	if m.err != "no such input (see [messages])" {
+		t.Fatalf("fail: got error %q", m.err)
+	}
+	if got, want := text(), "head\nc\na\nb\ntail"; got != want {
+		t.Fatalf("fail: got %q, want the text not changed", got)
+	}
+}
@@ -2,28 +2,67 @@ package main
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
 	"unicode/utf8"
 
 	"github.com/gdamore/tcell/v2"
+	"github.com/kybin/tor/cell"
 )
 
+// FindMode is a mode for typing a string to find.
+//
+// It finds the string incrementally. While typing, the cursor moves
+// to the first match from where the find mode started.
 type FindMode struct {
 	str   string
 	start bool
 	olds  []string
+
+	// options for finding.
+	regex      bool // regex treats str as a regular expression.
+	ignoreCase bool // ignoreCase finds str case insensitively.
+	wholeWord  bool // wholeWord finds str only when it is a whole word.
+
+	// re is compiled regexp of str. reKey tells from what it is compiled.
+	re    *regexp.Regexp
+	reErr error
+	reKey string
+
+	// highlight tells whether matches of str should be highlighted.
+	highlight bool
+
+	// origin and originSel are the cursor and selection
+	// when the find mode started. Esc restores them.
+	origin    Cursor
+	originSel Selection
+
+	// count is a match counter like "match 3/17".
+	count string
+
+	err string
 }
 
 func (m *FindMode) Start() {
 	nm := tor.normal
+	m.origin = *nm.cursor
+	m.originSel = *nm.selection
 	if nm.selection.on {
 		m.str = nm.text.DataInside(nm.selection.MinMax())
+		if m.regex {
+			m.str = regexp.QuoteMeta(m.str)
+		}
 	}
 	m.start = true
+	m.highlight = true
+	m.count = ""
+	m.err = ""
 }
 
 func (m *FindMode) End() {}
 
 func (m *FindMode) Handle(ev *tcell.EventKey) {
+	m.err = ""
 	switch ev.Key() {
 	case tcell.KeyEsc, tcell.KeyCtrlK:
 		if len(m.olds) == 0 {
@@ -31,8 +70,16 @@ func (m *FindMode) Handle(ev *tcell.EventKey) {
 		} else {
 			m.str = m.olds[len(m.olds)-1]
 		}
+		nm := tor.normal
+		nm.cursor.Copy(m.origin)
+		*nm.selection = m.originSel
+		m.highlight = false
 		tor.ChangeMode(tor.normal)
 	case tcell.KeyEnter:
+		if _, err := m.Regexp(); err != nil {
+			m.err = err.Error()
+			return
+		}
 		tor.ChangeMode(tor.normal)
 		m.olds = append(m.olds, m.str)
 		saveConfig("find", m.str)
@@ -44,8 +91,20 @@ func (m *FindMode) Handle(ev *tcell.EventKey) {
 		}
 		_, rlen := utf8.DecodeLastRuneInString(m.str)
 		m.str = m.str[:len(m.str)-rlen]
+		m.search()
 	default:
 		if ev.Modifiers()&tcell.ModAlt != 0 {
+			switch ev.Rune() {
+			case 'r':
+				m.regex = !m.regex
+			case 'c':
+				m.ignoreCase = !m.ignoreCase
+			case 'w':
+				m.wholeWord = !m.wholeWord
+			default:
+				return
+			}
+			m.search()
 			return
 		}
 		if ev.Rune() != 0 {
@@ -55,13 +114,205 @@ func (m *FindMode) Handle(ev *tcell.EventKey) {
 			m.str += string(ev.Rune())
 		}
 		m.start = false
+		m.search()
+	}
+}
+
+// search moves the cursor to the first match from where the find mode started,
+// and selects the match. If there is no match, the cursor stays at the origin.
+func (m *FindMode) search() {
+	nm := tor.normal
+	nm.cursor.Copy(m.origin)
+	nm.selection.on = false
+	m.count = ""
+	re, err := m.Regexp()
+	if err != nil || re == nil {
+		// regexp is not completed yet, probably.
+		return
+	}
+	c := nm.cursor
+	var n int
+	var ok bool
+	if match := matchAfter(re, c.LineData(), c.b); match != nil {
+		c.SetB(match[0])
+		n, ok = match[1]-match[0], true
+	} else {
+		n, ok = c.GotoNext(re)
+		if !ok {
+			n, ok = c.GotoFirst(re)
+		}
+	}
+	if ok {
+		nm.selection.on = true
+		nm.selection.SetStart(cell.Pt{c.l, c.b + n})
+		nm.selection.SetEnd(c.BytePos())
+	}
+	m.count = matchCounter(nm.text, re, c.BytePos())
+}
+
+// Highlight returns a regexp for highlighting matches.
+// It returns nil if there is nothing to highlight.
+func (m *FindMode) Highlight() *regexp.Regexp {
+	if !m.highlight {
+		return nil
+	}
+	re, err := m.Regexp()
+	if err != nil {
+		return nil
+	}
+	return re
+}
+
+// maxMatchCount is how many matches countMatches counts at least, before it stops counting lines after the position.
+const maxMatchCount = 1000
+
+// matchCounts caches numbers of matches of a regexp in lines of a text.
+// It is kept by the text, and lines are recounted only when they are changed.
+type matchCounts struct {
+	re string
+	// lines are numbers of matches in lines. -1 means the line is not counted yet.
+	lines []int
+}
+
+// changed marks lines [l, l+inserted) as not counted, those replaced lines [l, l+removed).
+func (c *matchCounts) changed(l, removed, inserted int) {
+	if removed != inserted {
+		lines := make([]int, 0, len(c.lines)-removed+inserted)
+		lines = append(lines, c.lines[:l]...)
+		lines = append(lines, make([]int, inserted)...)
+		c.lines = append(lines, c.lines[l+removed:]...)
+	}
+	for i := l; i < l+inserted; i++ {
+		c.lines[i] = -1
+	}
+}
+
+// matchCounts returns cached numbers of matches of re in lines of the text.
+func (t *Text) matchCounts(re *regexp.Regexp) *matchCounts {
+	if t.matches == nil || t.matches.re != re.String() {
+		t.matches = &matchCounts{re: re.String(), lines: make([]int, t.NumLines())}
+		for i := range t.matches.lines {
+			t.matches.lines[i] = -1
+		}
+	}
+	return t.matches
+}
+
+// countMatches counts non-empty matches of re in text.
+// Overlapping matches are counted, as find next stops at each of them.
+// It also returns 1 based index of the match that starts at pos,
+// or 0 if no match starts at pos.
+//
+// To not count whole of a long text at every key typed, it stops counting lines after pos
+// when it counted maxMatchCount matches. Then more is true, and total is the counted ones.
+func countMatches(text *Text, re *regexp.Regexp, pos cell.Pt) (idx, total int, more bool) {
+	c := text.matchCounts(re)
+	for l, n := range c.lines {
+		if l == pos.L {
+			n = 0
+			eachMatch(re, text.LineData(l), 0, func(m []int) bool {
+				n++
+				if m[0] == pos.O {
+					idx = total + n
+				}
+				return true
+			})
+			c.lines[l] = n
+		} else if n < 0 {
+			if total >= maxMatchCount && l > pos.L {
+				more = true
+				continue
+			}
+			n = 0
+			eachMatch(re, text.LineData(l), 0, func(m []int) bool {
+				n++
+				return true
+			})
+			c.lines[l] = n
+		}
+		total += n
+	}
+	return idx, total, more
+}
+
+// matchCounter returns a match counter string like "match 3/17", or "match 3/1000+" when not all matches are counted.
+func matchCounter(text *Text, re *regexp.Regexp, pos cell.Pt) string {
+	idx, total, more := countMatches(text, re, pos)
+	if more {
+		return fmt.Sprintf("match %v/%v+", idx, total)
+	}
+	return fmt.Sprintf("match %v/%v", idx, total)
+}
+
+// Regexp returns a regular expression for finding str with the options.
+// It returns nil without error when str is empty.
+func (m *FindMode) Regexp() (*regexp.Regexp, error) {
+	if m.str == "" {
+		return nil, nil
+	}
+	key := fmt.Sprintf("%t %t %t %s", m.regex, m.ignoreCase, m.wholeWord, m.str)
+	if key != m.reKey {
+		m.re, m.reErr = findRegexp(m.str, m.regex, m.ignoreCase, m.wholeWord)
+		m.reKey = key
+	}
+	return m.re, m.reErr
+}
+
+// findRegexp compiles a regular expression for finding str.
+// When regex is false, str is treated as a literal string.
+func findRegexp(str string, regex, ignoreCase, wholeWord bool) (*regexp.Regexp, error) {
+	pattern := str
+	if !regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if wholeWord {
+		pattern = `\b(?:` + pattern + `)\b`
+	}
+	if ignoreCase {
+		pattern = `(?i)` + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regexp: %v", err)
+	}
+	return re, nil
+}
+
+// WordRegexp returns a regular expression for finding str as a whole word, with the other options.
+// It returns nil without error when str is empty.
+func (m *FindMode) WordRegexp() (*regexp.Regexp, error) {
+	if m.wholeWord || m.str == "" {
+		return m.Regexp()
 	}
+	return findRegexp(m.str, m.regex, m.ignoreCase, true)
+}
+
+// options returns enabled find options as string.
+func (m *FindMode) options() string {
+	opts := make([]string, 0)
+	if m.regex {
+		opts = append(opts, "regex")
+	}
+	if m.ignoreCase {
+		opts = append(opts, "ignore case")
+	}
+	if m.wholeWord {
+		opts = append(opts, "whole word")
+	}
+	if len(opts) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(opts, ", ") + "] "
 }
 
 func (m *FindMode) Status() string {
-	return fmt.Sprintf("find : %v", m.str)
+	count := ""
+	if m.count != "" {
+		count = m.count + " "
+	}
+	return fmt.Sprintf("find %v%v: %v", m.options(), count, m.str)
 }
 
 func (m *FindMode) Error() string {
-	return ""
+	return m.err
 }
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/kybin/tor/cell"
+)
+
+func TestFindRegexp(t *testing.T) {
+	cases := []struct {
+		str        string
+		regex      bool
+		ignoreCase bool
+		wholeWord  bool
+		line       string
+		want       string
+	}{
+		{
+			str:  "a.b",
+			line: "axb a.b",
+			want: "a.b",
+		},
+		{
+			str:   "a.b",
+			regex: true,
+			line:  "axb a.b",
+			want:  "axb",
+		},
+		{
+			str:        "hello",
+			ignoreCase: true,
+			line:       "say HeLLo",
+			want:       "HeLLo",
+		},
+		{
+			str:       "id",
+			wholeWord: true,
+			line:      "width := id",
+			want:      "id",
+		},
+		{
+			str:        `func \w+Handler`,
+			regex:      true,
+			ignoreCase: true,
+			wholeWord:  true,
+			line:       "FUNC myHandler()",
+			want:       "FUNC myHandler",
+		},
+	}
+	for _, c := range cases {
+		re, err := findRegexp(c.str, c.regex, c.ignoreCase, c.wholeWord)
+		if err != nil {
+			t.Fatalf("findRegexp(%q): %v", c.str, err)
+		}
+		got := re.FindString(c.line)
+		if got != c.want {
+			t.Fatalf("findRegexp(%q, %v, %v, %v) on %q: got %q, want %q", c.str, c.regex, c.ignoreCase, c.wholeWord, c.line, got, c.want)
+		}
+	}
+	if _, err := findRegexp("TODO(", true, false, false); err == nil {
+		t.Fatalf("findRegexp should fail for invalid regexp")
+	}
+}
+
+func TestCountMatches(t *testing.T) {
+	text := NewText([]string{
+		"tor is a text editor",
+		"",
+		"tor tor",
+	})
+	re := regexp.MustCompile("tor")
+	cases := []struct {
+		pos       cell.Pt
+		wantIdx   int
+		wantTotal int
+	}{
+		{pos: cell.Pt{0, 0}, wantIdx: 1, wantTotal: 4},
+		{pos: cell.Pt{0, 17}, wantIdx: 2, wantTotal: 4},
+		{pos: cell.Pt{2, 4}, wantIdx: 4, wantTotal: 4},
+		{pos: cell.Pt{1, 0}, wantIdx: 0, wantTotal: 4},
+	}
+	for _, c := range cases {
+		idx, total, _ := countMatches(text, re, c.pos)
+		if idx != c.wantIdx || total != c.wantTotal {
+			t.Fatalf("countMatches(%v): got %v/%v, want %v/%v", c.pos, idx, total, c.wantIdx, c.wantTotal)
+		}
+	}
+	// overlapping matches are counted.
+	if idx, total, _ := countMatches(NewText([]string{"aaa"}), regexp.MustCompile("aa"), cell.Pt{0, 1}); idx != 2 || total != 2 {
+		t.Fatalf("countMatches(overlapping): got %v/%v, want 2/2", idx, total)
+	}
+}
+
+func TestCountMatchesCache(t *testing.T) {
+	text := NewText([]string{"a b", "b", "a"})
+	re := regexp.MustCompile("a")
+	if _, total, _ := countMatches(text, re, cell.Pt{}); total != 2 {
+		t.Fatalf("countMatches: got %v, want 2", total)
+	}
+	// changed lines are recounted.
+	text.Insert("a\na", 1, 0)
+	if idx, total, _ := countMatches(text, re, cell.Pt{2, 0}); idx != 3 || total != 4 {
+		t.Fatalf("countMatches after insert: got %v/%v, want 3/4", idx, total)
+	}
+	text.RemoveLine(0)
+	if idx, total, _ := countMatches(text, re, cell.Pt{1, 0}); idx != 2 || total != 3 {
+		t.Fatalf("countMatches after remove: got %v/%v, want 2/3", idx, total)
+	}
+
+	// it stops counting after the position, when there are many matches.
+	lines := make([]string, maxMatchCount*2)
+	for i := range lines {
+		lines[i] = "a"
+	}
+	text = NewText(lines)
+	if got, want := matchCounter(text, re, cell.Pt{2, 0}), fmt.Sprintf("match 3/%v+", maxMatchCount); got != want {
+		t.Fatalf("matchCounter: got %q, want %q", got, want)
+	}
+	if got, want := matchCounter(text, re, cell.Pt{len(lines) - 1, 0}), fmt.Sprintf("match %v/%v", len(lines), len(lines)); got != want {
+		t.Fatalf("matchCounter at the end: got %q, want %q", got, want)
+	}
+}
+
+func TestFindWordMove(t *testing.T) {
+	b := NewBuffer("a.txt", NewText([]string{"Foo foobar", "x FOO foo"}))
+	setTestTor(t, 80, 24, b)
+	m := tor.normal
+	tor.find = &FindMode{str: "foo", ignoreCase: true}
+
+	// "foobar" is not a whole word, and cases are ignored.
+	m.do(&Action{kind: "move", value: "findNextWord"})
+	if got := m.cursor.BytePos(); got != (cell.Pt{1, 2}) {
+		t.Fatalf("findNextWord: got %v, want {1 2}", got)
+	}
+	m.do(&Action{kind: "move", value: "findNextWord"})
+	if got := m.cursor.BytePos(); got != (cell.Pt{1, 6}) {
+		t.Fatalf("findNextWord: got %v, want {1 6}", got)
+	}
+	m.do(&Action{kind: "move", value: "findNextWord"})
+	if got := m.cursor.BytePos(); got != (cell.Pt{1, 6}) || m.err != "not found: foo" {
+		t.Fatalf("findNextWord at the last: got %v, %q", got, m.err)
+	}
+
+	tor.find = &FindMode{str: "f.o", regex: true}
+	m.err = ""
+	// "foo" at the cursor is not before the cursor, and "FOO" differs in case.
+	m.do(&Action{kind: "move", value: "findPrevWord"})
+	if got := m.cursor.BytePos(); got != (cell.Pt{1, 6}) || m.err != "not found: f.o" {
+		t.Fatalf("findPrevWord: got %v, %q", got, m.err)
+	}
+	m.cursor.SetBytePos(cell.Pt{1, 9})
+	m.do(&Action{kind: "move", value: "findPrevWord"})
+	if got := m.cursor.BytePos(); got != (cell.Pt{1, 6}) {
+		t.Fatalf("findPrevWord: got %v, want {1 6}", got)
+	}
+}
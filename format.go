@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kybin/tor/cell"
+)
+
+// formatFile is a config file that sets formatters of languages.
+const formatFile = "format.json"
+
+// defaultFormatTimeout is how long formatter commands could run, when a formatter doesn't set it's timeout.
+const defaultFormatTimeout = 10 * time.Second
+
+// messagesBuffer is the name of the buffer that shows outputs of failed formatters.
+const messagesBuffer = "[messages]"
+
+// formatter formats files of a language, or files those match a glob pattern, when they are saved.
+//
+// Pre commands filter the text through stdin and stdout before it is saved, without touching the file.
+// Post commands run after the file is saved, and the text is reloaded from the file.
+// In a command, "{file}" is replaced with absolute path of the file.
+//
+// Kind is "or" to run the first command that exists, or "and" to run all of them in order.
+// Pre commands of "and" kind are piped, so output of a command is input of the next one.
+// Timeout is in seconds, for each of pre and post commands.
+type formatter struct {
+	Match   string     `json:"match"`
+	Kind    string     `json:"kind,omitempty"`
+	Pre     [][]string `json:"pre,omitempty"`
+	Post    [][]string `json:"post,omitempty"`
+	Timeout float64    `json:"timeout,omitempty"`
+}
+
+// defaultFormatters are formatters those are used after formatters in formatFile.
+var defaultFormatters = []formatter{
+	{Match: "go", Kind: "or", Post: [][]string{{"goimports", "-w", "{file}"}, {"go", "fmt", "{file}"}}},
+}
+
+// matches checks the formatter is for file f of language lang.
+// Match is a language name, or a glob pattern of file names like "*.py".
+func (ft formatter) matches(f, lang string) bool {
+	if ft.Match == lang {
+		return true
+	}
+	ok, _ := path.Match(ft.Match, filepath.Base(f))
+	return ok
+}
+
+// validate returns an error if the formatter is not valid.
+func (ft formatter) validate() error {
+	if ft.Match == "" {
+		return fmt.Errorf("formatter without match")
+	}
+	if _, err := path.Match(ft.Match, ""); err != nil {
+		return fmt.Errorf("invalid match %q: %v", ft.Match, err)
+	}
+	if ft.Kind != "" && ft.Kind != "or" && ft.Kind != "and" {
+		return fmt.Errorf("%v: kind should be \"or\" or \"and\": %v", ft.Match, ft.Kind)
+	}
+	for _, c := range append(append([][]string{}, ft.Pre...), ft.Post...) {
+		if len(c) == 0 || c[0] == "" {
+			return fmt.Errorf("%v: empty command", ft.Match)
+		}
+	}
+	if ft.Timeout < 0 {
+		return fmt.Errorf("%v: negative timeout", ft.Match)
+	}
+	return nil
+}
+
+// cmdGroup makes a command group of cmds, those run in the file's directory.
+// The commands are killed when ctx is done.
+func (ft formatter) cmdGroup(ctx context.Context, cmds [][]string, f string) cmdGroup {
+	abspath, err := filepath.Abs(f)
+	if err != nil {
+		abspath = f
+	}
+	g := cmdGroup{kind: orCmdGroup}
+	if ft.Kind == "and" {
+		g.kind = andCmdGroup
+	}
+	for _, c := range cmds {
+		args := make([]string, len(c))
+		for i, a := range c {
+			args[i] = strings.ReplaceAll(a, "{file}", abspath)
+		}
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Dir = filepath.Dir(abspath)
+		g.cmds = append(g.cmds, cmd)
+	}
+	return g
+}
+
+// timeout returns how long commands of the formatter could run.
+func (ft formatter) timeout() time.Duration {
+	if ft.Timeout == 0 {
+		return defaultFormatTimeout
+	}
+	return time.Duration(ft.Timeout * float64(time.Second))
+}
+
+// formatError is an error of formatter commands, with their whole output.
+type formatError struct {
+	err error
+	out string
+}
+
+func (e *formatError) Error() string {
+	return e.err.Error()
+}
+
+// runPre runs pre commands of the formatter with s as input, and returns the formatted string.
+func (ft formatter) runPre(s, f string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ft.timeout())
+	defer cancel()
+	out, err := runFilter(ft.cmdGroup(ctx, ft.Pre, f), s)
+	if err != nil {
+		return "", commandError(ctx, "formatter", err, []byte(out))
+	}
+	return out, nil
+}
+
+// runPost runs post commands of the formatter for the file.
+func (ft formatter) runPost(f string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ft.timeout())
+	defer cancel()
+	out, err := ft.cmdGroup(ctx, ft.Post, f).CombinedOutput()
+	if err != nil {
+		return commandError(ctx, "formatter", err, out)
+	}
+	return nil
+}
+
+// commandError makes a formatError from an error of commands and their output.
+// The error is the first line of the output, if there is. name is what the commands are, like "formatter".
+func commandError(ctx context.Context, name string, err error, out []byte) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("%v timed out", name)
+	} else if line := strings.SplitN(strings.TrimSpace(string(out)), "\n", 2)[0]; line != "" {
+		err = fmt.Errorf("%v", line)
+	}
+	return &formatError{err: err, out: string(out)}
+}
+
+// findFormatter returns the first formatter for file f of language lang, or nil if there isn't.
+func findFormatter(formatters []formatter, f, lang string) *formatter {
+	for i := range formatters {
+		if formatters[i].matches(f, lang) {
+			return &formatters[i]
+		}
+	}
+	return nil
+}
+
+// loadFormatters loads formatters from formatFile, followed by defaultFormatters.
+// Invalid formatters are skipped, and returned as errors.
+func loadFormatters() ([]formatter, []error) {
+	data := loadConfig(formatFile)
+	if data == "" {
+		return defaultFormatters, nil
+	}
+	var fts []formatter
+	if err := json.Unmarshal([]byte(data), &fts); err != nil {
+		return defaultFormatters, []error{fmt.Errorf("%v: %v", path.Join(configDir, formatFile), err)}
+	}
+	formatters := make([]formatter, 0, len(fts)+len(defaultFormatters))
+	errs := make([]error, 0)
+	for _, ft := range fts {
+		if err := ft.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%v: %v", path.Join(configDir, formatFile), err))
+			continue
+		}
+		formatters = append(formatters, ft)
+	}
+	return append(formatters, defaultFormatters...), errs
+}
+
+// byteOffset returns offset of p in s, those lines are separated by "\n".
+func byteOffset(s string, p cell.Pt) int {
+	o := 0
+	for l := 0; l < p.L; l++ {
+		i := strings.IndexByte(s[o:], '\n')
+		if i < 0 {
+			return len(s)
+		}
+		o += i + 1
+	}
+	if o+p.O > len(s) {
+		return len(s)
+	}
+	return o + p.O
+}
+
+// bytePt returns line and byte offset of offset o in s.
+func bytePt(s string, o int) cell.Pt {
+	l := strings.Count(s[:o], "\n")
+	return cell.Pt{l, o - (strings.LastIndex(s[:o], "\n") + 1)}
+}
+
+// formattedPos returns where offset o of old is in new, that is formatted from old.
+// Formatters mostly change spaces, so the offset is found by counting non-space runes
+// from the start of the changed part to o. Outside of the changed part, it is not moved.
+func formattedPos(old, new string, o int) int {
+	p := 0
+	for p < len(old) && p < len(new) && old[p] == new[p] {
+		p++
+	}
+	s := 0
+	for s < len(old)-p && s < len(new)-p && old[len(old)-1-s] == new[len(new)-1-s] {
+		s++
+	}
+	if o < p {
+		return o
+	}
+	if o >= len(old)-s {
+		return o - len(old) + len(new)
+	}
+	n := 0
+	for _, r := range old[p:o] {
+		if !unicode.IsSpace(r) {
+			n++
+		}
+	}
+	i := p
+	for n > 0 && i < len(new)-s {
+		r, size := utf8.DecodeRuneInString(new[i:])
+		if !unicode.IsSpace(r) {
+			n--
+		}
+		i += size
+	}
+	// when the cursor was at a rune not a space, it goes to the rune after spaces those are added.
+	if r, _ := utf8.DecodeRuneInString(old[o:]); !unicode.IsSpace(r) {
+		for i < len(new) {
+			r, size := utf8.DecodeRuneInString(new[i:])
+			if !unicode.IsSpace(r) {
+				break
+			}
+			i += size
+		}
+	}
+	return i
+}
+
+// format replaces the text with s, that is formatted from the text.
+// Only changed lines are edited, so it could be undone,
+// and the cursors stay at the same content, not at the same line.
+func (m *NormalMode) format(s string) {
+	m.replaceText(s)
+}
+
+// formatFailed shows an error of a formatter.
+// Whole output of the formatter is shown in the messages buffer.
+func (m *NormalMode) formatFailed(err error) {
+	m.err = err.Error()
+	if fe, ok := err.(*formatError); ok && strings.TrimSpace(fe.out) != "" && tor != nil {
+		tor.showMessages(fe.out)
+		m.err += fmt.Sprintf(" (see %v)", messagesBuffer)
+	}
+}
+
+// showMessages shows s in the messages buffer.
+// The buffer is added to the buffers, when it isn't there.
+func (t *Tor) showMessages(s string) {
+	var b *Buffer
+	for _, buf := range t.buffers {
+		if buf.message {
+			b = buf
+		}
+	}
+	if b == nil {
+		b = NewBuffer(messagesBuffer, NewText([]string{""}))
+		b.message = true
+		t.buffers = append(t.buffers, b)
+	}
+	for _, e := range replaceEdits(string(b.text.Bytes()), strings.TrimRight(s, "\n")) {
+		b.text.Apply(e)
+	}
+	b.cursor.SetBytePos(cell.Pt{0, 0})
+	b.clearModified()
+}
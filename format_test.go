@@ -0,0 +1,184 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/kybin/tor/cell"
+)
+
+func TestFormattedPos(t *testing.T) {
+	old := "package a\nfunc f(){\n\tx:=1\n}\n"
+	new := "package a\n\nfunc f() {\n\tx := 1\n}\n"
+	cases := []struct {
+		o    int
+		want int
+	}{
+		// in the common prefix.
+		{3, 3},
+		// before "1".
+		{strings.Index(old, "1"), strings.Index(new, "1")},
+		// before "{".
+		{strings.Index(old, "{"), strings.Index(new, "{")},
+		// in the common suffix.
+		{len(old) - 1, len(new) - 1},
+	}
+	for _, c := range cases {
+		if got := formattedPos(old, new, c.o); got != c.want {
+			t.Fatalf("formattedPos(%v): got %v, want %v", c.o, got, c.want)
+		}
+	}
+	// the changed part starts at the cursor, and a space is added before the rune at the cursor.
+	if got := formattedPos("f(){", "f() {", 3); got != 4 {
+		t.Fatalf("formattedPos at the start of the change: got %v, want 4", got)
+	}
+}
+
+func TestFindFormatter(t *testing.T) {
+	formatters := []formatter{{Match: "*_test.go"}, {Match: "go"}, {Match: "Makefile"}}
+	cases := []struct {
+		f    string
+		lang string
+		want int
+	}{
+		{"a/b_test.go", "go", 0},
+		{"a/b.go", "go", 1},
+		{"a/Makefile", "make", 2},
+		{"a/b.py", "python", -1},
+	}
+	for _, c := range cases {
+		got := findFormatter(formatters, c.f, c.lang)
+		if (c.want < 0 && got != nil) || (c.want >= 0 && got != &formatters[c.want]) {
+			t.Fatalf("findFormatter(%q, %q): got %v, want #%v", c.f, c.lang, got, c.want)
+		}
+	}
+}
+
+// writeScripts writes shell scripts to a temporary directory, and adds it to PATH.
+func writeScripts(t *testing.T, scripts map[string]string) {
+	dir := t.TempDir()
+	for name, script := range scripts {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setEnv(t, "PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestSaveFormatters(t *testing.T) {
+	writeScripts(t, map[string]string{
+		"upper":     "tr a-z A-Z",
+		"squeeze":   "tr -s ' '",
+		"lowerfile": `tr A-Z a-z < "$1" > "$1.tmp" && mv "$1.tmp" "$1"`,
+		"fail":      "echo 'bad input at 1:1' >&2; echo 'more details' >&2; exit 1",
+		"slow":      "exec sleep 5",
+	})
+	f := filepath.Join(t.TempDir(), "a.txt")
+	if err := ioutil.WriteFile(f, []byte("ab  cd\nef\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	text, err := read(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text.writable = true
+	b := NewBuffer(f, text)
+	setTestTor(t, 80, 24, b)
+	m := tor.normal
+	m.keymap = NewKeymap()
+	save := func(ft formatter) {
+		m.formatters = []formatter{ft}
+		m.handleActions([]*Action{{kind: "save"}})
+	}
+	saved := func() string {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// the missing command is skipped, and the output of upper is piped to squeeze.
+	m.cursor.SetBytePos(cell.Pt{0, 4})
+	save(formatter{Match: "*.txt", Kind: "and", Pre: [][]string{{"upper"}, {"squeeze"}}})
+	if got := saved(); got != "AB CD\nEF\n" {
+		t.Fatalf("pre: got %q saved", got)
+	}
+	// the cursor stays before "cd".
+	if got := m.cursor.BytePos(); got != (cell.Pt{0, 3}) {
+		t.Fatalf("pre: got cursor at %v, want {0 3}", got)
+	}
+
+	save(formatter{Match: "*.txt", Kind: "or", Post: [][]string{{"not-a-formatter"}, {"lowerfile", "{file}"}}})
+	if got := strings.Join(textLines(m.text), "\n"); got != "ab cd\nef" {
+		t.Fatalf("post: got %q, want it reloaded from the file", got)
+	}
+	m.handleActions([]*Action{{kind: "undo"}})
+	if got := strings.Join(textLines(m.text), "\n"); got != "AB CD\nEF" {
+		t.Fatalf("undo: got %q, want the text before formatting", got)
+	}
+
+	save(formatter{Match: "*.txt", Pre: [][]string{{"fail"}}})
+	if m.err != "bad input at 1:1 (see [messages])" {
+		t.Fatalf("fail: got error %q", m.err)
+	}
+	msgs := tor.buffers[len(tor.buffers)-1]
+	if !msgs.message || strings.Join(textLines(msgs.text), "\n") != "bad input at 1:1\nmore details" {
+		t.Fatalf("fail: got messages %q", textLines(msgs.text))
+	}
+	// it is saved without formatting.
+	if got := saved(); got != "AB CD\nEF\n" {
+		t.Fatalf("fail: got %q saved", got)
+	}
+
+	save(formatter{Match: "*.txt", Post: [][]string{{"slow"}}, Timeout: 0.1})
+	if m.err != "formatter timed out" {
+		t.Fatalf("slow: got error %q", m.err)
+	}
+}
+
+func TestExitSaveFormatters(t *testing.T) {
+	writeScripts(t, map[string]string{
+		"upper": "tr a-z A-Z",
+		"fail":  "echo 'bad input' >&2; exit 1",
+	})
+	f := filepath.Join(t.TempDir(), "a.txt")
+	text := NewText([]string{"ab"})
+	text.writable = true
+	text.edited = true
+	b := NewBuffer(f, text)
+	setTestTor(t, 80, 24, b)
+	tor.normal.keymap = NewKeymap()
+	exited := false
+	m := &ExitMode{exit: func() { exited = true }}
+	tor.current = m
+	s := tcell.NewEventKey(tcell.KeyRune, 's', tcell.ModNone)
+
+	// it stays when the save fails, and shows the error.
+	tor.normal.formatters = []formatter{{Match: "*.txt", Post: [][]string{{"fail"}}}}
+	m.Start()
+	m.Handle(s)
+	if exited || m.err != "bad input (see [messages])" {
+		t.Fatalf("fail: got exited %v, error %q", exited, m.err)
+	}
+
+	// it saves as the save command, with formatters.
+	b.text.edited = true
+	tor.normal.formatters = []formatter{{Match: "*.txt", Pre: [][]string{{"upper"}}}}
+	m.Start()
+	m.Handle(s)
+	if !exited || m.err != "" {
+		t.Fatalf("save: got exited %v, error %q", exited, m.err)
+	}
+	data, err := ioutil.ReadFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "AB" {
+		t.Fatalf("save: got %q saved", got)
+	}
+}
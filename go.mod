@@ -1,6 +1,6 @@
 module github.com/kybin/tor
 
-go 1.12
+go 1.16
 
 require (
 	github.com/gdamore/tcell/v2 v2.0.0
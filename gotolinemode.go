@@ -10,8 +10,6 @@ import (
 
 type GotoLineMode struct {
 	linestr string
-
-	cursor *Cursor
 }
 
 func (m *GotoLineMode) Start() {}
@@ -38,7 +36,7 @@ func (m *GotoLineMode) Handle(ev *tcell.EventKey) {
 		if n != 0 {
 			n--
 		}
-		m.cursor.GotoLine(n)
+		tor.normal.cursor.GotoLine(n)
 		m.linestr = ""
 		tor.ChangeMode(tor.normal)
 	case tcell.KeyBackspace, tcell.KeyBackspace2:
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// Line number modes of the gutter.
+const (
+	lineNumbersOff      = "off"
+	lineNumbersAbsolute = "absolute"
+	lineNumbersRelative = "relative"
+)
+
+// lineNumbersModes are line number modes in toggling order.
+var lineNumbersModes = []string{lineNumbersOff, lineNumbersAbsolute, lineNumbersRelative}
+
+// lineNumbersConfig is a config file that remembers the line number mode.
+const lineNumbersConfig = "lineNumbers"
+
+// loadLineNumbers loads the line number mode from config directory.
+// It returns lineNumbersOff when it is not saved or invalid.
+func loadLineNumbers() string {
+	mode := loadConfig(lineNumbersConfig)
+	for _, m := range lineNumbersModes {
+		if mode == m {
+			return mode
+		}
+	}
+	return lineNumbersOff
+}
+
+// nextLineNumbers returns the line number mode after mode, in toggling order.
+func nextLineNumbers(mode string) string {
+	for i, m := range lineNumbersModes {
+		if mode == m {
+			return lineNumbersModes[(i+1)%len(lineNumbersModes)]
+		}
+	}
+	return lineNumbersOff
+}
+
+// gutterWidth returns width of the gutter for a text that has n lines.
+// A gutter has a marker, the line number and a space to the text.
+// It returns 0 when line numbers are off.
+func gutterWidth(mode string, n int) int {
+	if mode == lineNumbersOff {
+		return 0
+	}
+	return 1 + len(strconv.Itoa(n)) + 1
+}
+
+// gutterNumber returns a line number for line l to show in the gutter, as width w.
+// In relative mode, it shows a distance from the cursor line cl,
+// except the cursor line itself shows it's line number.
+func gutterNumber(mode string, l, cl, w int) string {
+	n := l + 1
+	if mode == lineNumbersRelative && l != cl {
+		n = l - cl
+		if n < 0 {
+			n = -n
+		}
+	}
+	s := strconv.Itoa(n)
+	for len(s) < w {
+		s = " " + s
+	}
+	return s
+}
+
+// marker is a mark of a line in the gutter.
+// When a line has multiple markers, the one that is defined later is shown.
+type marker int
+
+const (
+	noMarker = marker(iota)
+	modifiedMarker
+	searchMarker
+)
+
+// markerRunes are runes that represent markers.
+var markerRunes = map[marker]rune{
+	noMarker:       ' ',
+	modifiedMarker: '+',
+	searchMarker:   '*',
+}
+
+// lineMarker returns a marker of line l.
+// A line has searchMarker when hl is not nil and the line has a match of it.
+func (b *Buffer) lineMarker(l int, hl *regexp.Regexp) marker {
+	if hl != nil && hl.MatchString(b.text.LineData(l)) {
+		return searchMarker
+	}
+	if l < len(b.modified) && b.modified[l] {
+		return modifiedMarker
+	}
+	return noMarker
+}
+
+// markerStyle returns a style of the marker.
+func markerStyle(mk marker, th *Theme) tcell.Style {
+	switch mk {
+	case modifiedMarker:
+		return th.Modified.Style()
+	case searchMarker:
+		return th.Search.Style()
+	}
+	return th.LineNumber.Style()
+}
+
+// drawGutter draws the gutter of line l at screen line sl.
+func drawGutter(s tcell.Screen, a *Area, lineNumbers string, l, sl int, hl *regexp.Regexp, th *Theme) {
+	if a.gutter == 0 {
+		return
+	}
+	o := a.min.O
+	mk := a.buf.lineMarker(l, hl)
+	SetCell(s, sl, o, markerRunes[mk], markerStyle(mk, th))
+	o++
+	style := th.LineNumber.Style()
+	if l == a.cursor.l {
+		style = th.CurrentLineNumber.Style()
+	}
+	for _, r := range gutterNumber(lineNumbers, l, a.cursor.l, a.gutter-2) {
+		SetCell(s, sl, o, r, style)
+		o++
+	}
+	SetCell(s, sl, o, ' ', th.LineNumber.Style())
+}
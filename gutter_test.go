@@ -0,0 +1,97 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/kybin/tor/cell"
+)
+
+func TestGutterNumber(t *testing.T) {
+	cases := []struct {
+		mode string
+		l    int
+		want string
+	}{
+		{mode: lineNumbersAbsolute, l: 0, want: "  1"},
+		{mode: lineNumbersAbsolute, l: 9, want: " 10"},
+		{mode: lineNumbersRelative, l: 9, want: " 10"},
+		{mode: lineNumbersRelative, l: 6, want: "  3"},
+		{mode: lineNumbersRelative, l: 120, want: "111"},
+	}
+	for _, c := range cases {
+		if got := gutterNumber(c.mode, c.l, 9, 3); got != c.want {
+			t.Fatalf("gutterNumber(%v, %v, 9, 3): got %q, want %q", c.mode, c.l, got, c.want)
+		}
+	}
+}
+
+func TestGutterWidth(t *testing.T) {
+	if got := gutterWidth(lineNumbersOff, 100); got != 0 {
+		t.Fatalf("gutterWidth(off, 100): got %v, want 0", got)
+	}
+	if got := gutterWidth(lineNumbersRelative, 99); got != 4 {
+		t.Fatalf("gutterWidth(relative, 99): got %v, want 4", got)
+	}
+	if got := gutterWidth(lineNumbersAbsolute, 100); got != 5 {
+		t.Fatalf("gutterWidth(absolute, 100): got %v, want 5", got)
+	}
+	mode := lineNumbersOff
+	for _, want := range []string{lineNumbersAbsolute, lineNumbersRelative, lineNumbersOff} {
+		mode = nextLineNumbers(mode)
+		if mode != want {
+			t.Fatalf("nextLineNumbers: got %v, want %v", mode, want)
+		}
+	}
+}
+
+func TestAreaGutter(t *testing.T) {
+	a := NewArea(cell.Pt{0, 10}, cell.Pt{20, 80})
+	a.SetGutter(4)
+	if a.Win.size != (cell.Pt{20, 76}) || a.TextMin() != (cell.Pt{0, 14}) {
+		t.Fatalf("SetGutter(4): got window size %v and text min %v", a.Win.size, a.TextMin())
+	}
+	a.Resize(cell.Pt{20, 40})
+	if a.Win.size != (cell.Pt{20, 36}) {
+		t.Fatalf("Resize: got window size %v, want {20 36}", a.Win.size)
+	}
+	a.SetGutter(40)
+	if a.gutter != 0 || a.Win.size != (cell.Pt{20, 40}) {
+		t.Fatalf("SetGutter(40): a gutter that is wider than the area is shown")
+	}
+}
+
+func TestLineMarker(t *testing.T) {
+	m := &NormalMode{Buffer: NewBuffer("a.txt", NewText([]string{"a", "b", "c"}))}
+	m.cursor.SetBytePos(cell.Pt{1, 1})
+	m.do(&Action{kind: "insert", value: "\nd"})
+	want := []marker{noMarker, modifiedMarker, modifiedMarker, noMarker}
+	for l, w := range want {
+		if got := m.lineMarker(l, nil); got != w {
+			t.Fatalf("lineMarker(%d): got %v, want %v", l, got, w)
+		}
+	}
+	if got := m.lineMarker(2, regexp.MustCompile("d")); got != searchMarker {
+		t.Fatalf("lineMarker(2): got %v, want searchMarker", got)
+	}
+	m.clearModified()
+	if got := m.lineMarker(2, nil); got != noMarker {
+		t.Fatalf("lineMarker(2): got %v after save, want noMarker", got)
+	}
+}
+
+func TestFollowSmallWindow(t *testing.T) {
+	text := NewText([]string{"0123456789"})
+	c := NewCursor(text)
+	w := NewWindow(cell.Pt{1, 4})
+	for b := 0; b <= 10; b++ {
+		c.SetBytePos(cell.Pt{0, b})
+		w.Follow(c, 3)
+		if !w.Contains(c) {
+			t.Fatalf("Follow: window %v..%v doesn't contain the cursor at %v", w.Min(), w.Max(), c.Position())
+		}
+		if w.Follow(c, 3) {
+			t.Fatalf("Follow: window moved again for the cursor at %v", c.Position())
+		}
+	}
+}
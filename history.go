@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"strconv"
+	"time"
 )
 
 // Action is a user action.
@@ -12,7 +13,8 @@ type Action struct {
 	value        string
 	beforeCursor Cursor
 	afterCursor  Cursor
-	text         *Text
+	// edits are changes of the text made by the action.
+	edits []edit
 }
 
 func (a Action) String() string {
@@ -21,50 +23,224 @@ func (a Action) String() string {
 	return fmt.Sprintf("(%v, %v, %v, %v)", a.kind, a.value, bc, ac)
 }
 
+// historyNode is a state of text in a history.
+// It remembers an action group that makes the state from it's parent's.
+type historyNode struct {
+	seq     int // seq is the order of creation. The root's seq is 0.
+	time    time.Time
+	actions []*Action
+
+	parent   *historyNode
+	children []*historyNode
+	// last is the child that is lastly made or visited. Redo goes to it.
+	last *historyNode
+}
+
 // History remembers what actions are done by user.
+//
+// It is a tree of text states. Doing actions after undo makes a new branch,
+// while the previous branch remains. So every state could be visited again.
 type History struct {
-	head    int
-	actions [][]*Action
+	head  *historyNode
+	nodes []*historyNode // nodes are all nodes in creation order. nodes[0] is the root.
+	// cut prevents new actions from being joined to the head's group, until a group is added.
+	cut bool
 }
 
 // NewHistory create a new History.
 func NewHistory() *History {
+	root := &historyNode{time: time.Now()}
 	return &History{
-		head:    0,
-		actions: make([][]*Action, 0),
+		head:  root,
+		nodes: []*historyNode{root},
 	}
 }
 
-// Add adds action group to history.
-func (h *History) Add(action []*Action) {
-	h.actions = append(h.actions, action)
-	h.head++
+// Add adds action group to history, as a child of the head.
+// The new group becomes the head.
+func (h *History) Add(actions []*Action) {
+	n := &historyNode{
+		seq:     len(h.nodes),
+		time:    time.Now(),
+		actions: actions,
+		parent:  h.head,
+	}
+	h.head.children = append(h.head.children, n)
+	h.head.last = n
+	h.nodes = append(h.nodes, n)
+	h.head = n
+	h.cut = false
 }
 
-// Cut cuts history slice to given number and return how many were cut.
-func (h *History) Cut(to int) int {
-	b := len(h.actions)
-	h.actions = h.actions[:to]
-	h.head = len(h.actions)
-	a := len(h.actions)
-	return b - a
+// Len returns number of action groups in history.
+func (h *History) Len() int {
+	return len(h.nodes) - 1
 }
 
-// Len returns length of action group slice.
-func (h *History) Len() int {
-	return len(h.actions)
+// Last returns the head's action group, if new actions could be joined to it.
+// It is when the head is the end of a branch. Otherwise, it will return nil.
+func (h *History) Last() []*Action {
+	if h.cut || h.head.parent == nil || len(h.head.children) != 0 {
+		return nil
+	}
+	return h.head.actions
 }
 
-// At returns action group of given index.
-func (h *History) At(i int) []*Action {
-	return h.actions[i]
+// Cut makes new actions not joined to the head's group, until the next group is added.
+func (h *History) Cut() {
+	h.cut = true
 }
 
-// Last return last action group of history.
-// If history doesn't have any action group, it will return nil.
-func (h *History) Last() []*Action {
-	if len(h.actions) == 0 {
+// Squash joins action groups from n to the head into one group, so they are undone at once.
+// n is the head before the groups are added. It does nothing when groups other than
+// the ones between n and the head are added after n, like when they were undone.
+func (h *History) Squash(n *historyNode) {
+	path := make([]*historyNode, 0)
+	for c := h.head; c != n; c = c.parent {
+		if c == nil {
+			return
+		}
+		path = append(path, c)
+	}
+	if len(path) < 2 || len(h.nodes) != path[len(path)-1].seq+len(path) {
+		return
+	}
+	first := path[len(path)-1]
+	for i := len(path) - 2; i >= 0; i-- {
+		first.actions = append(first.actions, path[i].actions...)
+	}
+	first.children = nil
+	first.last = nil
+	h.nodes = h.nodes[:first.seq+1]
+	h.head = first
+}
+
+// undoGroup undoes an action group on t, by applying inverses of the edits in reverse order.
+// It returns the cursor before the group was done.
+func undoGroup(t *Text, actions []*Action) Cursor {
+	for i := len(actions) - 1; i >= 0; i-- {
+		edits := actions[i].edits
+		for j := len(edits) - 1; j >= 0; j-- {
+			edits[j].invert().apply(t)
+		}
+	}
+	return actions[0].beforeCursor
+}
+
+// redoGroup redoes an action group on t, by applying the edits again.
+// It returns the cursor after the group was done.
+func redoGroup(t *Text, actions []*Action) Cursor {
+	for _, a := range actions {
+		for _, e := range a.edits {
+			e.apply(t)
+		}
+	}
+	return actions[len(actions)-1].afterCursor
+}
+
+// Undo undoes the head's action group on t, and moves the head to it's parent.
+// It returns the cursor before the group was done.
+// If there is nothing to undo, it will return false.
+func (h *History) Undo(t *Text) (Cursor, bool) {
+	if h.head.parent == nil {
+		return Cursor{}, false
+	}
+	n := h.head
+	c := undoGroup(t, n.actions)
+	h.head = n.parent
+	h.head.last = n
+	return c, true
+}
+
+// Redo redoes the head's last child on t, and moves the head to it.
+// It returns the cursor after the group was done.
+// If there is nothing to redo, it will return false.
+func (h *History) Redo(t *Text) (Cursor, bool) {
+	if h.head.last == nil {
+		return Cursor{}, false
+	}
+	h.head = h.head.last
+	return redoGroup(t, h.head.actions), true
+}
+
+// Travel changes t from the head's state to n's, and moves the head to n.
+// It undoes groups to the common ancestor of them, then redoes groups to n.
+// It returns the cursor after the last undo or redo.
+// If the head is n already, it will return false.
+func (h *History) Travel(t *Text, n *historyNode) (Cursor, bool) {
+	if h.head == n {
+		return Cursor{}, false
+	}
+	depth := func(n *historyNode) int {
+		d := 0
+		for ; n.parent != nil; n = n.parent {
+			d++
+		}
+		return d
+	}
+	var c Cursor
+	from, to := h.head, n
+	df, dt := depth(from), depth(to)
+	down := make([]*historyNode, 0)
+	for df > dt {
+		c = undoGroup(t, from.actions)
+		from = from.parent
+		df--
+	}
+	for dt > df {
+		down = append(down, to)
+		to = to.parent
+		dt--
+	}
+	for from != to {
+		c = undoGroup(t, from.actions)
+		from = from.parent
+		down = append(down, to)
+		to = to.parent
+	}
+	for i := len(down) - 1; i >= 0; i-- {
+		d := down[i]
+		d.parent.last = d
+		c = redoGroup(t, d.actions)
+	}
+	h.head = n
+	return c, true
+}
+
+// Older returns the state that is made right before the head's.
+// It returns nil if the head is the root.
+func (h *History) Older() *historyNode {
+	if h.head.seq == 0 {
+		return nil
+	}
+	return h.nodes[h.head.seq-1]
+}
+
+// Newer returns the state that is made right after the head's.
+// It returns nil if the head is the newest state.
+func (h *History) Newer() *historyNode {
+	if h.head.seq == len(h.nodes)-1 {
 		return nil
 	}
-	return h.actions[len(h.actions)-1]
+	return h.nodes[h.head.seq+1]
+}
+
+// Branches returns ends of branches, in creation order.
+func (h *History) Branches() []*historyNode {
+	branches := make([]*historyNode, 0)
+	for _, n := range h.nodes {
+		if len(n.children) == 0 {
+			branches = append(branches, n)
+		}
+	}
+	return branches
+}
+
+// Tip returns the end of the branch that redo leads to from the head.
+func (h *History) Tip() *historyNode {
+	n := h.head
+	for n.last != nil {
+		n = n.last
+	}
+	return n
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+)
+
+// group returns an action group that is identified by v.
+// It inserts v at the start of a text.
+func group(v string) []*Action {
+	return []*Action{{kind: "insert", value: v, edits: []edit{insertEdit{0, 0, v}}}}
+}
+
+func TestHistoryBranch(t *testing.T) {
+	text := NewText([]string{""})
+	h := NewHistory()
+	for _, v := range []string{"a", "b", "c"} {
+		h.Add(group(v))
+		text.Insert(v, 0, 0)
+	}
+	h.Undo(text)
+	h.Undo(text)
+	// make a new branch from "a".
+	h.Add(group("d"))
+	text.Insert("d", 0, 0)
+	if got := len(h.Branches()); got != 2 {
+		t.Fatalf("Branches: got %d, want 2", got)
+	}
+	if h.Last() == nil {
+		t.Fatalf("Last: got nil at the end of a branch")
+	}
+
+	h.Travel(text, h.nodes[3])
+	if got := text.LineData(0); got != "cba" {
+		t.Fatalf("Travel: got %q, want %q", got, "cba")
+	}
+
+	// "c" is the third state, so older one is "b".
+	if older := h.Older(); older != h.nodes[2] {
+		t.Fatalf("Older: got #%d, want #2", older.seq)
+	}
+	if newer := h.Newer(); newer != h.nodes[4] {
+		t.Fatalf("Newer: got #%d, want #4", newer.seq)
+	}
+	h.Undo(text)
+	if h.Last() != nil {
+		t.Fatalf("Last: got a group in the middle of a branch")
+	}
+	if got := text.LineData(0); got != "ba" {
+		t.Fatalf("Undo: got %q, want %q", got, "ba")
+	}
+	if h.Redo(text); text.LineData(0) != "cba" {
+		t.Fatalf("Redo: got %q, want %q", text.LineData(0), "cba")
+	}
+}
+
+func TestHistorySquash(t *testing.T) {
+	text := NewText([]string{""})
+	h := NewHistory()
+	h.Add(group("a"))
+	text.Insert("a", 0, 0)
+	start := h.head
+	h.Cut()
+	if h.Last() != nil {
+		t.Fatalf("Last: got a group after Cut")
+	}
+	for _, v := range []string{"b", "c", "d"} {
+		h.Add(group(v))
+		text.Insert(v, 0, 0)
+	}
+	h.Squash(start)
+	if got := h.Len(); got != 2 {
+		t.Fatalf("Squash: got %d groups, want 2", got)
+	}
+	h.Undo(text)
+	if got := text.LineData(0); got != "a" {
+		t.Fatalf("Undo: got %q, want %q", got, "a")
+	}
+	h.Redo(text)
+	if got := text.LineData(0); got != "dcba" {
+		t.Fatalf("Redo: got %q, want %q", got, "dcba")
+	}
+}
+
+func TestEncodeHistory(t *testing.T) {
+	h := NewHistory()
+	h.Add(group("a"))
+	h.Add(group("b"))
+	h.Undo(NewText([]string{"ba"}))
+	h.Add(group("c"))
+	sh := encodeHistory(h)
+	if len(sh.Nodes) != 3 || sh.Head != 3 || sh.Nodes[2].Parent != 1 {
+		t.Fatalf("encodeHistory: got %+v", sh)
+	}
+	d := decodeHistory(sh, NewText([]string{""}))
+	if d == nil || len(d.Branches()) != 2 || d.head.actions[0].value != "c" {
+		t.Fatalf("decodeHistory: history tree is not restored")
+	}
+	if e := d.head.actions[0].edits[0]; e != (insertEdit{0, 0, "c"}) {
+		t.Fatalf("decodeHistory: got edit %v, want %v", e, insertEdit{0, 0, "c"})
+	}
+	sh.Version = 0
+	if decodeHistory(sh, NewText([]string{""})) != nil {
+		t.Fatalf("decodeHistory: old version of history is not discarded")
+	}
+
+	h = NewHistory()
+	for i := 0; i < maxSavedHistory+10; i++ {
+		h.Add(group("x"))
+	}
+	sh = encodeHistory(h)
+	if len(sh.Nodes) != maxSavedHistory || sh.Head != maxSavedHistory || sh.Nodes[0].Parent != 0 {
+		t.Fatalf("encodeHistory: got %d nodes and head %d, want %d", len(sh.Nodes), sh.Head, maxSavedHistory)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// HistoryMode is a mode for jumping to a branch of the undo history.
+//
+// It shows ends of the branches in status line, newest first.
+// The text changes to the chosen branch's state while choosing,
+// and Esc restores it to the state when the mode started.
+type HistoryMode struct {
+	nodes  []*historyNode
+	idx    int // index of the chosen node.
+	origin *historyNode
+}
+
+func (m *HistoryMode) Start() {
+	h := tor.normal.history
+	m.origin = h.head
+	m.nodes = make([]*historyNode, 0)
+	branches := h.Branches()
+	for i := len(branches) - 1; i >= 0; i-- {
+		if branches[i].parent != nil {
+			m.nodes = append(m.nodes, branches[i])
+		}
+	}
+	// the state before any edit.
+	m.nodes = append(m.nodes, h.nodes[0])
+	m.idx = 0
+	tip := h.Tip()
+	for i, n := range m.nodes {
+		if n == tip {
+			m.idx = i
+		}
+	}
+}
+
+func (m *HistoryMode) End() {}
+
+// jump changes the text to the state of node n.
+func (m *HistoryMode) jump(n *historyNode) {
+	nm := tor.normal
+	if nm.history.head == n {
+		return
+	}
+	nm.selection.on = false
+	nm.travel(n)
+	nm.text.edited = true
+}
+
+func (m *HistoryMode) Handle(ev *tcell.EventKey) {
+	switch ev.Key() {
+	case tcell.KeyEsc, tcell.KeyCtrlK:
+		m.jump(m.origin)
+		tor.ChangeMode(tor.normal)
+	case tcell.KeyEnter:
+		tor.ChangeMode(tor.normal)
+	case tcell.KeyUp, tcell.KeyLeft:
+		m.idx--
+		if m.idx < 0 {
+			m.idx = len(m.nodes) - 1
+		}
+		m.jump(m.nodes[m.idx])
+	case tcell.KeyDown, tcell.KeyRight:
+		m.idx++
+		if m.idx >= len(m.nodes) {
+			m.idx = 0
+		}
+		m.jump(m.nodes[m.idx])
+	}
+}
+
+func (m *HistoryMode) Status() string {
+	names := make([]string, 0, len(m.nodes))
+	for i, n := range m.nodes {
+		name := fmt.Sprintf("#%v %v", n.seq, n.time.Format("15:04:05"))
+		if n.parent == nil {
+			name = "#0 original"
+		}
+		if i == m.idx {
+			name = "[" + name + "]"
+		}
+		names = append(names, name)
+	}
+	return fmt.Sprintf("history : %v", strings.Join(names, " "))
+}
+
+func (m *HistoryMode) Error() string {
+	return ""
+}
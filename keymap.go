@@ -0,0 +1,522 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// command makes actions for a key chord.
+// It should make new actions every time, as done actions are remembered in history.
+type command func(m *NormalMode) []*Action
+
+// actionsCommand returns a command that makes actions from kind, value pairs.
+func actionsCommand(pairs ...[2]string) command {
+	return func(m *NormalMode) []*Action {
+		actions := make([]*Action, 0, len(pairs))
+		for _, p := range pairs {
+			actions = append(actions, &Action{kind: p[0], value: p[1]})
+		}
+		return actions
+	}
+}
+
+// actionValues are valid values of action kinds.
+// A nil slice means the kind could have any value.
+var actionValues = map[string][]string{
+	"exit":          {""},
+	"save":          {""},
+	"copy":          nil, // empty, or a named register.
+	"modeChange":    {"find", "replace", "queryReplace", "gotoline", "buffer", "open", "history"},
+	"replaceAll":    {""},
+	"highlight":     {"on", "off"},
+	"lineNumbers":   append(append([]string{}, lineNumbersModes...), "toggle"),
+	"wrap":          {"on", "off", "toggle"},
+	"view":          {"splitRight", "splitDown", "close", "next", "prev", "grow", "shrink"},
+	"macro":         {"record", "play"},
+	"killRing":      {"paste", "pasteKeepCursor", "cycle"},
+	"register":      {"copy", "paste"},
+	"filter":        nil, // empty to prompt for a shell command, or the command.
+	"cursors":       {"addNextMatch", "addAbove", "addBelow", "splitSelection", "clear"},
+	"selection":     {"on", "off", "block"},
+	"move":          append(append([]string{}, moveValues...), "selLeft", "selRight", "findPrev", "findNext", "findPrevWord", "findNextWord", "findPrevSelect", "findNextSelect"),
+	"insert":        nil,
+	"autoIndent":    {""},
+	"paste":         nil,
+	"insertBlock":   nil,
+	"delete":        {"", "selection"},
+	"backspace":     {""},
+	"insertTab":     {""},
+	"removeTab":     {""},
+	"toggleComment": {""},
+	"selectAll":     {""},
+	"selectLine":    {""},
+	"selectWord":    {""},
+	"undo":          {""},
+	"redo":          {""},
+	"older":         {""},
+	"newer":         {""},
+}
+
+// moveValues are values of move actions those have move and select commands.
+// For example, "bol" has "moveBol" and "selectBol" commands.
+var moveValues = []string{
+	"left", "right", "up", "down", "pageup", "pagedown", "bol", "eol", "bof", "eof",
+	"prevBowEow", "nextBowEow", "bocBolRepeat", "prevGlobal", "nextGlobal",
+	"prevIndentMatch", "nextIndentMatch", "prevArg", "nextArg", "matchingBracket",
+}
+
+// commands are named commands that key chords could be bound to.
+var commands = map[string]command{
+	"exit":                 actionsCommand([2]string{"selection", "off"}, [2]string{"exit", ""}),
+	"save":                 actionsCommand([2]string{"selection", "off"}, [2]string{"save", ""}),
+	"cancel":               actionsCommand([2]string{"selection", "off"}, [2]string{"highlight", "off"}, [2]string{"cursors", "clear"}),
+	"newline":              actionsCommand([2]string{"delete", "selection"}, [2]string{"insert", "\n"}),
+	"newlineIndent":        actionsCommand([2]string{"delete", "selection"}, [2]string{"insert", "\n"}, [2]string{"autoIndent", ""}),
+	"newlineBelow":         actionsCommand([2]string{"selection", "off"}, [2]string{"move", "eol"}, [2]string{"insert", "\n"}, [2]string{"autoIndent", ""}),
+	"removeTab":            actionsCommand([2]string{"removeTab", ""}),
+	"insertTab":            actionsCommand([2]string{"insertTab", ""}),
+	"toggleComment":        actionsCommand([2]string{"toggleComment", ""}),
+	"undo":                 actionsCommand([2]string{"undo", ""}),
+	"redo":                 actionsCommand([2]string{"redo", ""}),
+	"older":                actionsCommand([2]string{"older", ""}),
+	"newer":                actionsCommand([2]string{"newer", ""}),
+	"historyMode":          actionsCommand([2]string{"selection", "off"}, [2]string{"modeChange", "history"}),
+	"selLeft":              actionsCommand([2]string{"move", "selLeft"}, [2]string{"selection", "off"}),
+	"selRight":             actionsCommand([2]string{"move", "selRight"}, [2]string{"selection", "off"}),
+	"findNext":             actionsCommand([2]string{"selection", "off"}, [2]string{"move", "findNextSelect"}),
+	"findPrev":             actionsCommand([2]string{"selection", "off"}, [2]string{"move", "findPrevSelect"}),
+	"findMode":             actionsCommand([2]string{"modeChange", "find"}),
+	"replaceMode":          actionsCommand([2]string{"modeChange", "replace"}),
+	"replaceAll":           actionsCommand([2]string{"replaceAll", ""}),
+	"queryReplace":         actionsCommand([2]string{"modeChange", "queryReplace"}),
+	"gotoLineMode":         actionsCommand([2]string{"modeChange", "gotoline"}),
+	"bufferMode":           actionsCommand([2]string{"selection", "off"}, [2]string{"modeChange", "buffer"}),
+	"openMode":             actionsCommand([2]string{"selection", "off"}, [2]string{"modeChange", "open"}),
+	"selectAll":            actionsCommand([2]string{"selectAll", ""}),
+	"selectLine":           actionsCommand([2]string{"selectLine", ""}),
+	"toggleLineNumbers":    actionsCommand([2]string{"lineNumbers", "toggle"}),
+	"toggleWrap":           actionsCommand([2]string{"wrap", "toggle"}),
+	"splitRight":           actionsCommand([2]string{"view", "splitRight"}),
+	"splitDown":            actionsCommand([2]string{"view", "splitDown"}),
+	"closeView":            actionsCommand([2]string{"view", "close"}),
+	"focusNext":            actionsCommand([2]string{"view", "next"}),
+	"focusPrev":            actionsCommand([2]string{"view", "prev"}),
+	"growView":             actionsCommand([2]string{"view", "grow"}),
+	"shrinkView":           actionsCommand([2]string{"view", "shrink"}),
+	"addCursorNextMatch":   actionsCommand([2]string{"cursors", "addNextMatch"}),
+	"addCursorAbove":       actionsCommand([2]string{"cursors", "addAbove"}),
+	"addCursorBelow":       actionsCommand([2]string{"cursors", "addBelow"}),
+	"splitSelection":       actionsCommand([2]string{"cursors", "splitSelection"}),
+	"toggleBlockSelection": actionsCommand([2]string{"selection", "block"}),
+	"recordMacro":          actionsCommand([2]string{"macro", "record"}),
+	"cycleKillRing":        actionsCommand([2]string{"killRing", "cycle"}),
+	"copyToRegister":       actionsCommand([2]string{"register", "copy"}),
+	"pasteFromRegister":    actionsCommand([2]string{"register", "paste"}),
+	"playMacro":            actionsCommand([2]string{"macro", "play"}),
+	"filter":               actionsCommand([2]string{"filter", ""}),
+	"tab": func(m *NormalMode) []*Action {
+		tab := "\t"
+		if m.text.tabToSpace {
+			tab = strings.Repeat(" ", m.text.tabWidth)
+		}
+		return []*Action{{kind: "delete", value: "selection"}, {kind: "insert", value: tab}}
+	},
+	"delete": func(m *NormalMode) []*Action {
+		if m.selection.on {
+			return []*Action{{kind: "delete", value: "selection"}}
+		}
+		return []*Action{{kind: "delete"}}
+	},
+	"deleteWord": func(m *NormalMode) []*Action {
+		if m.selection.on {
+			return []*Action{{kind: "delete", value: "selection"}}
+		}
+		return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "nextBowEow"}, {kind: "delete", value: "selection"}}
+	},
+	"backspace": func(m *NormalMode) []*Action {
+		if m.selection.on {
+			return []*Action{{kind: "delete", value: "selection"}}
+		}
+		return []*Action{{kind: "backspace"}}
+	},
+	"backspaceWord": func(m *NormalMode) []*Action {
+		if m.selection.on {
+			return []*Action{{kind: "delete", value: "selection"}}
+		}
+		return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "prevBowEow"}, {kind: "delete", value: "selection"}}
+	},
+	"copy": func(m *NormalMode) []*Action {
+		if m.selection.on {
+			return []*Action{{kind: "copy"}, {kind: "selection", value: "off"}}
+		}
+		return []*Action{}
+	},
+	"cut": func(m *NormalMode) []*Action {
+		if m.selection.on {
+			return []*Action{{kind: "copy"}, {kind: "delete", value: "selection"}}
+		}
+		return []*Action{{kind: "copy"}, {kind: "delete"}}
+	},
+	"paste": func(m *NormalMode) []*Action {
+		m.syncClipboard()
+		return append([]*Action{{kind: "killRing", value: "paste"}}, pasteActions(m, m.copied(), false)...)
+	},
+	"pasteKeepCursor": func(m *NormalMode) []*Action {
+		m.syncClipboard()
+		return append([]*Action{{kind: "killRing", value: "pasteKeepCursor"}}, pasteActions(m, m.copied(), true)...)
+	},
+	"replace": func(m *NormalMode) []*Action {
+		if m.selection.on {
+			return []*Action{{kind: "delete", value: "selection"}, {kind: "insert", value: tor.replace.str}}
+		}
+		return []*Action{}
+	},
+}
+
+func init() {
+	for _, v := range moveValues {
+		name := strings.ToUpper(v[:1]) + v[1:]
+		commands["move"+name] = actionsCommand([2]string{"selection", "off"}, [2]string{"move", v})
+		commands["select"+name] = actionsCommand([2]string{"selection", "on"}, [2]string{"move", v})
+	}
+}
+
+// defaultKeymap is the built-in key bindings of tor.
+// It maps key chords to command names.
+var defaultKeymap = map[string]string{
+	"ctrl+q":        "exit",
+	"ctrl+s":        "save",
+	"ctrl+k":        "cancel",
+	"left":          "moveLeft",
+	"right":         "moveRight",
+	"up":            "moveUp",
+	"down":          "moveDown",
+	"pgup":          "movePageup",
+	"pgdn":          "movePagedown",
+	"home":          "moveBol",
+	"end":           "moveEol",
+	"enter":         "newline",
+	"ctrl+n":        "newlineIndent",
+	"alt+ctrl+n":    "newlineBelow",
+	"tab":           "tab",
+	"ctrl+u":        "removeTab",
+	"ctrl+o":        "insertTab",
+	"ctrl+_":        "toggleComment",
+	"delete":        "delete",
+	"alt+delete":    "deleteWord",
+	"backspace":     "backspace",
+	"alt+backspace": "backspaceWord",
+	"ctrl+z":        "undo",
+	"ctrl+y":        "redo",
+	"alt+-":         "older",
+	"alt+=":         "newer",
+	"alt+h":         "historyMode",
+	"alt+n":         "toggleLineNumbers",
+	"alt+v":         "toggleWrap",
+	"alt+p":         "splitRight",
+	"alt+P":         "splitDown",
+	"ctrl+w":        "closeView",
+	"alt+g":         "focusNext",
+	"alt+G":         "focusPrev",
+	"alt+t":         "growView",
+	"alt+T":         "shrinkView",
+	"alt+b":         "addCursorNextMatch",
+	"alt+up":        "addCursorAbove",
+	"alt+down":      "addCursorBelow",
+	"alt+ctrl+l":    "splitSelection",
+	"alt+ctrl+b":    "toggleBlockSelection",
+	"alt+ctrl+r":    "recordMacro",
+	"alt+ctrl+p":    "playMacro",
+	"ctrl+c":        "copy",
+	"ctrl+v":        "paste",
+	"ctrl+p":        "pasteKeepCursor",
+	"alt+ctrl+y":    "cycleKillRing",
+	"alt+ctrl+c":    "copyToRegister",
+	"alt+ctrl+v":    "pasteFromRegister",
+	"alt+|":         "filter",
+	"ctrl+j":        "replace",
+	"ctrl+x":        "cut",
+	"ctrl+d":        "findNext",
+	"f3":            "findNext",
+	"ctrl+b":        "findPrev",
+	"f2":            "findPrev",
+	"ctrl+f":        "findMode",
+	"ctrl+r":        "replaceMode",
+	"ctrl+g":        "gotoLineMode",
+	"ctrl+e":        "bufferMode",
+	"ctrl+t":        "openMode",
+	"ctrl+a":        "selectAll",
+	"ctrl+l":        "selectLine",
+	"alt+j":         "selLeft",
+	"alt+J":         "selectLeft",
+	"alt+l":         "selRight",
+	"alt+L":         "selectRight",
+	"alt+i":         "moveUp",
+	"alt+I":         "selectUp",
+	"alt+k":         "moveDown",
+	"alt+K":         "selectDown",
+	"alt+m":         "movePrevBowEow",
+	"alt+M":         "selectPrevBowEow",
+	"alt+.":         "moveNextBowEow",
+	"alt+>":         "selectNextBowEow",
+	"alt+u":         "moveBocBolRepeat",
+	"alt+U":         "selectBocBolRepeat",
+	"alt+y":         "moveBol",
+	"alt+Y":         "selectBol",
+	"alt+o":         "moveEol",
+	"alt+O":         "selectEol",
+	"alt+w":         "movePageup",
+	"alt+W":         "selectPageup",
+	"alt+s":         "movePagedown",
+	"alt+S":         "selectPagedown",
+	"alt+e":         "moveBof",
+	"alt+E":         "selectBof",
+	"alt+d":         "moveEof",
+	"alt+D":         "selectEof",
+	"alt+1":         "movePrevGlobal",
+	"alt+!":         "selectPrevGlobal",
+	"alt+2":         "moveNextGlobal",
+	"alt+@":         "selectNextGlobal",
+	"alt+9":         "movePrevGlobal",
+	"alt+(":         "selectPrevGlobal",
+	"alt+0":         "moveNextGlobal",
+	"alt+)":         "selectNextGlobal",
+	"alt+q":         "movePrevIndentMatch",
+	"alt+Q":         "selectPrevIndentMatch",
+	"alt+a":         "moveNextIndentMatch",
+	"alt+A":         "selectNextIndentMatch",
+	"alt+]":         "moveNextArg",
+	"alt+x":         "moveNextArg",
+	"alt+}":         "selectNextArg",
+	"alt+X":         "selectNextArg",
+	"alt+[":         "movePrevArg",
+	"alt+z":         "movePrevArg",
+	"alt+{":         "selectPrevArg",
+	"alt+Z":         "selectPrevArg",
+	"alt+r":         "replaceAll",
+	"alt+f":         "queryReplace",
+	"alt+c":         "moveMatchingBracket",
+	"alt+C":         "selectMatchingBracket",
+}
+
+// namedKeys are names of keys those are not runes, like "enter" or "ctrl+a".
+var namedKeys = map[string]bool{}
+
+func init() {
+	for _, n := range tcell.KeyNames {
+		namedKeys[keyName(n)] = true
+	}
+}
+
+// keyName converts tcell's key name to tor's, like "Ctrl-A" to "ctrl+a".
+func keyName(n string) string {
+	n = strings.ToLower(n)
+	if n == "backspace2" {
+		// both backspace keys are treated as same.
+		return "backspace"
+	}
+	return strings.Replace(n, "ctrl-", "ctrl+", 1)
+}
+
+// eventChord returns a key chord of the event, like "alt+ctrl+n" or "alt+J".
+// It returns an empty string for a key that doesn't have a name.
+func eventChord(ev *tcell.EventKey) string {
+	var key string
+	if ev.Key() == tcell.KeyRune {
+		key = string(ev.Rune())
+	} else {
+		n, ok := tcell.KeyNames[ev.Key()]
+		if !ok {
+			return ""
+		}
+		key = keyName(n)
+	}
+	if ev.Modifiers()&tcell.ModAlt != 0 {
+		key = "alt+" + key
+	}
+	return key
+}
+
+// parseChord parses a key chord written by user, and returns it's canonical form.
+// A chord is a key with an optional "alt+" prefix. A key is either a rune or a named key.
+// Named keys are case insensitive, while runes are not.
+func parseChord(s string) (string, error) {
+	key := s
+	alt := false
+	if len(key) > 4 && strings.EqualFold(key[:4], "alt+") {
+		alt = true
+		key = key[4:]
+	}
+	if utf8.RuneCountInString(key) == 1 {
+		if !alt {
+			return "", fmt.Errorf("rune key without alt: %v", s)
+		}
+	} else {
+		key = strings.ToLower(key)
+		if !namedKeys[key] {
+			return "", fmt.Errorf("unknown key: %v", s)
+		}
+	}
+	if alt {
+		key = "alt+" + key
+	}
+	return key, nil
+}
+
+// Keymap maps key chords to commands.
+type Keymap struct {
+	cmds map[string]command
+	// descs are descriptions of bound commands, used for listing.
+	descs map[string]string
+}
+
+// NewKeymap creates a Keymap that has default key bindings.
+func NewKeymap() *Keymap {
+	km := &Keymap{
+		cmds:  make(map[string]command),
+		descs: make(map[string]string),
+	}
+	for k, name := range defaultKeymap {
+		cmd, ok := commands[name]
+		if !ok {
+			panic(fmt.Sprintln("unknown command in default keymap:", name))
+		}
+		km.cmds[k] = cmd
+		km.descs[k] = name
+	}
+	return km
+}
+
+// Command returns a command bound to the event's key chord.
+// If the chord with alt is not bound, it will try without alt for a named key.
+func (km *Keymap) Command(ev *tcell.EventKey) command {
+	chord := eventChord(ev)
+	if cmd, ok := km.cmds[chord]; ok {
+		return cmd
+	}
+	if ev.Key() != tcell.KeyRune && strings.HasPrefix(chord, "alt+") {
+		return km.cmds[strings.TrimPrefix(chord, "alt+")]
+	}
+	return nil
+}
+
+// Load overrides key bindings from r, which is a JSON object.
+// A key of the object is a key chord, and the value is one of these.
+//
+//	"command"                            a command name.
+//	[["selection", "on"], ["move", "eol"]] kind, value pairs of actions.
+//	null                                 unbinds the chord.
+//
+// It applies valid bindings even if there are invalid ones,
+// and returns errors of the invalid bindings.
+func (km *Keymap) Load(r io.Reader) []error {
+	raw := make(map[string]json.RawMessage)
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return []error{fmt.Errorf("invalid keymap: %v", err)}
+	}
+	chords := make([]string, 0, len(raw))
+	for c := range raw {
+		chords = append(chords, c)
+	}
+	sort.Strings(chords)
+
+	errs := make([]error, 0)
+	for _, c := range chords {
+		chord, err := parseChord(c)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		v := raw[c]
+		if string(v) == "null" {
+			delete(km.cmds, chord)
+			delete(km.descs, chord)
+			continue
+		}
+		var name string
+		if err := json.Unmarshal(v, &name); err == nil {
+			cmd, ok := commands[name]
+			if !ok {
+				errs = append(errs, fmt.Errorf("%v: unknown command: %v", c, name))
+				continue
+			}
+			km.cmds[chord] = cmd
+			km.descs[chord] = name
+			continue
+		}
+		var pairs [][2]string
+		if err := json.Unmarshal(v, &pairs); err != nil {
+			errs = append(errs, fmt.Errorf("%v: should be a command name or kind, value pairs", c))
+			continue
+		}
+		if err := validateActions(pairs); err != nil {
+			errs = append(errs, fmt.Errorf("%v: %v", c, err))
+			continue
+		}
+		km.cmds[chord] = actionsCommand(pairs...)
+		km.descs[chord] = fmt.Sprint(pairs)
+	}
+	return errs
+}
+
+// validateActions checks kind, value pairs of actions are valid.
+func validateActions(pairs [][2]string) error {
+	if len(pairs) == 0 {
+		return fmt.Errorf("no actions")
+	}
+	for _, p := range pairs {
+		vals, ok := actionValues[p[0]]
+		if !ok {
+			return fmt.Errorf("unknown action kind: %v", p[0])
+		}
+		if vals == nil {
+			continue
+		}
+		found := false
+		for _, v := range vals {
+			if p[1] == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("invalid value for %v action: %q", p[0], p[1])
+		}
+	}
+	return nil
+}
+
+// Bindings returns all key bindings as sorted "chord : command" strings.
+func (km *Keymap) Bindings() []string {
+	bindings := make([]string, 0, len(km.descs))
+	for k, d := range km.descs {
+		bindings = append(bindings, fmt.Sprintf("%v : %v", k, d))
+	}
+	sort.Strings(bindings)
+	return bindings
+}
+
+// keymapFile is a config file that overrides key bindings.
+const keymapFile = "keys.json"
+
+// loadKeymap loads key bindings from the keymap file in config directory.
+// When there is no such file, it returns the default keymap without error.
+func loadKeymap() (*Keymap, []error) {
+	km := NewKeymap()
+	data := loadConfig(keymapFile)
+	if data == "" {
+		return km, nil
+	}
+	errs := km.Load(strings.NewReader(data))
+	for i, err := range errs {
+		errs[i] = fmt.Errorf("%v: %v", path.Join(configDir, keymapFile), err)
+	}
+	return km, errs
+}
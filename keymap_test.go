@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestParseChord(t *testing.T) {
+	cases := []struct {
+		s       string
+		want    string
+		wantErr bool
+	}{
+		{"Ctrl+Q", "ctrl+q", false},
+		{"alt+J", "alt+J", false},
+		{"Alt+Ctrl+N", "alt+ctrl+n", false},
+		{"F3", "f3", false},
+		{"alt+backspace", "alt+backspace", false},
+		{"j", "", true},
+		{"ctrl+shift+q", "", true},
+		{"hyper+a", "", true},
+	}
+	for _, c := range cases {
+		got, err := parseChord(c.s)
+		if (err != nil) != c.wantErr {
+			t.Fatalf("parseChord(%q): got error %v, want error %v", c.s, err, c.wantErr)
+		}
+		if got != c.want {
+			t.Fatalf("parseChord(%q): got %q, want %q", c.s, got, c.want)
+		}
+	}
+}
+
+func TestDefaultKeymap(t *testing.T) {
+	for k, name := range defaultKeymap {
+		if got, err := parseChord(k); err != nil || got != k {
+			t.Fatalf("parseChord(%q): got %q, %v, want canonical chord", k, got, err)
+		}
+		if _, ok := commands[name]; !ok {
+			t.Fatalf("%v: unknown command: %v", k, name)
+		}
+	}
+}
+
+func TestEventChord(t *testing.T) {
+	cases := []struct {
+		ev   *tcell.EventKey
+		want string
+	}{
+		{tcell.NewEventKey(tcell.KeyCtrlQ, 0, tcell.ModCtrl), "ctrl+q"},
+		{tcell.NewEventKey(tcell.KeyCtrlN, 0, tcell.ModCtrl|tcell.ModAlt), "alt+ctrl+n"},
+		{tcell.NewEventKey(tcell.KeyRune, 'J', tcell.ModAlt), "alt+J"},
+		{tcell.NewEventKey(tcell.KeyBackspace2, 0, tcell.ModNone), "backspace"},
+		{tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone), "enter"},
+	}
+	for _, c := range cases {
+		got := eventChord(c.ev)
+		if got != c.want {
+			t.Fatalf("eventChord(%v): got %q, want %q", c.ev.Name(), got, c.want)
+		}
+	}
+}
+
+func TestKeymapLoad(t *testing.T) {
+	km := NewKeymap()
+	errs := km.Load(strings.NewReader(`{
+		"alt+h": "moveLeft",
+		"ctrl+j": null,
+		"f5": [["selection", "off"], ["move", "bof"]],
+		"f6": "noSuchCommand",
+		"f7": [["move", "nowhere"]],
+		"f8": [["fly", ""]],
+		"super+x": "save"
+	}`))
+	if len(errs) != 4 {
+		t.Fatalf("Load: got %d errors, want 4: %v", len(errs), errs)
+	}
+	if _, ok := km.cmds["alt+h"]; !ok {
+		t.Fatalf("alt+h: not bound")
+	}
+	if _, ok := km.cmds["ctrl+j"]; ok {
+		t.Fatalf("ctrl+j: not unbound")
+	}
+	actions := km.cmds["f5"](nil)
+	if len(actions) != 2 || actions[1].kind != "move" || actions[1].value != "bof" {
+		t.Fatalf("f5: got %v, want selection off and move bof", actions)
+	}
+	for _, k := range []string{"f6", "f7", "f8"} {
+		if _, ok := km.cmds[k]; ok {
+			t.Fatalf("%v: invalid binding is bound", k)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"github.com/kybin/tor/cell"
+)
+
+// layout is a node of tor's layout tree.
+// A leaf has an area, and a split has two children placed side by side, or one above another.
+type layout struct {
+	area *Area
+
+	// vertical indicates children are split by a vertical line, so they are placed side by side.
+	vertical bool
+	// ratio is the first child's share of the split.
+	ratio    float64
+	children [2]*layout
+	parent   *layout
+
+	// min and size are where the node is placed.
+	// sep is offset of the separator line from min, for a split.
+	min  cell.Pt
+	size cell.Pt
+	sep  int
+}
+
+// leaves returns areas of the node, from top left to bottom right.
+func (n *layout) leaves() []*Area {
+	if n.area != nil {
+		return []*Area{n.area}
+	}
+	return append(n.children[0].leaves(), n.children[1].leaves()...)
+}
+
+// find returns a leaf that has area a. It returns nil when there isn't.
+func (n *layout) find(a *Area) *layout {
+	if n.area != nil {
+		if n.area == a {
+			return n
+		}
+		return nil
+	}
+	if l := n.children[0].find(a); l != nil {
+		return l
+	}
+	return n.children[1].find(a)
+}
+
+// fit places the node and it's children in the rectangle of min and size.
+// An area's text is placed at the center 80 columns of the area, and the gutter is at the left of it.
+func (n *layout) fit(min, size cell.Pt, lineNumbers string) {
+	n.min = min
+	n.size = size
+	if n.area != nil {
+		gutter := 0
+		if n.area.buf != nil {
+			gutter = gutterWidth(lineNumbers, n.area.buf.text.NumLines())
+		}
+		left := size.O/2 - 80/2 - gutter
+		if left < 0 {
+			left = 0
+		}
+		n.area.Set(cell.Pt{min.L, min.O + left}, cell.Pt{size.L, size.O - left})
+		n.area.SetGutter(gutter)
+		return
+	}
+	// one line for the separator.
+	total := size.L - 1
+	if n.vertical {
+		total = size.O - 1
+	}
+	n.sep = int(float64(total)*n.ratio + 0.5)
+	if n.sep < 1 {
+		n.sep = 1
+	}
+	if n.sep > total-1 {
+		n.sep = total - 1
+	}
+	if n.vertical {
+		n.children[0].fit(min, cell.Pt{size.L, n.sep}, lineNumbers)
+		n.children[1].fit(cell.Pt{min.L, min.O + n.sep + 1}, cell.Pt{size.L, total - n.sep}, lineNumbers)
+	} else {
+		n.children[0].fit(min, cell.Pt{n.sep, size.O}, lineNumbers)
+		n.children[1].fit(cell.Pt{min.L + n.sep + 1, min.O}, cell.Pt{total - n.sep, size.O}, lineNumbers)
+	}
+}
+
+// Areas returns areas that show buffers, from top left to bottom right.
+func (t *Tor) Areas() []*Area {
+	return t.layout.leaves()
+}
+
+// Focus makes a as the area that normal mode edits.
+// The area's cursor and selection become the buffer's, those normal mode uses.
+// Extra cursors of normal mode are cleared, as they are in the previous area.
+func (t *Tor) Focus(a *Area) {
+	t.normal.extras = nil
+	t.normal.area = a
+	t.normal.Buffer = a.buf
+	a.buf.cursor = a.cursor
+	a.buf.selection = a.selection
+}
+
+// showBuffer makes a show b, from where b was shown last time.
+func (t *Tor) showBuffer(a *Area, b *Buffer) {
+	c := *b.cursor
+	sel := *b.selection
+	a.buf = b
+	a.cursor = &c
+	a.selection = &sel
+	a.Win.min = b.winMin
+	a.Win.row = 0
+}
+
+// Split splits the focused area into two areas those show the same buffer,
+// and focuses the new one that is at the right or bottom.
+func (t *Tor) Split(vertical bool) {
+	old := t.normal.area
+	n := t.layout.find(old)
+	a := NewArea(cell.Pt{}, cell.Pt{})
+	a.Win.min = old.Win.min
+	a.Win.wrap = old.Win.wrap
+	a.Win.row = old.Win.row
+	c := *old.cursor
+	a.buf = old.buf
+	a.cursor = &c
+	a.selection = NewSelection(old.buf.text)
+
+	n.children[0] = &layout{area: old, parent: n}
+	n.children[1] = &layout{area: a, parent: n}
+	n.area = nil
+	n.vertical = vertical
+	n.ratio = 0.5
+	t.RefitAreas()
+	t.Focus(a)
+}
+
+// CloseArea closes the focused area, and focuses an area that takes the place.
+// It returns false when it is the last area.
+func (t *Tor) CloseArea() bool {
+	n := t.layout.find(t.normal.area)
+	p := n.parent
+	if p == nil {
+		return false
+	}
+	sibling := p.children[0]
+	if sibling == n {
+		sibling = p.children[1]
+	}
+	// the sibling takes the parent's place.
+	sibling.parent = p.parent
+	*p = *sibling
+	for _, c := range p.children {
+		if c != nil {
+			c.parent = p
+		}
+	}
+	t.RefitAreas()
+	t.Focus(p.leaves()[0])
+	return true
+}
+
+// ResizeArea grows the focused area by d cells, or shrinks it when d is negative.
+// It resizes the split that directly has the area.
+func (t *Tor) ResizeArea(d int) {
+	n := t.layout.find(t.normal.area)
+	p := n.parent
+	if p == nil {
+		return
+	}
+	total := p.size.L - 1
+	if p.vertical {
+		total = p.size.O - 1
+	}
+	if total <= 0 {
+		return
+	}
+	if p.children[1] == n {
+		d = -d
+	}
+	sep := p.sep + d
+	if sep < 1 || sep > total-1 {
+		return
+	}
+	p.ratio = float64(sep) / float64(total)
+	t.RefitAreas()
+}
+
+// FocusNext focuses the d-th next area from the focused one, in the order of Areas.
+// A negative d focuses a previous area.
+func (t *Tor) FocusNext(d int) {
+	areas := t.Areas()
+	i := 0
+	for ; i < len(areas); i++ {
+		if areas[i] == t.normal.area {
+			break
+		}
+	}
+	i = ((i+d)%len(areas) + len(areas)) % len(areas)
+	t.Focus(areas[i])
+}
+
+// shiftAreas keeps cursors and selections of b's areas those are not focused at the same text,
+// when lines [l, l+removed) of b are replaced with inserted lines.
+func (t *Tor) shiftAreas(b *Buffer, l, removed, inserted int) {
+	if t == nil || t.layout == nil || t.normal == nil {
+		return
+	}
+	shift := func(p cell.Pt) cell.Pt {
+		if p.L >= l+removed {
+			p.L += inserted - removed
+		} else if p.L >= l+inserted {
+			p.L = l + inserted - 1
+			if p.L < l {
+				p.L = l
+			}
+		}
+		if p.L >= b.text.NumLines() {
+			p.L = b.text.NumLines() - 1
+		}
+		if n := len(b.text.LineData(p.L)); p.O > n {
+			p.O = n
+		}
+		return p
+	}
+	for _, a := range t.Areas() {
+		// the focused area's cursors are moved by normal mode.
+		if a.buf != b || a == t.normal.area {
+			continue
+		}
+		a.cursor.SetBytePos(shift(a.cursor.BytePos()))
+		if a.selection.on {
+			a.selection.rng.Start = shift(a.selection.rng.Start)
+			a.selection.rng.End = shift(a.selection.rng.End)
+		}
+	}
+}
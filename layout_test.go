@@ -0,0 +1,160 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/kybin/tor/cell"
+)
+
+// setTestTor sets tor with a simulation screen of w x h, that shows the first of bufs.
+func setTestTor(t *testing.T, w, h int, bufs ...*Buffer) {
+	s := tcell.NewSimulationScreen("")
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	s.SetSize(w, h)
+	orig := tor
+	t.Cleanup(func() {
+		tor = orig
+		s.Fini()
+	})
+	tor = &Tor{screen: s}
+	tor.InitAreas()
+	for _, b := range bufs {
+		tor.AddBuffer(b)
+	}
+	tor.normal = &NormalMode{lineNumbers: lineNumbersOff, area: tor.layout.area}
+	tor.SwitchBuffer(bufs[0])
+}
+
+func TestSplit(t *testing.T) {
+	b := NewBuffer("a.txt", NewText([]string{"a", "b", "c"}))
+	setTestTor(t, 81, 25, b)
+	first := tor.normal.area
+	tor.Split(true)
+	areas := tor.Areas()
+	if len(areas) != 2 || areas[0] != first || areas[1] != tor.normal.area {
+		t.Fatalf("Split: got %v areas, want the new area focused at the right", len(areas))
+	}
+	if areas[0].size != (cell.Pt{24, 40}) || areas[1].min != (cell.Pt{0, 41}) || areas[1].size != (cell.Pt{24, 40}) {
+		t.Fatalf("Split: got areas at %v %v and %v %v", areas[0].min, areas[0].size, areas[1].min, areas[1].size)
+	}
+	if areas[1].buf != b || areas[1].cursor == areas[0].cursor || b.cursor != areas[1].cursor {
+		t.Fatalf("Split: the new area should show the same buffer with it's own cursor")
+	}
+
+	// edits in one area are reflected in the other, and it's cursor stays at the same text.
+	areas[0].cursor.SetBytePos(cell.Pt{1, 1})
+	m := tor.normal
+	m.cursor.SetBytePos(cell.Pt{0, 0})
+	m.do(&Action{kind: "insert", value: "x\ny\n"})
+	if got := areas[0].cursor.BytePos(); got != (cell.Pt{3, 1}) {
+		t.Fatalf("insert: got the other cursor at %v, want {3 1}", got)
+	}
+	m.cursor.SetBytePos(cell.Pt{1, 0})
+	m.do(&Action{kind: "selection", value: "on"})
+	m.selection.SetEnd(cell.Pt{4, 0})
+	m.do(&Action{kind: "delete", value: "selection"})
+	// the line of the cursor is deleted, it goes to where the deletion is.
+	if got := areas[0].cursor.BytePos(); got != (cell.Pt{1, 0}) {
+		t.Fatalf("delete: got the other cursor at %v, want {1 0}", got)
+	}
+
+	tor.FocusNext(1)
+	if tor.normal.area != areas[0] || b.cursor != areas[0].cursor {
+		t.Fatalf("FocusNext: the first area is not focused")
+	}
+	tor.ResizeArea(2)
+	if areas[0].size.O != 42 || areas[1].size.O != 38 {
+		t.Fatalf("ResizeArea(2): got widths %v and %v, want 42 and 38", areas[0].size.O, areas[1].size.O)
+	}
+
+	tor.Split(false)
+	if got := len(tor.Areas()); got != 3 {
+		t.Fatalf("Split: got %v areas, want 3", got)
+	}
+	bottom := tor.normal.area
+	if bottom.min != (cell.Pt{13, 0}) || bottom.size != (cell.Pt{11, 42}) {
+		t.Fatalf("Split: got the bottom area at %v %v", bottom.min, bottom.size)
+	}
+	if !tor.CloseArea() || tor.normal.area != areas[0] {
+		t.Fatalf("CloseArea: the area above is not focused")
+	}
+	if areas[0].size != (cell.Pt{24, 42}) {
+		t.Fatalf("CloseArea: got the area above at size %v, want {24 42}", areas[0].size)
+	}
+	if !tor.CloseArea() || tor.CloseArea() {
+		t.Fatalf("CloseArea: the last area should not be closed")
+	}
+	if tor.normal.area != areas[1] || areas[1].size != (cell.Pt{24, 81}) {
+		t.Fatalf("CloseArea: the rest area doesn't take the whole screen")
+	}
+}
+
+func TestCloseBufferInAreas(t *testing.T) {
+	a := NewBuffer("a.txt", NewText([]string{"a"}))
+	b := NewBuffer("b.txt", NewText([]string{"b"}))
+	setTestTor(t, 80, 25, a, b)
+	tor.Split(false)
+	tor.SwitchBuffer(b)
+	tor.FocusNext(1)
+	if tor.normal.Buffer != a {
+		t.Fatalf("FocusNext: got buffer %v, want a.txt", tor.normal.f)
+	}
+	tor.CloseBuffer(a)
+	for _, ar := range tor.Areas() {
+		if ar.buf != b {
+			t.Fatalf("CloseBuffer: an area shows %v, want b.txt", ar.buf.f)
+		}
+	}
+	if tor.normal.Buffer != b || b.cursor != tor.normal.area.cursor {
+		t.Fatalf("CloseBuffer: the focused area's buffer is not current")
+	}
+}
+
+func TestDrawInSplit(t *testing.T) {
+	useTempConfigDir(t)
+	themes, _ := loadThemes()
+	x := strings.Repeat("x", 39)
+	b := NewBuffer("a.txt", NewText([]string{x + "\tx", x + "世", x + "x"}))
+	setTestTor(t, 81, 25, b)
+	tor.Split(true)
+	left := tor.Areas()[0]
+	tor.RefitAreas()
+	// fill the screen, to see cells those are drawn.
+	for l := 0; l < 25; l++ {
+		for o := 0; o < 81; o++ {
+			tor.screen.SetContent(o, l, '#', nil, tcell.StyleDefault)
+		}
+	}
+	drawScreen(tor.screen, left, nil, lineNumbersOff, nil, themes["dark"])
+	// cells right of the area are not touched, even by a tab, a wide rune or the cell after the end of a line.
+	for l := 0; l < 3; l++ {
+		for o := left.min.O + left.size.O; o < 81; o++ {
+			if r, _, _, _ := tor.screen.GetContent(o, l); r != '#' {
+				t.Fatalf("drawScreen: got %q at %v:%v, right of the area", r, l, o)
+			}
+		}
+	}
+}
+
+func TestDrawHighlight(t *testing.T) {
+	useTempConfigDir(t)
+	themes, _ := loadThemes()
+	th := themes["dark"]
+	b := NewBuffer("a.txt", NewText([]string{"aaab", ""}))
+	setTestTor(t, 80, 24, b)
+	b.cursor.SetBytePos(cell.Pt{1, 0})
+	a := tor.Areas()[0]
+	drawScreen(tor.screen, a, nil, lineNumbersOff, regexp.MustCompile("aa"), th)
+	// matches those overlap with an earlier match are highlighted too.
+	for o, want := range []bool{true, true, true, false} {
+		_, _, style, _ := tor.screen.GetContent(a.min.O+o, a.min.L)
+		if got := style == th.Search.Style(); got != want {
+			t.Fatalf("drawScreen: got highlight %v at %v, want %v", got, o, want)
+		}
+	}
+}
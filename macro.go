@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// macrosFile is the config file that keeps recorded macros.
+const macrosFile = "macros.json"
+
+// maxMacroRepeat is how many times a macro is replayed at most,
+// when it repeats until a search fails, or the count is bigger than it.
+const maxMacroRepeat = 10000
+
+// macroKey is a recorded key event, or a recorded bracketed paste when Paste is not empty.
+type macroKey struct {
+	Key   tcell.Key     `json:"key"`
+	Rune  string        `json:"rune,omitempty"`
+	Mod   tcell.ModMask `json:"mod,omitempty"`
+	Paste string        `json:"paste,omitempty"`
+}
+
+// newMacroKey converts a key event to macroKey.
+func newMacroKey(ev *tcell.EventKey) macroKey {
+	k := macroKey{Key: ev.Key(), Mod: ev.Modifiers()}
+	if ev.Key() == tcell.KeyRune {
+		k.Rune = string(ev.Rune())
+	}
+	return k
+}
+
+// event converts k back to a key event.
+func (k macroKey) event() *tcell.EventKey {
+	r, _ := utf8.DecodeRuneInString(k.Rune)
+	if k.Rune == "" {
+		r = 0
+	}
+	return tcell.NewEventKey(k.Key, r, k.Mod)
+}
+
+// MacroMode records key events as macros in registers, and replays them.
+// As a mode, it is a prompt that takes a register to record to,
+// or a register to play with an optional count before it.
+type MacroMode struct {
+	// macros are recorded key events by their register.
+	macros map[string][]macroKey
+
+	// recording is the register that is being recorded, or empty when it is not recording.
+	recording string
+	keys      []macroKey
+
+	// play indicates the prompt is for playing a macro, not for recording.
+	play bool
+	// count is how many times the macro is replayed, typed before the register.
+	// "*" means it repeats until a search fails.
+	count   string
+	playing bool
+
+	err string
+}
+
+// loadMacros loads macros from macrosFile.
+// On any error, there will be no macros.
+func loadMacros() map[string][]macroKey {
+	macros := make(map[string][]macroKey)
+	s := loadConfig(macrosFile)
+	if s == "" {
+		return macros
+	}
+	if err := json.Unmarshal([]byte(s), &macros); err != nil {
+		return make(map[string][]macroKey)
+	}
+	return macros
+}
+
+// saveMacros saves macros to macrosFile.
+func saveMacros(macros map[string][]macroKey) error {
+	data, err := json.MarshalIndent(macros, "", "\t")
+	if err != nil {
+		return err
+	}
+	return saveConfig(macrosFile, string(data))
+}
+
+// startPrompt starts the prompt for playing a macro when play is true, or for recording one.
+func (m *MacroMode) startPrompt(play bool) {
+	m.play = play
+	tor.ChangeMode(m)
+}
+
+func (m *MacroMode) Start() {
+	m.count = ""
+	m.err = ""
+	if m.macros == nil {
+		m.macros = loadMacros()
+	}
+}
+
+func (m *MacroMode) End() {}
+
+func (m *MacroMode) Handle(ev *tcell.EventKey) {
+	switch ev.Key() {
+	case tcell.KeyEsc, tcell.KeyCtrlK:
+		tor.ChangeMode(tor.normal)
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if m.count == "" {
+			return
+		}
+		m.count = m.count[:len(m.count)-1]
+	case tcell.KeyRune:
+		r := ev.Rune()
+		if m.play && (unicode.IsDigit(r) && m.count != "*" || r == '*' && m.count == "") {
+			m.count += string(r)
+			return
+		}
+		if !unicode.IsLetter(r) {
+			m.err = "register should be a letter"
+			return
+		}
+		tor.ChangeMode(tor.normal)
+		if m.play {
+			m.replay(string(r), m.count)
+		} else {
+			m.recording = string(r)
+			m.keys = nil
+		}
+	}
+}
+
+// record remembers ev as a key of the recording macro.
+func (m *MacroMode) record(ev *tcell.EventKey) {
+	m.keys = append(m.keys, newMacroKey(ev))
+}
+
+// recordPaste records a bracketed paste of s to the macro.
+func (m *MacroMode) recordPaste(s string) {
+	m.keys = append(m.keys, macroKey{Paste: s})
+}
+
+// stopRecord stops recording, and saves the recorded macro to it's register.
+func (m *MacroMode) stopRecord() error {
+	reg := m.recording
+	m.recording = ""
+	m.macros[reg] = m.keys
+	m.keys = nil
+	return saveMacros(m.macros)
+}
+
+// replay replays the macro in register reg count times, or until a search fails when count is "*".
+// It stops at any error, and leaves the error to the current mode.
+// Changes of the text by the replay are undone at once.
+func (m *MacroMode) replay(reg, count string) {
+	keys, ok := m.macros[reg]
+	if !ok {
+		tor.normal.err = fmt.Sprintf("no macro in register %v", reg)
+		return
+	}
+	if m.playing {
+		tor.normal.err = "cannot play a macro inside of a macro"
+		return
+	}
+	n, untilFail := 1, false
+	if count == "*" {
+		n, untilFail = maxMacroRepeat, true
+	} else if count != "" {
+		var err error
+		n, err = strconv.Atoi(count)
+		if (err != nil && !errors.Is(err, strconv.ErrRange)) || n < 1 {
+			tor.normal.err = fmt.Sprintf("invalid count: %v", count)
+			return
+		}
+		// a huge count would not end, if the macro never fails.
+		if n > maxMacroRepeat {
+			n = maxMacroRepeat
+		}
+	}
+	m.playing = true
+	b := tor.normal.Buffer
+	start := b.history.head
+	b.history.Cut()
+	defer func() {
+		m.playing = false
+		b.history.Squash(start)
+	}()
+	for i := 0; i < n; i++ {
+		head, pos := b.history.head, b.cursor.BytePos()
+		for _, k := range keys {
+			if k.Paste != "" {
+				tor.HandlePaste(k.Paste)
+			} else {
+				tor.current.Handle(k.event())
+			}
+			if macroFailed() {
+				return
+			}
+		}
+		// a macro that changes nothing will never fail.
+		if untilFail && b.history.head == head && b.cursor.BytePos() == pos {
+			return
+		}
+	}
+}
+
+// macroFailed returns true if the current mode has an error after handling a key of a macro, like a failed search.
+func macroFailed() bool {
+	if tor.current == tor.normal {
+		// read-only is not an error of the key.
+		return tor.normal.err != ""
+	}
+	return tor.current.Error() != ""
+}
+
+func (m *MacroMode) Status() string {
+	if m.play {
+		return fmt.Sprintf("play macro : %v", m.count)
+	}
+	return "record macro : "
+}
+
+func (m *MacroMode) Error() string {
+	return m.err
+}
+
+// HandleKey lets the current mode handle a key event.
+// It records the key while recording a macro, except keys for choosing the register to record.
+func (t *Tor) HandleKey(ev *tcell.EventKey) {
+	recording := t.recordingMacro()
+	t.current.Handle(ev)
+	// the key that stops recording is not a part of the macro.
+	if recording && t.macro.recording != "" {
+		t.macro.record(ev)
+	}
+}
+
+// recordingMacro checks whether an input to the current mode is recorded to a macro.
+// Inputs to the prompt that starts recording, and inputs from a replay are not recorded.
+func (t *Tor) recordingMacro() bool {
+	if t.macro == nil || t.macro.recording == "" || t.macro.playing {
+		return false
+	}
+	return !(t.current == t.macro && !t.macro.play)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestMacro(t *testing.T) {
+	useTempConfigDir(t)
+
+	b := NewBuffer("a.txt", NewText([]string{"foo bar foo", "baz foo", "foo"}))
+	b.text.writable = true
+	setTestTor(t, 80, 24, b)
+	tor.normal.keymap = NewKeymap()
+	tor.find = &FindMode{str: "foo"}
+	tor.macro = &MacroMode{}
+	tor.current = tor.normal
+
+	keys := []*tcell.EventKey{
+		tcell.NewEventKey(tcell.KeyCtrlR, 0, tcell.ModAlt|tcell.ModCtrl),
+		tcell.NewEventKey(tcell.KeyRune, 'a', tcell.ModNone),
+		// find the next "foo" after the cursor, and replace it.
+		tcell.NewEventKey(tcell.KeyCtrlD, 0, tcell.ModCtrl),
+		tcell.NewEventKey(tcell.KeyRune, 'X', tcell.ModNone),
+		tcell.NewEventKey(tcell.KeyCtrlR, 0, tcell.ModAlt|tcell.ModCtrl),
+	}
+	for _, ev := range keys {
+		tor.HandleKey(ev)
+	}
+	if got := len(tor.macro.macros["a"]); got != 2 {
+		t.Fatalf("record: got %v keys, want 2", got)
+	}
+	if got := loadMacros(); len(got["a"]) != 2 || got["a"][1].Rune != "X" {
+		t.Fatalf("loadMacros: got %v", got)
+	}
+	groups := b.history.Len()
+
+	// repeat until there is no "foo".
+	for _, ev := range []*tcell.EventKey{
+		tcell.NewEventKey(tcell.KeyCtrlP, 0, tcell.ModAlt|tcell.ModCtrl),
+		tcell.NewEventKey(tcell.KeyRune, '*', tcell.ModNone),
+		tcell.NewEventKey(tcell.KeyRune, 'a', tcell.ModNone),
+	} {
+		tor.HandleKey(ev)
+	}
+	want := "X bar X\nbaz X\nX"
+	if got := strings.Join(textLines(b.text), "\n"); got != want {
+		t.Fatalf("replay: got %q, want %q", got, want)
+	}
+	if tor.current != tor.normal || tor.normal.err != "not found: foo" {
+		t.Fatalf("replay: got error %q, want it stopped by a failed search", tor.normal.err)
+	}
+	if got := b.history.Len(); got != groups+1 {
+		t.Fatalf("replay: got %v history groups, want %v", got, groups+1)
+	}
+	tor.normal.do(&Action{kind: "undo"})
+	if got, want := strings.Join(textLines(b.text), "\n"), "foo bar X\nbaz foo\nfoo"; got != want {
+		t.Fatalf("undo: got %q, want %q", got, want)
+	}
+}
+
+func TestMacroCount(t *testing.T) {
+	useTempConfigDir(t)
+
+	b := NewBuffer("a.txt", NewText([]string{"abc"}))
+	setTestTor(t, 80, 24, b)
+	tor.normal.keymap = NewKeymap()
+	tor.macro = &MacroMode{macros: map[string][]macroKey{
+		"a": {newMacroKey(tcell.NewEventKey(tcell.KeyRight, 0, tcell.ModNone))},
+	}}
+	tor.current = tor.normal
+
+	// moving right never fails, so a huge count is limited.
+	tor.macro.replay("a", "99999999999999999999")
+	if tor.normal.err != "" || b.cursor.BytePos().O != 3 {
+		t.Fatalf("replay: got error %q, cursor at %v", tor.normal.err, b.cursor.BytePos())
+	}
+	for _, count := range []string{"1x", "0", "-1", "-99999999999999999999"} {
+		tor.normal.err = ""
+		tor.macro.replay("a", count)
+		if tor.normal.err != "invalid count: "+count {
+			t.Fatalf("replay %q: got error %q, want invalid count", count, tor.normal.err)
+		}
+	}
+}
+
+func TestMacroPaste(t *testing.T) {
+	useTempConfigDir(t)
+
+	b := NewBuffer("a.txt", NewText([]string{""}))
+	b.text.writable = true
+	setTestTor(t, 80, 24, b)
+	tor.normal.keymap = NewKeymap()
+	tor.macro = &MacroMode{}
+	tor.current = tor.normal
+
+	record := tcell.NewEventKey(tcell.KeyCtrlR, 0, tcell.ModAlt|tcell.ModCtrl)
+	tor.HandleKey(record)
+	tor.HandleKey(tcell.NewEventKey(tcell.KeyRune, 'a', tcell.ModNone))
+	tor.HandlePaste("x\ry")
+	tor.HandleKey(tcell.NewEventKey(tcell.KeyRune, '!', tcell.ModNone))
+	tor.HandleKey(record)
+	if got := loadMacros()["a"]; len(got) != 2 || got[0].Paste != "x\ny" {
+		t.Fatalf("record: got %v, want the paste and a key", got)
+	}
+
+	tor.macro.replay("a", "")
+	if got, want := strings.Join(textLines(b.text), "\n"), "x\ny!x\ny!"; got != want {
+		t.Fatalf("replay: got %q, want %q", got, want)
+	}
+}
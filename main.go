@@ -4,7 +4,6 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -15,7 +14,7 @@ import (
 )
 
 var usage = `
-  tor [flag...] file
+  tor [flag...] file...
 
 file
   filename[:line[:offset]]
@@ -29,7 +28,16 @@ func printUsage(f *flag.FlagSet) {
 	f.PrintDefaults()
 }
 
-// sortArgs sorts args to make flags always placed ahead of file arg.
+// configErrorStatus returns a status that shows the first of errs from config files.
+// flag is a flag of tor that prints all of them.
+func configErrorStatus(errs []error, flag string) string {
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+	return fmt.Sprintf("%v (and %v more errors, see tor %v)", errs[0], len(errs)-1, flag)
+}
+
+// sortArgs sorts args to make flags always placed ahead of file args.
 func sortArgs(args []string) {
 	sort.Slice(args, func(i, j int) bool {
 		iIsFlag := strings.HasPrefix(args[i], "-")
@@ -80,17 +88,33 @@ func parseFileArg(farg string) (string, int, int) {
 
 type Tor struct {
 	screen     tcell.Screen
-	mainArea   *Area
+	theme      *Theme
 	statusArea *Area
 
+	// layout places areas those show buffers.
+	layout *layout
+
+	// buffers are opened files. normal mode edits one of them.
+	buffers []*Buffer
+
 	// current is a mode that will handle terminal events.
 	current Mode
 
+	// pasting is the string of a bracketed paste, while it is being pasted.
+	pasting *strings.Builder
+
 	// All modes that could be current mode.
 	normal   *NormalMode
 	find     *FindMode
 	replace  *ReplaceMode
+	query    *QueryReplaceMode
 	gotoline *GotoLineMode
+	buffer   *BufferMode
+	open     *OpenMode
+	history  *HistoryMode
+	macro    *MacroMode
+	register *RegisterMode
+	filter   *FilterMode
 	exit     *ExitMode
 }
 
@@ -98,23 +122,20 @@ type Tor struct {
 var tor *Tor = nil
 
 func (t *Tor) InitAreas() {
-	w, h := t.screen.Size()
-	left := w/2 - 80/2
-	if left < 0 {
-		left = 0
-	}
-	t.mainArea = NewArea(cell.Pt{0, left}, cell.Pt{h - 1, w - left})
-	t.statusArea = NewArea(cell.Pt{h - 1, 0}, cell.Pt{1, w})
+	t.layout = &layout{area: NewArea(cell.Pt{}, cell.Pt{})}
+	t.statusArea = NewArea(cell.Pt{}, cell.Pt{})
+	t.RefitAreas()
 }
 
 // Refit refits it's areas.
+// The layout takes the screen except the last line, that is for the status area.
 func (t *Tor) RefitAreas() {
 	w, h := t.screen.Size()
-	left := w/2 - 80/2
-	if left < 0 {
-		left = 0
+	lineNumbers := lineNumbersOff
+	if t.normal != nil {
+		lineNumbers = t.normal.lineNumbers
 	}
-	t.mainArea.Set(cell.Pt{0, left}, cell.Pt{h - 1, w - left})
+	t.layout.fit(cell.Pt{0, 0}, cell.Pt{h - 1, w}, lineNumbers)
 	t.statusArea.Set(cell.Pt{h - 1, 0}, cell.Pt{1, w})
 }
 
@@ -130,27 +151,72 @@ func main() {
 	flagset := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	var newFlag bool
 	flagset.BoolVar(&newFlag, "new", false, "let tor to edit a new file.")
+	var keysFlag bool
+	flagset.BoolVar(&keysFlag, "keys", false, "print key bindings and exit.")
+	var langsFlag bool
+	flagset.BoolVar(&langsFlag, "langs", false, "print languages for syntax highlighting and exit.")
+	var themesFlag bool
+	flagset.BoolVar(&themesFlag, "themes", false, "print themes and exit.")
 
 	args := os.Args[1:]
 	sortArgs(args)
 	flagset.Parse(args)
 
+	keymap, keymapErrs := loadKeymap()
+	if keysFlag {
+		for _, err := range keymapErrs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		for _, b := range keymap.Bindings() {
+			fmt.Println(b)
+		}
+		os.Exit(0)
+	}
+	langErrs := loadLanguages()
+	if langsFlag {
+		for _, err := range langErrs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		for _, l := range syntax.Languages() {
+			fmt.Println(l)
+		}
+		os.Exit(0)
+	}
+	themes, themeErrs := loadThemes()
+	theme, err := chooseTheme(themes)
+	if err != nil {
+		themeErrs = append(themeErrs, err)
+	}
+	if themesFlag {
+		for _, err := range themeErrs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		for _, name := range themeNames(themes) {
+			if name == theme.Name {
+				name += " (current)"
+			}
+			fmt.Println(name)
+		}
+		os.Exit(0)
+	}
+	cb, clipboardErr := loadClipboard()
+	formatters, formatErrs := loadFormatters()
+
 	fileArgs := flagset.Args()
-	if len(fileArgs) != 1 {
+	if len(fileArgs) == 0 {
 		printUsage(flagset)
 		os.Exit(1)
 	}
 
-	editFile, initL, initB := parseFileArg(fileArgs[0])
-	if initL == -1 {
-		initL, initB = loadLastPosition(editFile)
-	}
-
-	// get text from file or make new.
-	text, err := readOrCreate(editFile, newFlag)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	// get texts from files or make new.
+	buffers := make([]*Buffer, 0, len(fileArgs))
+	for _, farg := range fileArgs {
+		b, err := openBuffer(farg, newFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		buffers = append(buffers, b)
 	}
 
 	screen, err := tcell.NewScreen()
@@ -161,66 +227,87 @@ func main() {
 		panic(err)
 	}
 	defer screen.Fini()
-	screen.SetStyle(tcell.StyleDefault.Background(tcell.ColorReset).Foreground(tcell.ColorReset))
+	theme.Fit(screen.Colors())
+	screen.SetStyle(theme.Text.Style())
 	screen.EnablePaste()
 	screen.Clear()
 
-	cursor := NewCursor(text)
-	cursor.GotoLine(initL)
-	cursor.SetCloseToB(initB)
-	selection := NewSelection(text)
-	history := NewHistory()
-	ext := filepath.Ext(editFile)
-	if ext != "" {
-		ext = ext[1:]
-	}
-	parser := syntax.NewParser(text, ext)
-
 	// create modes for handling events.
 	tor = &Tor{}
 	tor.screen = screen
+	tor.theme = theme
 	tor.InitAreas()
+	for _, b := range buffers {
+		tor.AddBuffer(b)
+	}
 	tor.normal = &NormalMode{
-		text:      text,
-		cursor:    cursor,
-		selection: selection,
-		history:   history,
-		f:         editFile,
-		parser:    parser,
-		copied:    loadConfig("copy"),
-		area:      tor.mainArea,
+		ring:        loadKillRing(),
+		registers:   loadRegisters(),
+		lineNumbers: loadLineNumbers(),
+		area:        tor.layout.area,
+		keymap:      keymap,
+		clipboard:   cb,
+		formatters:  formatters,
 	}
+	if len(keymapErrs) != 0 {
+		tor.normal.err = configErrorStatus(keymapErrs, "-keys")
+	} else if len(langErrs) != 0 {
+		tor.normal.err = configErrorStatus(langErrs, "-langs")
+	} else if len(themeErrs) != 0 {
+		tor.normal.err = configErrorStatus(themeErrs, "-themes")
+	} else if clipboardErr != nil {
+		tor.normal.err = clipboardErr.Error()
+	} else if len(formatErrs) != 0 {
+		tor.normal.err = formatErrs[0].Error()
+	}
+	tor.SwitchBuffer(tor.buffers[0])
 	tor.find = &FindMode{
 		str: loadConfig("find"),
 	}
 	tor.replace = &ReplaceMode{
 		str: loadConfig("replace"),
 	}
-	tor.gotoline = &GotoLineMode{
-		cursor: cursor,
-	}
-	tor.exit = &ExitMode{
-		f:      editFile,
-		cursor: cursor,
-	}
+	tor.query = &QueryReplaceMode{}
+	tor.gotoline = &GotoLineMode{}
+	tor.buffer = &BufferMode{}
+	tor.open = &OpenMode{}
+	tor.history = &HistoryMode{}
+	tor.macro = &MacroMode{}
+	tor.register = &RegisterMode{}
+	tor.filter = &FilterMode{}
+	tor.exit = &ExitMode{}
 	tor.current = tor.normal // start as normal mode.
 
 	tor.exit.exit = func() {
-		saveLastPosition(editFile, cursor.l, cursor.b)
+		for _, b := range tor.buffers {
+			b.saveState()
+		}
 		screen.Fini()
 		os.Exit(0)
 	}
 
 	// main loop
 	for {
-		tor.normal.area.Win.Follow(tor.normal.cursor, 3)
+		// gutters grow as the texts grow, or change by switching buffers.
+		tor.RefitAreas()
+		for _, a := range tor.Areas() {
+			a.Win.Follow(a.cursor, 3)
+		}
 
 		screen.Clear()
-		drawScreen(screen, tor.normal)
-		drawStatus(screen, tor.current)
+		for _, a := range tor.Areas() {
+			var extras []cursorSel
+			if a == tor.normal.area {
+				extras = tor.normal.extras
+			}
+			drawScreen(screen, a, extras, tor.normal.lineNumbers, tor.find.Highlight(), tor.theme)
+		}
+		drawSeparators(screen, tor.layout, tor.theme)
+		drawStatus(screen, tor.current, tor.theme)
 		if tor.current == tor.normal {
-			winP := cursor.Position().Sub(tor.normal.area.Win.Min())
-			screen.ShowCursor(winP.O+tor.normal.area.min.O, winP.L)
+			winP := tor.normal.area.Win.CursorPos(tor.normal.cursor)
+			textMin := tor.normal.area.TextMin()
+			screen.ShowCursor(winP.O+textMin.O, winP.L+textMin.L)
 		} else {
 			_, h := screen.Size()
 			screen.ShowCursor(vlen(tor.current.Status(), tor.normal.text.tabWidth), h)
@@ -231,8 +318,20 @@ func main() {
 		ev := screen.PollEvent()
 
 		switch ev := ev.(type) {
+		case *tcell.EventPaste:
+			if ev.Start() {
+				tor.pasting = &strings.Builder{}
+			} else if tor.pasting != nil {
+				s := tor.pasting.String()
+				tor.pasting = nil
+				tor.HandlePaste(s)
+			}
 		case *tcell.EventKey:
-			tor.current.Handle(ev)
+			if tor.pasting != nil {
+				pasteKey(tor.pasting, ev)
+				continue
+			}
+			tor.HandleKey(ev)
 		case *tcell.EventResize:
 			tor.RefitAreas()
 			screen.Sync()
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kybin/tor/cell"
+)
+
+// cursorSel is a cursor and it's selection.
+// Normal mode could have extra ones besides the buffer's cursor and selection.
+type cursorSel struct {
+	cursor    *Cursor
+	selection *Selection
+}
+
+// perCursorKinds are action kinds those are done at every cursor.
+// Other kinds are done only at the buffer's cursor.
+var perCursorKinds = map[string]bool{
+	"selection":     true,
+	"move":          true,
+	"insert":        true,
+	"autoIndent":    true,
+	"paste":         true,
+	"delete":        true,
+	"backspace":     true,
+	"insertTab":     true,
+	"removeTab":     true,
+	"toggleComment": true,
+	"selectLine":    true,
+	"selectWord":    true,
+}
+
+// lineKinds are per cursor kinds those change whole lines.
+// They are done once for a line, even if the line has multiple cursors.
+var lineKinds = map[string]bool{
+	"insertTab":     true,
+	"removeTab":     true,
+	"toggleComment": true,
+}
+
+// cursorSels returns all cursors of normal mode. The buffer's one is the first.
+func (m *NormalMode) cursorSels() []cursorSel {
+	return append([]cursorSel{{m.cursor, m.selection}}, m.extras...)
+}
+
+// doAll does action a at the buffer's cursor, then at the extra cursors if it is one of perCursorKinds.
+// Edits at the extra cursors are joined to a, so they are undone at once.
+func (m *NormalMode) doAll(a *Action) {
+	all := m.cursorSels()
+	value := a.value
+	m.do(a)
+	if len(m.extras) == 0 {
+		return
+	}
+	shiftCursors(all, 0, a.edits)
+	if perCursorKinds[a.kind] {
+		done := make(map[int]bool)
+		for i, cs := range all {
+			if lineKinds[a.kind] {
+				lines := cs.selection.Lines()
+				if lines == nil {
+					lines = []int{cs.cursor.l}
+				}
+				skip := false
+				for _, l := range lines {
+					skip = skip || done[l]
+					done[l] = true
+				}
+				if skip {
+					continue
+				}
+			}
+			if i == 0 {
+				continue
+			}
+			ea := &Action{kind: a.kind, value: value}
+			m.doAt(ea, cs)
+			shiftCursors(all, i, ea.edits)
+			a.edits = append(a.edits, ea.edits...)
+		}
+	}
+	m.mergeCursors()
+}
+
+// doAt does action a at cursor cs, instead of the buffer's cursor.
+func (m *NormalMode) doAt(a *Action, cs cursorSel) {
+	c, sel := m.cursor, m.selection
+	m.cursor, m.selection = cs.cursor, cs.selection
+	defer func() {
+		m.cursor, m.selection = c, sel
+	}()
+	m.do(a)
+}
+
+// shiftCursors keeps cursors at the same text after edits, except the one at index doer that made them.
+func shiftCursors(all []cursorSel, doer int, edits []edit) {
+	if len(edits) == 0 {
+		return
+	}
+	shift := func(p cell.Pt) cell.Pt {
+		for _, e := range edits {
+			p = e.shift(p)
+		}
+		return p
+	}
+	for i, cs := range all {
+		if i == doer {
+			continue
+		}
+		cs.cursor.SetBytePos(shift(cs.cursor.BytePos()))
+		if cs.selection.on {
+			cs.selection.rng.Start = shift(cs.selection.rng.Start)
+			cs.selection.rng.End = shift(cs.selection.rng.End)
+		}
+	}
+}
+
+// mergeCursors removes extra cursors those are at the same position with another cursor.
+func (m *NormalMode) mergeCursors() {
+	seen := map[cell.Pt]bool{m.cursor.BytePos(): true}
+	extras := m.extras[:0]
+	for _, cs := range m.extras {
+		p := cs.cursor.BytePos()
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		extras = append(extras, cs)
+	}
+	m.extras = extras
+}
+
+// pushCursor adds a copy of the buffer's cursor and selection to the extra cursors.
+// The buffer's cursor could be moved to a new place after that.
+func (m *NormalMode) pushCursor() {
+	c := *m.cursor
+	sel := *m.selection
+	m.extras = append(m.extras, cursorSel{&c, &sel})
+}
+
+// addCursorAtNextMatch adds a cursor at the next match of the selected string, and selects the match.
+// The buffer's cursor moves to the match, so the window follows it.
+// When nothing is selected, it selects the word at the cursor first.
+func (m *NormalMode) addCursorAtNextMatch() {
+	if !m.selection.on {
+		m.selectWord()
+		return
+	}
+	s := m.selection.Data()
+	if s == "" || strings.Contains(s, "\n") {
+		m.err = "select a string in a line to add cursors at it's matches"
+		return
+	}
+	re := regexp.MustCompile(regexp.QuoteMeta(s))
+	min := m.selection.Min()
+	c := *m.cursor
+	c.SetBytePos(min)
+	n, ok := c.GotoNext(re)
+	if !ok {
+		n, _ = c.GotoFirst(re)
+	}
+	start := c.BytePos()
+	for _, cs := range m.cursorSels() {
+		if cs.selection.Min() == start {
+			m.err = fmt.Sprintf("no more matches: %v", s)
+			return
+		}
+	}
+	// keep the direction of the selection.
+	backward := m.cursor.BytePos() == min
+	m.pushCursor()
+	end := cell.Pt{start.L, start.O + n}
+	if backward {
+		m.selection.SetStart(end)
+		m.cursor.SetBytePos(start)
+	} else {
+		m.selection.SetStart(start)
+		m.cursor.SetBytePos(end)
+	}
+	m.selection.SetEnd(m.cursor.BytePos())
+}
+
+// addCursorVertically adds a cursor a line above the top cursor when d is negative,
+// or a line below the bottom cursor when d is positive.
+// The buffer's cursor moves to the new one, so the window follows it.
+func (m *NormalMode) addCursorVertically(d int) {
+	from := m.cursor
+	for _, cs := range m.extras {
+		if (d < 0 && cs.cursor.l < from.l) || (d > 0 && cs.cursor.l > from.l) {
+			from = cs.cursor
+		}
+	}
+	c := *from
+	if d < 0 {
+		c.MoveUp()
+	} else {
+		c.MoveDown()
+	}
+	if c.BytePos() == from.BytePos() {
+		return
+	}
+	m.pushCursor()
+	m.selection.on = false
+	*m.cursor = c
+}
+
+// splitSelection splits a multi-line selection into selections of each line, and each of them has a cursor.
+// A block selection is split into the parts of the lines.
+// The buffer's cursor goes to the last line.
+func (m *NormalMode) splitSelection() {
+	if !m.selection.on {
+		return
+	}
+	min, max := m.selection.MinMax()
+	ranges := make([]cell.Range, 0)
+	for _, l := range m.selection.Lines() {
+		start := cell.Pt{l, 0}
+		end := cell.Pt{l, m.text.lineLen(l)}
+		if m.selection.block {
+			start.O, end.O = m.selection.LineBlock(l)
+		} else {
+			if l == min.L {
+				start = min
+			}
+			if l == max.L {
+				end = max
+			}
+		}
+		ranges = append(ranges, cell.Range{Start: start, End: end})
+	}
+	for i, r := range ranges {
+		if i != 0 {
+			m.pushCursor()
+		}
+		m.selection.SetStart(r.Start)
+		m.selection.SetEnd(r.End)
+		m.cursor.SetBytePos(r.End)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/kybin/tor/cell"
+)
+
+// newTestNormalMode returns a normal mode that edits a text of lines.
+func newTestNormalMode(lines []string) *NormalMode {
+	m := &NormalMode{
+		Buffer: NewBuffer("test.go", NewText(lines)),
+		area:   NewArea(cell.Pt{}, cell.Pt{20, 80}),
+		keymap: NewKeymap(),
+	}
+	m.text.writable = true
+	m.text.tabWidth = 4
+	return m
+}
+
+// typeRunes handles key events of runes in s.
+func typeRunes(m *NormalMode, s string) {
+	for _, r := range s {
+		m.Handle(tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone))
+	}
+}
+
+func TestAddCursorAtNextMatch(t *testing.T) {
+	in := []string{"text := t.text", "if text != nil {", "}"}
+	m := newTestNormalMode(in)
+	m.cursor.SetBytePos(cell.Pt{0, 1})
+	for i := 0; i < 3; i++ {
+		m.do(&Action{kind: "cursors", value: "addNextMatch"})
+	}
+	if len(m.extras) != 2 || m.cursor.BytePos() != (cell.Pt{1, 7}) {
+		t.Fatalf("addNextMatch: got %v extra cursors, and the cursor at %v", len(m.extras), m.cursor.BytePos())
+	}
+	// the match at the first one again.
+	m.do(&Action{kind: "cursors", value: "addNextMatch"})
+	if len(m.extras) != 2 || m.err == "" {
+		t.Fatalf("addNextMatch: should not add a cursor at a match that has a cursor")
+	}
+	typeRunes(m, "txt")
+	want := "txt := t.txt\nif txt != nil {\n}"
+	if got := strings.Join(textLines(m.text), "\n"); got != want {
+		t.Fatalf("typing: got %q, want %q", got, want)
+	}
+	if m.history.Len() != 1 {
+		t.Fatalf("typing: got %v history groups, want 1", m.history.Len())
+	}
+	m.do(&Action{kind: "undo"})
+	if got := textLines(m.text); strings.Join(got, "\n") != strings.Join(in, "\n") {
+		t.Fatalf("undo: got %q, want %q", got, in)
+	}
+	if len(m.extras) != 0 {
+		t.Fatalf("undo: extra cursors should be cleared")
+	}
+}
+
+func TestAddCursorVertically(t *testing.T) {
+	m := newTestNormalMode([]string{"\ta := 1", "\tb := 2", "", "\tc := 3"})
+	m.cursor.SetBytePos(cell.Pt{0, 1})
+	for i := 0; i < 4; i++ {
+		m.do(&Action{kind: "cursors", value: "addBelow"})
+	}
+	if len(m.extras) != 3 {
+		t.Fatalf("addBelow: got %v extra cursors, want 3", len(m.extras))
+	}
+	m.do(&Action{kind: "cursors", value: "addAbove"})
+	if len(m.extras) != 3 {
+		t.Fatalf("addAbove: a cursor is added above the first line")
+	}
+	typeRunes(m, "x")
+	m.doAll(&Action{kind: "move", value: "eol"})
+	m.doAll(&Action{kind: "insertTab"})
+	m.doAll(&Action{kind: "backspace"})
+	want := "\t\txa := \n\t\txb := \n\t\n\t\txc := "
+	if got := strings.Join(textLines(m.text), "\n"); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestSplitSelection(t *testing.T) {
+	m := newTestNormalMode([]string{"one", "two", "three", "four"})
+	m.cursor.SetBytePos(cell.Pt{0, 1})
+	m.do(&Action{kind: "selection", value: "on"})
+	m.selection.SetEnd(cell.Pt{3, 0})
+	m.do(&Action{kind: "cursors", value: "splitSelection"})
+	if len(m.extras) != 2 {
+		t.Fatalf("splitSelection: got %v extra cursors, want 2", len(m.extras))
+	}
+	m.doAll(&Action{kind: "delete", value: "selection"})
+	m.doAll(&Action{kind: "insert", value: "-"})
+	want := "o-\n-\n-\nfour"
+	if got := strings.Join(textLines(m.text), "\n"); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -2,30 +2,46 @@ package main
 
 import (
 	"fmt"
-	"os/exec"
-	"strconv"
 	"strings"
 
 	"github.com/gdamore/tcell/v2"
-	"github.com/kybin/tor/syntax"
+	"github.com/kybin/tor/cell"
 )
 
 // NormalMode is a mode for text editing.
+// It edits it's current buffer.
 type NormalMode struct {
-	text      *Text
-	cursor    *Cursor
-	selection *Selection
-	history   *History
-	f         string
+	*Buffer
 
-	dirty  bool // dirty indicates if it is drawed after text edited
-	parser *syntax.Parser
+	// ring is the kill ring, recent copies and cuts. The latest one is the first.
+	ring []clip
+	// registers are named registers, those are copied into and pasted from by their names.
+	registers map[string]clip
+	// pasted is where the last event pasted a clip of the kill ring, or nil if it didn't.
+	// pasting is the one of the current event.
+	pasted  *pastedClip
+	pasting *pastedClip
+	// clipboard is the system clipboard that copies are shared with.
+	// It is nil when copies are only saved in config directory.
+	clipboard clipboard
 
-	copied string
 	status string
 	err    string
 
+	// lineNumbers is the line number mode of the gutter.
+	lineNumbers string
+
 	area *Area
+
+	// extras are cursors added besides the buffer's cursor, with their own selections.
+	// Editing actions are done at all of them.
+	extras []cursorSel
+
+	// keymap maps key chords to commands.
+	keymap *Keymap
+
+	// formatters format files when they are saved.
+	formatters []formatter
 }
 
 // Start prepare things to start a normal mode.
@@ -40,44 +56,68 @@ func (m *NormalMode) Handle(ev *tcell.EventKey) {
 	m.status = ""
 	m.err = ""
 
+	// the window could be resized, or could start to wrap lines after the last event.
+	for _, cs := range m.cursorSels() {
+		cs.cursor.wrapWidth = m.area.Win.WrapWidth()
+	}
+
+	m.handleActions(m.parseEvent(ev))
+}
+
+// readOnlyKinds are action kinds those are done even when the text is read-only.
+var readOnlyKinds = map[string]bool{
+	"move":        true,
+	"exit":        true,
+	"lineNumbers": true,
+	"wrap":        true,
+	"view":        true,
+	"cursors":     true,
+	"macro":       true,
+}
+
+// handleActions runs actions, and save them in history.
+func (m *NormalMode) handleActions(actions []*Action) {
+	m.pasting = nil
+	defer func() {
+		m.pasted = m.pasting
+	}()
 	rememberActions := make([]*Action, 0)
-	cut := false
-	actions := m.parseEvent(ev)
 	for _, a := range actions {
-		// in read-only mode, tor only accepts move and exit.
-		if !m.text.writable && a.kind != "move" && a.kind != "exit" {
+		// in read-only mode, tor only accepts actions those don't change the text.
+		if !m.text.writable && !readOnlyKinds[a.kind] {
 			continue
 		}
-		m.do(a)
-		a.text = m.text
+		m.doAll(a)
 		// delete selection usally don't delete anything.
-		if a.kind == "delete" && a.value == "" {
+		if a.kind == "delete" && a.value == "" && len(a.edits) == 0 {
 			continue
 		}
 		// skip action types that are not specified below.
 		switch a.kind {
-		case "insert", "paste", "delete", "backspace", "insertTab", "removeTab", "move":
+		case "insert", "autoIndent", "paste", "insertBlock", "killRing", "delete", "backspace", "insertTab", "removeTab", "toggleComment", "replaceAll", "filter", "move":
 			if a.kind != "move" {
+				// nothing changed, like replacing when there is no match.
+				if len(a.edits) == 0 {
+					continue
+				}
 				m.text.edited = true
-				m.dirty = true
-			}
-			nc := m.history.Cut(m.history.head)
-			if nc != 0 {
-				cut = true
 			}
 		default:
-			if a.kind == "unread" || a.kind == "redo" || a.kind == "save" {
-				m.dirty = true // maybe
+			if a.kind == "undo" || a.kind == "redo" || a.kind == "older" || a.kind == "newer" {
+				m.text.edited = true
+			}
+			// other actions are remembered only when they change the text,
+			// like reformatting after save.
+			if len(a.edits) == 0 {
+				continue
 			}
-			continue
 		}
 		// joining repeative same kind of actions.
 		if a.kind == "insert" || a.kind == "paste" || a.kind == "delete" || a.kind == "backspace" || a.kind == "move" {
 			var last *Action
 			if len(rememberActions) != 0 {
 				last = rememberActions[len(rememberActions)-1]
-			} else if !cut && m.history.Len() != 0 {
-				lastGroup := m.history.Last()
+			} else if lastGroup := m.history.Last(); lastGroup != nil {
 				last = lastGroup[len(lastGroup)-1]
 			}
 			if last != nil && a.kind == last.kind {
@@ -87,6 +127,7 @@ func (m *NormalMode) Handle(ev *tcell.EventKey) {
 					last.value = a.value + last.value
 				}
 				last.afterCursor = a.afterCursor
+				last.edits = append(last.edits, a.edits...)
 				continue
 			}
 		}
@@ -98,233 +139,36 @@ func (m *NormalMode) Handle(ev *tcell.EventKey) {
 }
 
 // parseEvent parses a terminal event and return actions.
+// Key chords bound in the keymap run their commands, and other runes are typed.
 func (m *NormalMode) parseEvent(ev *tcell.EventKey) []*Action {
-	switch ev.Key() {
-	case tcell.KeyCtrlQ:
-		return []*Action{{kind: "selection", value: "off"}, {kind: "exit"}}
-	case tcell.KeyCtrlS:
-		return []*Action{{kind: "selection", value: "off"}, {kind: "save"}}
-	case tcell.KeyCtrlK:
-		return []*Action{{kind: "selection", value: "off"}}
-	// move
-	case tcell.KeyLeft:
-		return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "left"}}
-	case tcell.KeyRight:
-		return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "right"}}
-	case tcell.KeyUp:
-		return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "up"}}
-	case tcell.KeyDown:
-		return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "down"}}
-	case tcell.KeyPgUp:
-		return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "pageup"}}
-	case tcell.KeyPgDn:
-		return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "pagedown"}}
-	case tcell.KeyHome:
-		return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "bol"}}
-	case tcell.KeyEnd:
-		return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "eol"}}
-	// insert
-	case tcell.KeyEnter:
-		return []*Action{{kind: "delete", value: "selection"}, {kind: "insert", value: "\n"}}
-	case tcell.KeyCtrlN:
-		if ev.Modifiers()&tcell.ModAlt != 0 {
-			return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "eol"}, {kind: "insert", value: "\n"}, {kind: "insert", value: "autoIndent"}}
-		}
-		return []*Action{{kind: "delete", value: "selection"}, {kind: "insert", value: "\n"}, {kind: "insert", value: "autoIndent"}}
-	case tcell.KeyTab:
-		tab := "\t"
-		if m.text.tabToSpace {
-			tab = strings.Repeat(" ", m.text.tabWidth)
-		}
-		return []*Action{{kind: "delete", value: "selection"}, {kind: "insert", value: tab}}
-	case tcell.KeyCtrlU:
-		return []*Action{{kind: "removeTab"}}
-	case tcell.KeyCtrlO:
-		return []*Action{{kind: "insertTab"}}
-	// delete : value will added after actual deletion.
-	case tcell.KeyDelete:
-		if m.selection.on {
-			return []*Action{{kind: "delete", value: "selection"}}
-		} else {
-			if ev.Modifiers()&tcell.ModAlt != 0 {
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "nextBowEow"}, {kind: "delete", value: "selection"}}
-			}
-			return []*Action{{kind: "delete"}}
-		}
-	case tcell.KeyBackspace, tcell.KeyBackspace2:
-		if m.selection.on {
-			return []*Action{{kind: "delete", value: "selection"}}
-		} else {
-			if ev.Modifiers()&tcell.ModAlt != 0 {
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "prevBowEow"}, {kind: "delete", value: "selection"}}
-			}
-			return []*Action{{kind: "backspace"}}
-		}
-	// undo, redo
-	case tcell.KeyCtrlZ:
-		return []*Action{{kind: "undo"}}
-	case tcell.KeyCtrlY:
-		return []*Action{{kind: "redo"}}
-	// copy, paste, cut
-	case tcell.KeyCtrlC:
-		if m.selection.on {
-			return []*Action{{kind: "copy"}, {kind: "selection", value: "off"}}
-		} else {
-			return []*Action{}
-		}
-	case tcell.KeyCtrlV:
-		if m.selection.on {
-			return []*Action{{kind: "delete", value: "selection"}, {kind: "insert", value: m.copied}}
-		}
-		return []*Action{{kind: "insert", value: m.copied}}
-	case tcell.KeyCtrlP:
-		if m.selection.on {
-			return []*Action{{kind: "delete", value: "selection"}, {kind: "paste", value: m.copied}}
-		}
-		return []*Action{{kind: "paste", value: m.copied}}
-	case tcell.KeyCtrlJ:
-		if m.selection.on {
-			return []*Action{{kind: "delete", value: "selection"}, {kind: "insert", value: tor.replace.str}}
-		}
+	if cmd := m.keymap.Command(ev); cmd != nil {
+		return cmd(m)
+	}
+	if ev.Key() != tcell.KeyRune || ev.Modifiers()&tcell.ModAlt != 0 {
 		return []*Action{}
-	case tcell.KeyCtrlX:
-		if m.selection.on {
-			return []*Action{{kind: "copy"}, {kind: "delete", value: "selection"}}
-		} else {
-			return []*Action{{kind: "copy"}, {kind: "delete"}}
-		}
-	// find
-	case tcell.KeyCtrlD, tcell.KeyF3:
-		return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "findNextSelect"}}
-	case tcell.KeyCtrlB, tcell.KeyF2:
-		return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "findPrevSelect"}}
-	case tcell.KeyCtrlF:
-		return []*Action{{kind: "modeChange", value: "find"}}
-	case tcell.KeyCtrlR:
-		return []*Action{{kind: "modeChange", value: "replace"}}
-	case tcell.KeyCtrlG:
-		return []*Action{{kind: "modeChange", value: "gotoline"}}
-	case tcell.KeyCtrlA:
-		return []*Action{{kind: "selectAll"}}
-	case tcell.KeyCtrlL:
-		return []*Action{{kind: "selectLine"}}
-	default:
-		if ev.Rune() == 0 {
-			return []*Action{}
-		}
-		if ev.Modifiers()&tcell.ModAlt != 0 {
-			switch ev.Rune() {
-			case 'j':
-				return []*Action{{kind: "move", value: "selLeft"}, {kind: "selection", value: "off"}}
-			case 'J':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "left"}}
-			case 'l':
-				return []*Action{{kind: "move", value: "selRight"}, {kind: "selection", value: "off"}}
-			case 'L':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "right"}}
-			case 'i':
-				return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "up"}}
-			case 'I':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "up"}}
-			case 'k':
-				return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "down"}}
-			case 'K':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "down"}}
-			case 'm':
-				return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "prevBowEow"}}
-			case 'M':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "prevBowEow"}}
-			case '.':
-				return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "nextBowEow"}}
-			case '>':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "nextBowEow"}}
-			case 'u':
-				return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "bocBolRepeat"}}
-			case 'U':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "bocBolRepeat"}}
-			case 'y':
-				return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "bol"}}
-			case 'Y':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "bol"}}
-			case 'o':
-				return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "eol"}}
-			case 'O':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "eol"}}
-			case 'w':
-				return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "pageup"}}
-			case 'W':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "pageup"}}
-			case 's':
-				return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "pagedown"}}
-			case 'S':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "pagedown"}}
-			case 'e':
-				return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "bof"}}
-			case 'E':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "bof"}}
-			case 'd':
-				return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "eof"}}
-			case 'D':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "eof"}}
-			case '1':
-				return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "prevGlobal"}}
-			case '!':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "prevGlobal"}}
-			case '2':
-				return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "nextGlobal"}}
-			case '@':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "nextGlobal"}}
-			case '9':
-				return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "prevGlobal"}}
-			case '(':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "prevGlobal"}}
-			case '0':
-				return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "nextGlobal"}}
-			case ')':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "nextGlobal"}}
-			case 'q':
-				return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "prevIndentMatch"}}
-			case 'Q':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "prevIndentMatch"}}
-			case 'a':
-				return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "nextIndentMatch"}}
-			case 'A':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "nextIndentMatch"}}
-			case ']', 'x':
-				return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "nextArg"}}
-			case '}', 'X':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "nextArg"}}
-			case '[', 'z':
-				return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "prevArg"}}
-			case '{', 'Z':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "prevArg"}}
-			case 'c':
-				return []*Action{{kind: "selection", value: "off"}, {kind: "move", value: "matchingBracket"}}
-			case 'C':
-				return []*Action{{kind: "selection", value: "on"}, {kind: "move", value: "matchingBracket"}}
-			default:
-				return []*Action{}
-			}
-		}
-
-		// key pressed without modifier
-		if m.selection.on {
-			return []*Action{{kind: "delete", value: "selection"}, {kind: "insert", value: string(ev.Rune())}}
-		} else {
-			return []*Action{{kind: "insert", value: string(ev.Rune())}}
-		}
 	}
+	// key pressed without modifier
+	if m.selection.on {
+		return []*Action{{kind: "delete", value: "selection"}, {kind: "insert", value: string(ev.Rune())}}
+	}
+	return []*Action{{kind: "insert", value: string(ev.Rune())}}
 }
 
 // do takes an action and do it.
 // After done the action, it will save result on the action.
 func (m *NormalMode) do(a *Action) {
 	a.beforeCursor = *m.cursor
+	mark := m.text.StartRecord()
 
 	defer func() {
+		a.edits = m.text.StopRecord(mark)
 		a.afterCursor = *m.cursor
 		if m.selection.on {
 			m.selection.SetEnd(m.cursor.BytePos())
+			if m.selection.block {
+				// the cursor keeps it's column, even on a shorter line.
+				m.selection.SetEndCol(m.cursor.o)
+			}
 		}
 	}()
 
@@ -332,68 +176,183 @@ func (m *NormalMode) do(a *Action) {
 	case "exit":
 		tor.ChangeMode(tor.exit)
 	case "save":
+		ft := findFormatter(m.formatters, m.f, m.lang)
+		// pre save, the text is formatted before it is written.
+		var preErr error
+		if ft != nil && len(ft.Pre) != 0 {
+			s, err := ft.runPre(string(m.text.Bytes()), m.f)
+			if err != nil {
+				preErr = err
+			} else {
+				m.format(s)
+			}
+		}
 		err := save(m.f, m.text)
 		if err != nil {
 			m.err = fmt.Sprintf("FAIL TO SAVE: %v", err)
 			return
 		}
 		m.text.edited = false
+		m.clearModified()
 		m.status = fmt.Sprintf("successfully saved: %v", m.f)
+		if preErr != nil {
+			m.formatFailed(preErr)
+			return
+		}
 
 		// post save
-		if strings.HasSuffix(m.f, ".go") {
-			cmdGroups := []cmdGroup{
-				{
-					kind: orCmdGroup,
-					cmds: []*exec.Cmd{
-						exec.Command("goimports", "-w", m.f),
-						exec.Command("go", "fmt", m.f),
-					},
-				},
-			}
-			for _, g := range cmdGroups {
-				out, err := g.CombinedOutput()
-				if err != nil {
-					outs := strings.Split(string(out), "\n")
-					if len(outs) == 0 {
-						m.err = fmt.Sprint(err)
-					} else {
-						m.err = outs[0]
-					}
-					return
-				}
+		if ft != nil && len(ft.Post) != 0 {
+			if err := ft.runPost(m.f); err != nil {
+				m.formatFailed(err)
+				return
 			}
-			// reload the file.
+			// reload the file, as edits. so reformatting could be undone.
 			text, err := read(m.f)
 			if err != nil {
 				m.err = fmt.Sprint(err)
 				return
 			}
-			m.text = text
-			m.cursor.text = text
-			m.selection.text = text
-			m.parser.SetText(text)
-			oldl := m.cursor.l
-			oldb := m.cursor.b
-			m.cursor.GotoLine(oldl)
-			m.cursor.SetCloseToB(oldb)
+			m.format(string(text.Bytes()))
+			m.clearModified()
 		}
 	case "copy":
-		if m.selection.on {
+		// copy to the kill ring, or to the named register of the value.
+		c := clip{Block: m.selection.on && m.selection.block}
+		if c.Block {
+			c.S = m.selection.Data()
+		} else if m.selection.on {
 			minc, maxc := m.selection.MinMax()
-			m.copied = m.text.DataInside(minc, maxc)
+			c.S = m.text.DataInside(minc, maxc)
 		} else {
 			r, _ := m.cursor.RuneAfter()
-			m.copied = string(r)
+			c.S = string(r)
 		}
-		saveConfig("copy", m.copied)
+		if a.value == "" {
+			m.pushRing(c)
+			m.copyToClipboard(c.S)
+			return
+		}
+		if !isRegister(a.value) {
+			m.err = fmt.Sprintf("invalid register: %v", a.value)
+			return
+		}
+		m.setRegister(a.value, c)
+		m.status = fmt.Sprintf("copied to register %v", a.value)
+	case "killRing":
+		switch a.value {
+		case "paste":
+			m.markPaste(false)
+		case "pasteKeepCursor":
+			m.markPaste(true)
+		case "cycle":
+			m.cycleRing()
+		}
+	case "filter":
+		if a.value == "" {
+			// other modes only know the buffer's cursor.
+			m.extras = nil
+			tor.ChangeMode(tor.filter)
+			return
+		}
+		m.filter(a.value)
+	case "register":
+		// other modes only know the buffer's cursor.
+		m.extras = nil
+		tor.register.startPrompt(a.value == "paste")
 	case "modeChange":
+		// other modes only know the buffer's cursor.
+		m.extras = nil
 		if a.value == "find" {
 			tor.ChangeMode(tor.find)
 		} else if a.value == "replace" {
 			tor.ChangeMode(tor.replace)
+		} else if a.value == "queryReplace" {
+			re, err := tor.find.Regexp()
+			if err != nil {
+				m.err = err.Error()
+				return
+			}
+			if re == nil {
+				m.err = "nothing to find"
+				return
+			}
+			tor.ChangeMode(tor.query)
 		} else if a.value == "gotoline" {
 			tor.ChangeMode(tor.gotoline)
+		} else if a.value == "buffer" {
+			tor.ChangeMode(tor.buffer)
+		} else if a.value == "open" {
+			tor.ChangeMode(tor.open)
+		} else if a.value == "history" {
+			tor.ChangeMode(tor.history)
+		}
+	case "replaceAll":
+		m.replaceAllFound()
+	case "highlight":
+		tor.find.highlight = a.value == "on"
+	case "lineNumbers":
+		if a.value == "toggle" {
+			m.lineNumbers = nextLineNumbers(m.lineNumbers)
+		} else {
+			m.lineNumbers = a.value
+		}
+		saveConfig(lineNumbersConfig, m.lineNumbers)
+	case "wrap":
+		w := m.area.Win
+		if a.value == "toggle" {
+			w.SetWrap(!w.wrap)
+		} else {
+			w.SetWrap(a.value == "on")
+		}
+		m.cursor.wrapWidth = w.WrapWidth()
+	case "view":
+		switch a.value {
+		case "splitRight":
+			tor.Split(true)
+		case "splitDown":
+			tor.Split(false)
+		case "close":
+			if !tor.CloseArea() {
+				m.err = "cannot close the last view"
+			}
+		case "next":
+			tor.FocusNext(1)
+		case "prev":
+			tor.FocusNext(-1)
+		case "grow":
+			tor.ResizeArea(1)
+		case "shrink":
+			tor.ResizeArea(-1)
+		}
+		m.cursor.wrapWidth = m.area.Win.WrapWidth()
+	case "macro":
+		switch a.value {
+		case "record":
+			if tor.macro.recording == "" {
+				tor.macro.startPrompt(false)
+				return
+			}
+			reg := tor.macro.recording
+			if err := tor.macro.stopRecord(); err != nil {
+				m.err = fmt.Sprintf("could not save macros: %v", err)
+				return
+			}
+			m.status = fmt.Sprintf("recorded macro %v", reg)
+		case "play":
+			tor.macro.startPrompt(true)
+		}
+	case "cursors":
+		switch a.value {
+		case "addNextMatch":
+			m.addCursorAtNextMatch()
+		case "addAbove":
+			m.addCursorVertically(-1)
+		case "addBelow":
+			m.addCursorVertically(1)
+		case "splitSelection":
+			m.splitSelection()
+		case "clear":
+			m.extras = nil
 		}
 	case "selection":
 		if a.value == "on" && !m.selection.on {
@@ -401,6 +360,16 @@ func (m *NormalMode) do(a *Action) {
 			m.selection.SetStart(m.cursor.BytePos())
 		} else if a.value == "off" {
 			m.selection.on = false
+		} else if a.value == "block" {
+			// a block selection has it's own cursors when it is deleted.
+			m.extras = nil
+			if !m.selection.on {
+				m.selection.on = true
+				m.selection.SetStart(m.cursor.BytePos())
+				m.selection.block = true
+			} else {
+				m.selection.block = !m.selection.block
+			}
 		}
 	case "move":
 		switch a.value {
@@ -469,71 +438,41 @@ func (m *NormalMode) do(a *Action) {
 		case "matchingBracket":
 			m.cursor.GotoMatchingBracket()
 		case "findPrev":
-			ok := m.cursor.GotoPrev(tor.find.str)
-			if !ok {
-				m.cursor.GotoLast(tor.find.str)
-			}
+			m.findMove(true, false)
 		case "findNext":
-			ok := m.cursor.GotoNext(tor.find.str)
-			if !ok {
-				m.cursor.GotoFirst(tor.find.str)
-			}
+			m.findMove(false, false)
 		case "findPrevWord":
-			m.cursor.GotoPrevWord(tor.find.str)
+			m.findWordMove(true)
 		case "findNextWord":
-			m.cursor.GotoNextWord(tor.find.str)
-		// TODO: "findPrevSelect" and "findNextSelect" are hack. make separate action.
+			m.findWordMove(false)
 		case "findPrevSelect":
-			ok := m.cursor.GotoPrev(tor.find.str)
-			if !ok {
-				ok = m.cursor.GotoLast(tor.find.str)
-			}
-			if ok {
-				m.selection.on = true
-				for range tor.find.str {
-					m.cursor.MoveRight()
-				}
-				m.selection.SetStart(m.cursor.BytePos())
-				for range tor.find.str {
-					m.cursor.MoveLeft()
-				}
-				m.selection.SetEnd(m.cursor.BytePos())
-			}
+			m.findMove(true, true)
 		case "findNextSelect":
-			ok := m.cursor.GotoNext(tor.find.str)
-			if !ok {
-				ok = m.cursor.GotoFirst(tor.find.str)
-			}
-			if ok {
-				m.selection.on = true
-				for range tor.find.str {
-					m.cursor.MoveRight()
-				}
-				m.selection.SetStart(m.cursor.BytePos())
-				for range tor.find.str {
-					m.cursor.MoveLeft()
-				}
-				m.selection.SetEnd(m.cursor.BytePos())
-			}
+			m.findMove(false, true)
 		default:
 			panic(fmt.Sprintln("what the..", a.value, "move?"))
 		}
 	case "insert":
-		if a.value == "autoIndent" {
-			prevline := m.text.lines[m.cursor.l-1].data
-			trimed := strings.TrimLeft(prevline, " \t")
-			indent := prevline[:len(prevline)-len(trimed)]
-			m.cursor.Insert(indent)
-			a.value = indent
-			return
-		}
 		m.cursor.Insert(a.value)
+		m.pastedAt(a.beforeCursor.BytePos(), m.cursor.BytePos())
+	case "autoIndent":
+		// inserts indentation of the previous line.
+		prevline := m.text.LineData(m.cursor.l - 1)
+		trimed := strings.TrimLeft(prevline, " \t")
+		m.cursor.Insert(prevline[:len(prevline)-len(trimed)])
 	case "paste":
 		c := *m.cursor
 		m.cursor.Insert(a.value)
+		m.pastedAt(c.BytePos(), m.cursor.BytePos())
 		m.cursor.Copy(c)
+	case "insertBlock":
+		m.insertBlock(a.value)
 	case "delete":
 		if a.value == "selection" {
+			if m.selection.on && m.selection.block {
+				a.value = m.deleteBlock()
+				return
+			}
 			if m.selection.on {
 				m.cursor.SetBytePos(m.selection.Min())
 				a.beforeCursor = *m.cursor // rewrite before cursor.
@@ -561,56 +500,25 @@ func (m *NormalMode) do(a *Action) {
 		} else {
 			lines = append(lines, m.cursor.l)
 		}
-		tabedLine := ""
-		for _, l := range lines {
-			m.text.Line(l).Insert(tab, 0)
-			if tabedLine != "" {
-				tabedLine += ","
-			}
-			tabedLine += strconv.Itoa(l) + ":" + tab
-			if l == m.cursor.l {
-				m.cursor.SetB(m.cursor.b + len(tab))
-			}
-		}
-		a.value = tabedLine
+		m.applyPrefix(indentLines(lines, tab))
 	case "removeTab":
-		// removeTab is slightly differ from insertTab.
-		// removeTab should remember what is removed, not tab string it self.
 		lines := make([]int, 0)
 		if m.selection.on {
 			lines = m.selection.Lines()
 		} else {
 			lines = append(lines, m.cursor.l)
 		}
-		untabedLine := ""
-		for _, l := range lines {
-			removed := ""
-			if strings.HasPrefix(m.text.Line(l).data, "\t") {
-				removed += m.text.Line(l).Remove(0, 1)
-			} else {
-				for i := 0; i < m.text.tabWidth; i++ {
-					if len(m.text.Line(l).data) == 0 {
-						break
-					}
-					if !strings.HasPrefix(m.text.Line(l).data, " ") {
-						break
-					}
-					removed += m.text.Line(l).Remove(0, 1)
-				}
-			}
-			if untabedLine != "" {
-				untabedLine += ","
-			}
-			untabedLine += strconv.Itoa(l) + ":" + removed
-			if l == m.cursor.l && !m.cursor.AtBol() {
-				b := m.cursor.b - len(removed)
-				if b < 0 {
-					b = 0
-				}
-				m.cursor.SetB(b)
-			}
+		m.applyPrefix(unindentLines(m.text, lines))
+	case "toggleComment":
+		if m.comment == "" {
+			m.err = "don't know how to comment in this file"
+			return
+		}
+		lines := []int{m.cursor.l}
+		if m.selection.on {
+			lines = m.selection.Lines()
 		}
-		a.value = untabedLine
+		m.applyPrefix(toggleComment(m.comment, m.text, lines))
 	case "backspace":
 		a.value = m.cursor.Backspace()
 	case "selectAll":
@@ -628,180 +536,160 @@ func (m *NormalMode) do(a *Action) {
 		if m.cursor.OnLastLine() {
 			m.cursor.MoveEol()
 		} else {
-			m.cursor.MoveDown()
+			// not MoveDown, that moves by rows when lines are wrapped.
+			m.cursor.SetBytePos(cell.Pt{m.cursor.l + 1, 0})
 		}
 		m.selection.SetEnd(m.cursor.BytePos())
 	case "selectWord":
-		if !m.cursor.AtBow() {
-			m.cursor.MovePrevBowEow()
-		}
-		if !m.selection.on {
-			m.selection.on = true
-			m.selection.SetStart(m.cursor.BytePos())
-		}
-		m.cursor.MoveNextBowEow()
-		m.selection.SetEnd(m.cursor.BytePos())
+		m.selectWord()
 	case "undo":
-		// TODO: Move to history.Undo()
-		if m.history.head == 0 {
+		c, ok := m.history.Undo(m.text)
+		if !ok {
 			return
 		}
 		m.selection.on = false
-		m.history.head--
-		undoActions := m.history.At(m.history.head)
-		for i := len(undoActions) - 1; i >= 0; i-- {
-			u := undoActions[i]
-			m.text = u.text
-			m.cursor.text = u.text
-			m.selection.text = u.text
-			m.parser.SetText(u.text)
-			switch u.kind {
-			case "insert":
-				m.cursor.Copy(u.afterCursor)
-				for range u.value {
-					m.cursor.Backspace()
-				}
-			case "paste":
-				m.cursor.Copy(u.afterCursor)
-				for range u.value {
-					m.cursor.Delete()
-				}
-			case "insertTab":
-				lineInfos := strings.Split(u.value, ",")
-				for _, li := range lineInfos {
-					if li == "" {
-						continue
-					}
-					lis := strings.Split(li, ":")
-					lstr := lis[0]
-					tab := lis[1]
-					l, err := strconv.Atoi(lstr)
-					if err != nil {
-						panic(err)
-					}
-					for _, r := range tab {
-						rr := m.text.Line(l).Remove(0, 1)
-						if rr != string(r) {
-							panic("removed and current is not matched")
-						}
-					}
-				}
-				m.cursor.Copy(u.beforeCursor)
-			case "backspace":
-				m.cursor.Copy(u.afterCursor)
-				m.cursor.Insert(u.value)
-			case "delete":
-				m.cursor.Copy(u.afterCursor)
-				m.cursor.Insert(u.value)
-			case "removeTab":
-				lineInfos := strings.Split(u.value, ",")
-				for _, li := range lineInfos {
-					if li == "" {
-						continue
-					}
-					lis := strings.Split(li, ":")
-					lstr := lis[0]
-					removed := lis[1]
-					l, err := strconv.Atoi(lstr)
-					if err != nil {
-						panic(err)
-					}
-					m.text.Line(l).Insert(removed, 0)
-				}
-				m.cursor.Copy(u.beforeCursor)
-			case "move":
-				m.cursor.Copy(u.beforeCursor)
-			default:
-				panic(fmt.Sprintln("what the..", u.kind, "history?"))
-			}
-		}
+		m.extras = nil
+		m.cursor.Copy(c)
 	case "redo":
-		// TODO: Move to history.Redo()
-		if m.history.head == m.history.Len() {
+		c, ok := m.history.Redo(m.text)
+		if !ok {
 			return
 		}
 		m.selection.on = false
-		redoActions := m.history.At(m.history.head)
-		m.history.head++
-		for _, r := range redoActions {
-			m.text = r.text
-			m.cursor.text = r.text
-			m.selection.text = r.text
-			m.parser.SetText(r.text)
-
-			switch r.kind {
-			case "insert":
-				m.cursor.Copy(r.beforeCursor)
-				m.cursor.Insert(r.value)
-			case "paste":
-				m.cursor.Copy(r.beforeCursor)
-				m.cursor.Insert(r.value)
-				m.cursor.Copy(r.beforeCursor)
-			case "insertTab":
-				lineInfos := strings.Split(r.value, ",")
-				for _, li := range lineInfos {
-					if li == "" {
-						continue
-					}
-					lis := strings.Split(li, ":")
-					lstr := lis[0]
-					tab := lis[1]
-					l, err := strconv.Atoi(lstr)
-					if err != nil {
-						panic(err)
-					}
-					m.text.Line(l).Insert(tab, 0)
-				}
-				m.cursor.Copy(r.afterCursor)
-			case "backspace":
-				m.cursor.Copy(r.beforeCursor)
-				for range r.value {
-					m.cursor.Backspace()
-				}
-			case "delete":
-				m.cursor.Copy(r.beforeCursor)
-				for range r.value {
-					m.cursor.Delete()
-				}
-			case "removeTab":
-				lineInfos := strings.Split(r.value, ",")
-				for _, li := range lineInfos {
-					if li == "" {
-						continue
-					}
-					lis := strings.Split(li, ":")
-					lstr := lis[0]
-					removed := lis[1]
-					l, err := strconv.Atoi(lstr)
-					if err != nil {
-						panic(err)
-					}
-					for _, r := range removed {
-						rr := m.text.Line(l).Remove(0, 1)
-						if rr != string(r) {
-							panic("removed and current is not matched")
-						}
-					}
-				}
-				m.cursor.Copy(r.afterCursor)
-			case "move":
-				m.cursor.Copy(r.afterCursor)
-			default:
-				panic(fmt.Sprintln("what the..", r.kind, "history?"))
-			}
+		m.extras = nil
+		m.cursor.Copy(c)
+	case "older", "newer":
+		m.extras = nil
+		n := m.history.Older()
+		if a.kind == "newer" {
+			n = m.history.Newer()
 		}
+		if n == nil {
+			return
+		}
+		m.selection.on = false
+		m.travel(n)
+		m.status = fmt.Sprintf("history state #%v, %v", n.seq, n.time.Format("15:04:05"))
 	default:
 		panic(fmt.Sprintln("what the..", a.kind, "action?"))
 	}
 }
 
+// selectWord selects the word at the cursor, or extends the selection to the end of the word.
+func (m *NormalMode) selectWord() {
+	if !m.cursor.AtBow() {
+		m.cursor.MovePrevBowEow()
+	}
+	if !m.selection.on {
+		m.selection.on = true
+		m.selection.SetStart(m.cursor.BytePos())
+	}
+	m.cursor.MoveNextBowEow()
+	m.selection.SetEnd(m.cursor.BytePos())
+}
+
+// applyPrefix applies a prefix edit to the text.
+// The cursor keeps it's position relative to the text around it.
+func (m *NormalMode) applyPrefix(e prefixEdit) {
+	m.text.Apply(e)
+	for _, p := range e.prefixes {
+		if p.l != m.cursor.l || m.cursor.b < p.b {
+			continue
+		}
+		if e.remove {
+			b := m.cursor.b - len(p.s)
+			if b < p.b {
+				b = p.b
+			}
+			m.cursor.SetB(b)
+		} else {
+			m.cursor.SetB(m.cursor.b + len(p.s))
+		}
+	}
+}
+
+// travel changes the text to the state of history node n.
+func (m *NormalMode) travel(n *historyNode) {
+	if c, ok := m.history.Travel(m.text, n); ok {
+		m.cursor.Copy(c)
+	}
+}
+
+// findMove moves the cursor to the prev or next match of the find mode's string.
+// When it reaches at the end of text, it will continue from the other end.
+// If sel is true, it will select the match.
+func (m *NormalMode) findMove(prev, sel bool) {
+	re, err := tor.find.Regexp()
+	if err != nil {
+		m.err = err.Error()
+		return
+	}
+	if re == nil {
+		return
+	}
+	var n int
+	var ok bool
+	if prev {
+		n, ok = m.cursor.GotoPrev(re)
+		if !ok {
+			n, ok = m.cursor.GotoLast(re)
+		}
+	} else {
+		n, ok = m.cursor.GotoNext(re)
+		if !ok {
+			n, ok = m.cursor.GotoFirst(re)
+		}
+	}
+	if !ok {
+		m.err = fmt.Sprintf("not found: %v", tor.find.str)
+		return
+	}
+	if sel {
+		m.selection.on = true
+		m.selection.SetStart(cell.Pt{m.cursor.l, m.cursor.b + n})
+		m.selection.SetEnd(m.cursor.BytePos())
+	}
+	tor.find.highlight = true
+	m.status = fmt.Sprintf("%v:%v:%v %v", m.f, m.cursor.l+1, m.cursor.O()+1, matchCounter(m.text, re, m.cursor.BytePos()))
+}
+
+// findWordMove moves the cursor to the previous or next match of the find mode's string,
+// that is a whole word. Other options of the find mode are kept.
+// Unlike findMove, it doesn't go around the text.
+func (m *NormalMode) findWordMove(prev bool) {
+	re, err := tor.find.WordRegexp()
+	if err != nil {
+		m.err = err.Error()
+		return
+	}
+	if re == nil {
+		return
+	}
+	var ok bool
+	if prev {
+		_, ok = m.cursor.GotoPrev(re)
+	} else {
+		_, ok = m.cursor.GotoNext(re)
+	}
+	if !ok {
+		m.err = fmt.Sprintf("not found: %v", tor.find.str)
+	}
+}
+
 // Status returns a status as string.
 // The status will cleared when normal mode takes another event.
 func (m *NormalMode) Status() string {
 	if m.status != "" {
 		return m.status
 	}
-	return fmt.Sprintf("%v:%v:%v", m.f, m.cursor.l+1, m.cursor.O()+1)
+	status := fmt.Sprintf("%v:%v:%v", m.f, m.cursor.l+1, m.cursor.O()+1)
+	if len(m.extras) != 0 {
+		status += fmt.Sprintf(" (%v cursors)", len(m.extras)+1)
+	}
+	if tor != nil && tor.macro != nil && tor.macro.recording != "" {
+		status += fmt.Sprintf(" (recording %v)", tor.macro.recording)
+	}
+	return status
 }
 
 // Error returns an error of the last done action.
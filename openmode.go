@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// OpenMode is a mode for opening a file as a new buffer.
+// The file is given as same form with command line file arg,
+// which is "filepath[:line[:offset]]".
+type OpenMode struct {
+	farg string
+	err  string
+}
+
+func (m *OpenMode) Start() {
+	m.farg = ""
+	m.err = ""
+}
+
+func (m *OpenMode) End() {}
+
+func (m *OpenMode) Handle(ev *tcell.EventKey) {
+	m.err = ""
+	switch ev.Key() {
+	case tcell.KeyEsc, tcell.KeyCtrlK:
+		tor.ChangeMode(tor.normal)
+	case tcell.KeyEnter:
+		if m.farg == "" {
+			tor.ChangeMode(tor.normal)
+			return
+		}
+		f, l, o := parseFileArg(m.farg)
+		for _, b := range tor.buffers {
+			if b.samePath(f) {
+				if l != -1 {
+					b.cursor.GotoLine(l)
+					b.cursor.SetCloseToB(o)
+				}
+				tor.SwitchBuffer(b)
+				tor.ChangeMode(tor.normal)
+				return
+			}
+		}
+		b, err := openBuffer(m.farg, false)
+		if err != nil {
+			m.err = fmt.Sprint(err)
+			return
+		}
+		tor.SwitchBuffer(tor.AddBuffer(b))
+		tor.ChangeMode(tor.normal)
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if m.farg == "" {
+			return
+		}
+		_, rlen := utf8.DecodeLastRuneInString(m.farg)
+		m.farg = m.farg[:len(m.farg)-rlen]
+	default:
+		if ev.Modifiers()&tcell.ModAlt != 0 {
+			return
+		}
+		if ev.Rune() != 0 {
+			m.farg += string(ev.Rune())
+		}
+	}
+}
+
+func (m *OpenMode) Status() string {
+	return fmt.Sprintf("open : %v", m.farg)
+}
+
+func (m *OpenMode) Error() string {
+	return m.err
+}
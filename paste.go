@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// pasteKey adds a key event of a bracketed paste to the pasted string.
+// Keys in a paste are pasted as they are, instead of running commands.
+// Control keys except newlines and tabs are dropped.
+func pasteKey(b *strings.Builder, ev *tcell.EventKey) {
+	switch ev.Key() {
+	case tcell.KeyRune:
+		b.WriteRune(ev.Rune())
+	case tcell.KeyCR:
+		b.WriteString("\r")
+	case tcell.KeyLF:
+		b.WriteString("\n")
+	case tcell.KeyTab:
+		b.WriteString("\t")
+	}
+}
+
+// pasteString converts newlines of a pasted string to "\n".
+// Terminals send newlines as "\r" in a paste, and some texts have "\r\n".
+func pasteString(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\r", "\n")
+}
+
+// HandlePaste lets the current mode handle a string of a bracketed paste.
+// Normal mode inserts it at once, so auto-indent or other commands are not run by it's keys,
+// and undo reverts the whole paste. Other modes take the first line as typed runes.
+//
+// The paste is recorded to a macro as a whole, as keys of it don't go through HandleKey.
+func (t *Tor) HandlePaste(s string) {
+	s = pasteString(s)
+	if t.recordingMacro() {
+		defer t.macro.recordPaste(s)
+	}
+	if t.current == t.normal {
+		m := t.normal
+		m.status = ""
+		m.err = ""
+		if !m.text.writable {
+			return
+		}
+		// typing before or after is not joined to the paste.
+		m.history.Cut()
+		m.handleActions(pasteActions(m, clip{S: s}, false))
+		m.history.Cut()
+		return
+	}
+	line := strings.SplitN(s, "\n", 2)[0]
+	for _, r := range line {
+		t.current.Handle(tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone))
+	}
+}
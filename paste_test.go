@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/kybin/tor/cell"
+)
+
+func TestHandlePaste(t *testing.T) {
+	b := NewBuffer("a.go", NewText([]string{"\tx := 1", ""}))
+	b.text.writable = true
+	setTestTor(t, 80, 24, b)
+	tor.normal.keymap = NewKeymap()
+	tor.current = tor.normal
+	b.cursor.SetBytePos(cell.Pt{0, 7})
+	typeRunes(tor.normal, "!")
+
+	var p strings.Builder
+	for _, ev := range []*tcell.EventKey{
+		tcell.NewEventKey(tcell.KeyCR, 0, tcell.ModNone),
+		tcell.NewEventKey(tcell.KeyTab, 0, tcell.ModNone),
+		tcell.NewEventKey(tcell.KeyRune, 'y', tcell.ModNone),
+		// ctrl+j is a newline in a paste, not the replace command.
+		tcell.NewEventKey(tcell.KeyLF, 0, tcell.ModNone),
+		tcell.NewEventKey(tcell.KeyRune, 'z', tcell.ModNone),
+	} {
+		pasteKey(&p, ev)
+	}
+	tor.HandlePaste(p.String())
+	typeRunes(tor.normal, "?")
+	want := "\tx := 1!\n\ty\nz?\n"
+	if got := strings.Join(textLines(b.text), "\n"); got != want {
+		t.Fatalf("paste: got %q, want %q", got, want)
+	}
+	// the paste is a group, not joined to typing before and after.
+	if got := b.history.Len(); got != 3 {
+		t.Fatalf("paste: got %v history groups, want 3", got)
+	}
+	tor.normal.do(&Action{kind: "undo"})
+	tor.normal.do(&Action{kind: "undo"})
+	if got, want := strings.Join(textLines(b.text), "\n"), "\tx := 1!\n"; got != want {
+		t.Fatalf("undo: got %q, want %q", got, want)
+	}
+}
+
+func TestHandlePasteLiteral(t *testing.T) {
+	b := NewBuffer("a.go", NewText([]string{"\tx := 1", ""}))
+	b.text.writable = true
+	setTestTor(t, 80, 24, b)
+	tor.normal.keymap = NewKeymap()
+	tor.current = tor.normal
+	b.cursor.SetBytePos(cell.Pt{1, 0})
+	// pasted text is inserted as is, even if it looks like an action value.
+	tor.HandlePaste("autoIndent")
+	want := "\tx := 1\nautoIndent"
+	if got := strings.Join(textLines(b.text), "\n"); got != want {
+		t.Fatalf("paste: got %q, want %q", got, want)
+	}
+}
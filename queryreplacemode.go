@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/kybin/tor/cell"
+)
+
+// QueryReplaceMode is a mode for replacing matches of the find mode's string
+// one by one. It asks whether to replace each match.
+//
+// All replacements made in the mode are remembered as a history group,
+// so they could be undone at once.
+type QueryReplaceMode struct {
+	re     *regexp.Regexp
+	repl   string
+	expand bool
+
+	// tailLines and tailBytes are the distance from the end of the range to the end of text.
+	// Replacements are made before the range end, so they are not changed while replacing.
+	tailLines int
+	tailBytes int
+
+	// l and match are the line and submatch index of the current match.
+	l     int
+	match []int
+
+	// before is the cursor when the mode started.
+	before   Cursor
+	edits    []edit
+	replaced int
+}
+
+func (m *QueryReplaceMode) Start() {
+	nm := tor.normal
+	// do already checked the regexp is valid.
+	m.re, _ = tor.find.Regexp()
+	m.repl = tor.replace.str
+	m.expand = tor.find.regex
+	m.before = *nm.cursor
+	m.edits = make([]edit, 0)
+	m.replaced = 0
+
+	min, max := nm.replaceRange(m.re, nm.cursor.BytePos())
+	m.tailLines = nm.text.NumLines() - 1 - max.L
+	m.tailBytes = len(nm.text.LineData(max.L)) - max.O
+	tor.find.highlight = true
+	m.next(min)
+}
+
+func (m *QueryReplaceMode) End() {}
+
+// end returns the end of the range for replacing.
+func (m *QueryReplaceMode) end() cell.Pt {
+	text := tor.normal.text
+	l := text.NumLines() - 1 - m.tailLines
+	return cell.Pt{l, len(text.LineData(l)) - m.tailBytes}
+}
+
+// next finds a match that starts at or after p, and selects it.
+// If there is no more match, it will finish the mode.
+func (m *QueryReplaceMode) next(p cell.Pt) {
+	nm := tor.normal
+	end := m.end()
+	for l := p.L; l <= end.L; l++ {
+		b := 0
+		if l == p.L {
+			b = p.O
+		}
+		match := matchAfter(m.re, nm.text.LineData(l), b)
+		if match == nil {
+			continue
+		}
+		if l == end.L && match[1] > end.O {
+			break
+		}
+		m.l, m.match = l, match
+		nm.cursor.SetBytePos(cell.Pt{l, match[0]})
+		nm.selection.on = true
+		nm.selection.SetStart(cell.Pt{l, match[1]})
+		nm.selection.SetEnd(cell.Pt{l, match[0]})
+		return
+	}
+	m.finish()
+}
+
+// replace replaces the current match, and returns where the replacement ends.
+func (m *QueryReplaceMode) replace() cell.Pt {
+	nm := tor.normal
+	nm.selection.on = false
+	r := expandReplace(m.re, m.repl, m.expand, nm.text.LineData(m.l), m.match)
+	m.edits = append(m.edits, nm.replaceMatch(m.l, m.match[0], m.match[1], r)...)
+	m.replaced++
+	return nm.cursor.BytePos()
+}
+
+// finish remembers the replacements and goes back to the normal mode.
+func (m *QueryReplaceMode) finish() {
+	nm := tor.normal
+	nm.selection.on = false
+	if len(m.edits) != 0 {
+		nm.remember([]*Action{{kind: "queryReplace", beforeCursor: m.before, afterCursor: *nm.cursor, edits: m.edits}})
+	}
+	m.edits = nil
+	tor.ChangeMode(tor.normal)
+	nm.status = fmt.Sprintf("replaced %v matches", m.replaced)
+}
+
+func (m *QueryReplaceMode) Handle(ev *tcell.EventKey) {
+	switch ev.Key() {
+	case tcell.KeyEsc, tcell.KeyCtrlK:
+		m.finish()
+		return
+	}
+	switch ev.Rune() {
+	case 'y', ' ':
+		m.next(m.replace())
+	case 'n':
+		m.next(cell.Pt{m.l, m.match[1]})
+	case 'a', '!':
+		for tor.current == m {
+			m.next(m.replace())
+		}
+	case 'q':
+		m.finish()
+	}
+}
+
+func (m *QueryReplaceMode) Status() string {
+	return fmt.Sprintf("replace with %q? (y)es (n)o (a)ll (q)uit [%v replaced]", m.repl, m.replaced)
+}
+
+func (m *QueryReplaceMode) Error() string {
+	return ""
+}
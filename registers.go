@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/kybin/tor/cell"
+)
+
+// killRingFile and registersFile are config files those keep copied strings.
+// The latest copy is also saved to the "copy" file.
+const (
+	killRingFile  = "killring.json"
+	registersFile = "registers.json"
+)
+
+// maxKillRing is how many copies the kill ring keeps at most.
+const maxKillRing = 30
+
+// clip is a copied string.
+// Block indicates it is copied from a block selection, so it is pasted as a block.
+type clip struct {
+	S     string `json:"s"`
+	Block bool   `json:"block,omitempty"`
+}
+
+// pastedClip is where a clip of the kill ring is pasted.
+// Cycling the kill ring replaces it with an older clip.
+type pastedClip struct {
+	index int // index of the clip in the kill ring.
+	start cell.Pt
+	end   cell.Pt
+	// keepCursor indicates the cursor stays at the start after pasting.
+	keepCursor bool
+	done       bool
+}
+
+// isRegister returns true if s is a name of a named register, a to z.
+func isRegister(s string) bool {
+	return len(s) == 1 && s[0] >= 'a' && s[0] <= 'z'
+}
+
+// loadKillRing loads the kill ring from killRingFile.
+// When there is no kill ring yet, it starts from the "copy" file.
+func loadKillRing() []clip {
+	s := loadConfig(killRingFile)
+	if s == "" {
+		if copied := loadConfig("copy"); copied != "" {
+			return []clip{{S: copied}}
+		}
+		return nil
+	}
+	var ring []clip
+	if err := json.Unmarshal([]byte(s), &ring); err != nil {
+		return nil
+	}
+	return ring
+}
+
+// loadRegisters loads the named registers from registersFile.
+// On any error, the registers will be empty.
+func loadRegisters() map[string]clip {
+	registers := make(map[string]clip)
+	s := loadConfig(registersFile)
+	if s == "" {
+		return registers
+	}
+	if err := json.Unmarshal([]byte(s), &registers); err != nil {
+		return make(map[string]clip)
+	}
+	return registers
+}
+
+// saveJSON saves v as json to ~/.config/tor/{fname} file.
+func saveJSON(fname string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	return saveConfig(fname, string(data))
+}
+
+// copied returns the latest copy in the kill ring.
+func (m *NormalMode) copied() clip {
+	if len(m.ring) == 0 {
+		return clip{}
+	}
+	return m.ring[0]
+}
+
+// pushRing adds c to the front of the kill ring, and saves it.
+func (m *NormalMode) pushRing(c clip) {
+	if len(m.ring) == 0 || m.ring[0] != c {
+		m.ring = append([]clip{c}, m.ring...)
+		if len(m.ring) > maxKillRing {
+			m.ring = m.ring[:maxKillRing]
+		}
+	}
+	saveConfig("copy", c.S)
+	if err := saveJSON(killRingFile, m.ring); err != nil {
+		m.err = fmt.Sprintf("could not save the kill ring: %v", err)
+	}
+}
+
+// setRegister sets the named register, and saves the registers.
+func (m *NormalMode) setRegister(name string, c clip) {
+	if m.registers == nil {
+		m.registers = make(map[string]clip)
+	}
+	m.registers[name] = c
+	if err := saveJSON(registersFile, m.registers); err != nil {
+		m.err = fmt.Sprintf("could not save registers: %v", err)
+	}
+}
+
+// pasteActions returns actions those paste c.
+// A block is pasted at the cursor's column of the lines.
+// When keepCursor is true, the cursor stays at the start of the pasted string.
+func pasteActions(m *NormalMode, c clip, keepCursor bool) []*Action {
+	if c.Block {
+		return []*Action{{kind: "delete", value: "selection"}, {kind: "insertBlock", value: c.S}}
+	}
+	kind := "insert"
+	if keepCursor {
+		kind = "paste"
+	}
+	if m.selection.on {
+		return []*Action{{kind: "delete", value: "selection"}, {kind: kind, value: c.S}}
+	}
+	return []*Action{{kind: kind, value: c.S}}
+}
+
+// markPaste marks the following insertion as a paste of the latest copy, so the kill ring could cycle it.
+// It is not marked with extra cursors, as they paste at several places.
+func (m *NormalMode) markPaste(keepCursor bool) {
+	if len(m.extras) != 0 {
+		return
+	}
+	m.pasting = &pastedClip{keepCursor: keepCursor}
+}
+
+// pastedAt remembers start and end of the marked paste, after the insertion.
+func (m *NormalMode) pastedAt(start, end cell.Pt) {
+	if m.pasting == nil || m.pasting.done {
+		return
+	}
+	m.pasting.start = start
+	m.pasting.end = end
+	m.pasting.done = true
+}
+
+// cycleRing replaces the text pasted by the last event with the next older clip of the kill ring.
+// Block clips are skipped, as they are not pasted as a string.
+func (m *NormalMode) cycleRing() {
+	p := m.pasted
+	if p == nil || !p.done || p.index >= len(m.ring) {
+		m.err = "paste first to cycle the kill ring"
+		return
+	}
+	if m.text.DataInside(p.start, p.end) != m.ring[p.index].S {
+		m.err = "pasted text is changed"
+		return
+	}
+	next := -1
+	for i := 1; i < len(m.ring); i++ {
+		j := (p.index + i) % len(m.ring)
+		if !m.ring[j].Block {
+			next = j
+			break
+		}
+	}
+	if next < 0 {
+		m.err = "no other copy in the kill ring"
+		return
+	}
+	m.selection.on = false
+	m.cursor.SetBytePos(p.start)
+	for range m.ring[p.index].S {
+		m.cursor.Delete()
+	}
+	m.cursor.Insert(m.ring[next].S)
+	end := m.cursor.BytePos()
+	if p.keepCursor {
+		m.cursor.SetBytePos(p.start)
+	}
+	m.pasting = &pastedClip{index: next, start: p.start, end: end, keepCursor: p.keepCursor, done: true}
+	m.status = fmt.Sprintf("kill ring %v/%v", next+1, len(m.ring))
+}
+
+// RegisterMode is a prompt that takes a named register to copy into, or to paste from.
+type RegisterMode struct {
+	// paste indicates the prompt is for pasting, not for copying.
+	paste bool
+	err   string
+}
+
+// startPrompt starts the prompt for pasting when paste is true, or for copying.
+func (m *RegisterMode) startPrompt(paste bool) {
+	m.paste = paste
+	tor.ChangeMode(m)
+}
+
+func (m *RegisterMode) Start() {
+	m.err = ""
+}
+
+func (m *RegisterMode) End() {}
+
+func (m *RegisterMode) Handle(ev *tcell.EventKey) {
+	switch ev.Key() {
+	case tcell.KeyEsc, tcell.KeyCtrlK:
+		tor.ChangeMode(tor.normal)
+	case tcell.KeyRune:
+		name := string(ev.Rune())
+		if !isRegister(name) {
+			m.err = "register should be one of a to z"
+			return
+		}
+		n := tor.normal
+		tor.ChangeMode(n)
+		n.status = ""
+		n.err = ""
+		if !m.paste {
+			n.handleActions([]*Action{{kind: "copy", value: name}, {kind: "selection", value: "off"}})
+			return
+		}
+		c, ok := n.registers[name]
+		if !ok {
+			n.err = fmt.Sprintf("register %v is empty", name)
+			return
+		}
+		n.handleActions(pasteActions(n, c, false))
+	}
+}
+
+func (m *RegisterMode) Status() string {
+	if m.paste {
+		return "paste from register : "
+	}
+	return "copy to register : "
+}
+
+func (m *RegisterMode) Error() string {
+	return m.err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kybin/tor/cell"
+)
+
+// selectRange selects text from start to end, and the cursor goes to the end.
+func selectRange(m *NormalMode, start, end cell.Pt) {
+	m.selection.on = true
+	m.selection.SetStart(start)
+	m.cursor.SetBytePos(end)
+	m.selection.SetEnd(end)
+}
+
+func TestKillRing(t *testing.T) {
+	useTempConfigDir(t)
+
+	m := newTestNormalMode([]string{"one two", ""})
+	selectRange(m, cell.Pt{0, 0}, cell.Pt{0, 3})
+	m.handleActions(commands["copy"](m))
+	selectRange(m, cell.Pt{0, 4}, cell.Pt{0, 7})
+	m.handleActions(commands["copy"](m))
+	if got := loadKillRing(); len(got) != 2 || got[0].S != "two" || loadConfig("copy") != "two" {
+		t.Fatalf("copy: got kill ring %v, want [two one]", got)
+	}
+
+	m.cursor.SetBytePos(cell.Pt{1, 0})
+	m.handleActions(commands["paste"](m))
+	m.handleActions(commands["cycleKillRing"](m))
+	if got := m.text.LineData(1); got != "one" {
+		t.Fatalf("cycle: got %q, want %q", got, "one")
+	}
+	if got := m.cursor.BytePos(); got != (cell.Pt{1, 3}) {
+		t.Fatalf("cycle: got cursor at %v, want at the end of the pasted text", got)
+	}
+	m.handleActions(commands["cycleKillRing"](m))
+	if got := m.text.LineData(1); got != "two" {
+		t.Fatalf("cycle: got %q, want %q", got, "two")
+	}
+	m.handleActions([]*Action{{kind: "undo"}})
+	if got := m.text.LineData(1); got != "one" {
+		t.Fatalf("undo: got %q, want %q", got, "one")
+	}
+	// it pasted nothing by the last event.
+	m.handleActions(commands["cycleKillRing"](m))
+	if m.err == "" {
+		t.Fatalf("cycle: want an error after undo")
+	}
+
+	selectRange(m, cell.Pt{0, 0}, cell.Pt{0, 3})
+	m.handleActions([]*Action{{kind: "copy", value: "a"}, {kind: "selection", value: "off"}})
+	if got := loadRegisters(); got["a"].S != "one" {
+		t.Fatalf("copy to register: got %v", got)
+	}
+	if got := loadKillRing(); got[0].S != "two" {
+		t.Fatalf("copy to register: kill ring is changed to %v", got)
+	}
+	m.cursor.SetBytePos(cell.Pt{1, 0})
+	m.handleActions(pasteActions(m, m.registers["a"], false))
+	if got := strings.Join(textLines(m.text), "\n"); got != "one two\noneone" {
+		t.Fatalf("paste from register: got %q", got)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/kybin/tor/cell"
+)
+
+// textMatch is a match of a regexp in a line of text.
+type textMatch struct {
+	l     int
+	match []int // submatch index pairs, as regexp.FindStringSubmatchIndex.
+}
+
+// findMatches finds non-empty matches of re in text between min and max.
+// A match that is not entirely in the range will not returned.
+func findMatches(text *Text, re *regexp.Regexp, min, max cell.Pt) []textMatch {
+	matches := make([]textMatch, 0)
+	for l := min.L; l <= max.L && l < text.NumLines(); l++ {
+		for _, m := range re.FindAllStringSubmatchIndex(text.LineData(l), -1) {
+			if m[0] == m[1] {
+				continue
+			}
+			if l == min.L && m[0] < min.O {
+				continue
+			}
+			if l == max.L && m[1] > max.O {
+				break
+			}
+			matches = append(matches, textMatch{l: l, match: m})
+		}
+	}
+	return matches
+}
+
+// expandReplace returns the replacement string for a match in line.
+// When expand is true, references like $1 in repl are expanded with the match's submatches.
+func expandReplace(re *regexp.Regexp, repl string, expand bool, line string, match []int) string {
+	if !expand {
+		return repl
+	}
+	return string(re.ExpandString(nil, repl, line, match))
+}
+
+// textEnd returns the end position of text.
+func textEnd(text *Text) cell.Pt {
+	l := text.NumLines() - 1
+	return cell.Pt{l, len(text.LineData(l))}
+}
+
+// replaceRange returns the range for replacing matches of re, which starts from p.
+// If there is a selection, the range is the selection.
+// Though a selection made by finding, which is a match of re, is not counted.
+func (m *NormalMode) replaceRange(re *regexp.Regexp, p cell.Pt) (cell.Pt, cell.Pt) {
+	if !m.selection.on {
+		return p, textEnd(m.text)
+	}
+	min, max := m.selection.MinMax()
+	data := m.text.DataInside(min, max)
+	if loc := re.FindStringIndex(data); loc != nil && loc[0] == 0 && loc[1] == len(data) {
+		return p, textEnd(m.text)
+	}
+	return min, max
+}
+
+// replaceMatch replaces bytes between [b, e) of line l with repl.
+// It returns edits of the replacement, which are a deletion and an insertion.
+// The cursor will placed at the end of the inserted string.
+func (m *NormalMode) replaceMatch(l, b, e int, repl string) []edit {
+	mark := m.text.StartRecord()
+	m.cursor.SetBytePos(cell.Pt{l, b})
+	m.text.Remove(l, b, e)
+	m.cursor.Insert(repl)
+	return m.text.StopRecord(mark)
+}
+
+// replaceAll replaces every match of re between min and max with repl.
+// It returns how many matches are replaced.
+// The cursor will placed at the start of the first replacement.
+func (m *NormalMode) replaceAll(re *regexp.Regexp, repl string, expand bool, min, max cell.Pt) int {
+	matches := findMatches(m.text, re, min, max)
+	if len(matches) == 0 {
+		return 0
+	}
+	// replace from the last match, so positions of remaining matches are not changed.
+	for i := len(matches) - 1; i >= 0; i-- {
+		tm := matches[i]
+		r := expandReplace(re, repl, expand, m.text.LineData(tm.l), tm.match)
+		m.replaceMatch(tm.l, tm.match[0], tm.match[1], r)
+	}
+	first := matches[0]
+	m.cursor.SetBytePos(cell.Pt{first.l, first.match[0]})
+	return len(matches)
+}
+
+// remember adds actions as a history group, so they could be undone at once.
+func (m *NormalMode) remember(actions []*Action) {
+	if len(actions) == 0 {
+		return
+	}
+	m.history.Add(actions)
+	m.text.edited = true
+}
+
+// replaceAllFound replaces every match of the find mode's string with the replace mode's string.
+// If there is a selection, it replaces matches only inside of the selection.
+// See replaceRange.
+func (m *NormalMode) replaceAllFound() {
+	re, err := tor.find.Regexp()
+	if err != nil {
+		m.err = err.Error()
+		return
+	}
+	if re == nil {
+		m.err = "nothing to find"
+		return
+	}
+	min, max := m.replaceRange(re, cell.Pt{0, 0})
+	m.selection.on = false
+	n := m.replaceAll(re, tor.replace.str, tor.find.regex, min, max)
+	if n == 0 {
+		m.err = fmt.Sprintf("not found: %v", tor.find.str)
+		return
+	}
+	m.status = fmt.Sprintf("replaced %v matches", n)
+}
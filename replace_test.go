@@ -0,0 +1,100 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/kybin/tor/cell"
+)
+
+func TestFindMatches(t *testing.T) {
+	text := NewText([]string{"foo bar foo", "", "foofoo"})
+	re := regexp.MustCompile("foo")
+	cases := []struct {
+		min, max cell.Pt
+		want     []cell.Pt
+	}{
+		{cell.Pt{0, 0}, textEnd(text), []cell.Pt{{0, 0}, {0, 8}, {2, 0}, {2, 3}}},
+		{cell.Pt{0, 1}, cell.Pt{2, 5}, []cell.Pt{{0, 8}, {2, 0}}},
+		{cell.Pt{0, 4}, cell.Pt{0, 7}, []cell.Pt{}},
+	}
+	for _, c := range cases {
+		got := make([]cell.Pt, 0)
+		for _, m := range findMatches(text, re, c.min, c.max) {
+			got = append(got, cell.Pt{m.l, m.match[0]})
+		}
+		if len(got) != len(c.want) {
+			t.Fatalf("findMatches(%v, %v): got %v, want %v", c.min, c.max, got, c.want)
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Fatalf("findMatches(%v, %v): got %v, want %v", c.min, c.max, got, c.want)
+			}
+		}
+	}
+}
+
+func TestExpandReplace(t *testing.T) {
+	re := regexp.MustCompile(`(\w+)\.(\w+)`)
+	line := "x := m.cursor"
+	match := re.FindStringSubmatchIndex(line)
+	cases := []struct {
+		repl   string
+		expand bool
+		want   string
+	}{
+		{"$2.$1", true, "cursor.m"},
+		{"${1}_x", true, "m_x"},
+		{"$2.$1", false, "$2.$1"},
+	}
+	for _, c := range cases {
+		got := expandReplace(re, c.repl, c.expand, line, match)
+		if got != c.want {
+			t.Fatalf("expandReplace(%q, %v): got %q, want %q", c.repl, c.expand, got, c.want)
+		}
+	}
+}
+
+func TestReplaceAllUndo(t *testing.T) {
+	in := []string{"text := t.text", "if text != nil {", "\treturn text.lines", "}"}
+	m := &NormalMode{Buffer: NewBuffer("test.go", NewText(in))}
+	re := regexp.MustCompile(`\btext\b`)
+	mark := m.text.StartRecord()
+	n := m.replaceAll(re, "txt\n", false, cell.Pt{0, 0}, textEnd(m.text))
+	m.remember([]*Action{{kind: "replaceAll", edits: m.text.StopRecord(mark)}})
+	if n != 4 {
+		t.Fatalf("replaceAll: got %d replaced, want 4", n)
+	}
+	want := "txt\n := t.txt\n\nif txt\n != nil {\n\treturn txt\n.lines\n}"
+	if got := strings.Join(textLines(m.text), "\n"); got != want {
+		t.Fatalf("replaceAll: got %q, want %q", got, want)
+	}
+	m.do(&Action{kind: "undo"})
+	if got := textLines(m.text); strings.Join(got, "\n") != strings.Join(in, "\n") {
+		t.Fatalf("undo: got %q, want %q", got, in)
+	}
+	m.do(&Action{kind: "redo"})
+	if got := strings.Join(textLines(m.text), "\n"); got != want {
+		t.Fatalf("redo: got %q, want %q", got, want)
+	}
+}
+
+func TestReplaceAllFound(t *testing.T) {
+	b := NewBuffer("a.txt", NewText([]string{"foo bar", "foo foo"}))
+	b.text.writable = true
+	setTestTor(t, 80, 24, b)
+	tor.find = &FindMode{str: "foo"}
+	tor.replace = &ReplaceMode{str: "x"}
+	m := tor.normal
+
+	// the selection is a match made by finding, so matches before it are replaced too.
+	selectRange(m, cell.Pt{1, 4}, cell.Pt{1, 7})
+	m.replaceAllFound()
+	if got, want := strings.Join(textLines(m.text), "\n"), "x bar\nx x"; got != want {
+		t.Fatalf("replaceAllFound: got %q, want %q", got, want)
+	}
+	if m.status != "replaced 3 matches" {
+		t.Fatalf("replaceAllFound: got status %q", m.status)
+	}
+}
@@ -1,6 +1,10 @@
 package main
 
-import "github.com/kybin/tor/cell"
+import (
+	"strings"
+
+	"github.com/kybin/tor/cell"
+)
 
 // Selection is selection for text.
 // When it is off, rng is invalid and treated as [(-1,-1):(-1,-1)].
@@ -8,6 +12,12 @@ type Selection struct {
 	on  bool
 	rng cell.Range
 
+	// block indicates it selects a rectangle of lines and visual columns, instead of a range of text.
+	// The columns are between startCol and endCol, those are visual offsets of the start and end.
+	block    bool
+	startCol int
+	endCol   int
+
 	text *Text
 }
 
@@ -15,20 +25,70 @@ func NewSelection(text *Text) *Selection {
 	return &Selection{text: text}
 }
 
+// SetStart sets the start of a new selection, that is not a block selection.
+// Set block after it to make a block selection.
 func (s *Selection) SetStart(p cell.Pt) {
 	s.rng.Start = p
+	s.startCol = s.col(p)
+	s.block = false
 }
 
 func (s *Selection) SetEnd(p cell.Pt) {
 	s.rng.End = p
+	s.endCol = s.col(p)
+}
+
+// col returns visual column of byte position p.
+func (s *Selection) col(p cell.Pt) int {
+	if p.L < 0 || p.L >= s.text.NumLines() {
+		return 0
+	}
+	line := s.text.LineData(p.L)
+	if p.O > len(line) {
+		p.O = len(line)
+	}
+	return vlen(line[:p.O], s.text.tabWidth)
+}
+
+// SetEndCol sets visual column of the end for block selection.
+// It could be right of the end of the line, like a cursor that moved from a longer line.
+func (s *Selection) SetEndCol(o int) {
+	s.endCol = o
+}
+
+// Cols returns visual columns of the block selection, from left to right.
+func (s *Selection) Cols() (int, int) {
+	if s.startCol > s.endCol {
+		return s.endCol, s.startCol
+	}
+	return s.startCol, s.endCol
+}
+
+// LineBlock returns byte offsets of line l those are at the left and right columns of the block selection.
+// A rune is in the block when it starts inside of the columns.
+func (s *Selection) LineBlock(l int) (int, int) {
+	line := s.text.LineData(l)
+	min, max := s.Cols()
+	from, _ := blockB(line, min, s.text.tabWidth)
+	to, _ := blockB(line, max, s.text.tabWidth)
+	return from, to
 }
 
 // Lines return selected line numbers as int slice.
-// Note it will not return last line number if last cursor's offset is 0.
+// Note it will not return last line number if last cursor's offset is 0,
+// unless it is a block selection.
 func (s *Selection) Lines() []int {
 	if !s.on {
 		return nil
 	}
+	if s.block {
+		min, max := s.rng.MinMax()
+		lns := make([]int, 0, max.L-min.L+1)
+		for l := min.L; l <= max.L; l++ {
+			lns = append(lns, l)
+		}
+		return lns
+	}
 	return s.rng.Lines()
 }
 
@@ -57,12 +117,30 @@ func (s *Selection) Contains(p cell.Pt) bool {
 	if !s.on {
 		return false
 	}
+	if s.block {
+		min, max := s.rng.MinMax()
+		if p.L < min.L || p.L > max.L {
+			return false
+		}
+		from, to := s.LineBlock(p.L)
+		return from <= p.O && p.O < to
+	}
 	return s.rng.Contains(p)
 }
 
+// Data returns the selected string.
+// For a block selection, it is selected parts of the lines joined with newlines.
 func (s *Selection) Data() string {
 	if !s.on {
 		return ""
 	}
+	if s.block {
+		parts := make([]string, 0)
+		for _, l := range s.Lines() {
+			from, to := s.LineBlock(l)
+			parts = append(parts, s.text.LineData(l)[from:to])
+		}
+		return strings.Join(parts, "\n")
+	}
 	return s.text.DataInside(s.MinMax())
 }
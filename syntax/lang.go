@@ -1,27 +1,116 @@
 package syntax
 
 import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strings"
 )
 
-// langGenerator is a collection of language generators.
-var langGenerator map[string]func() *Language
+// builtinLangs are language definitions those are shipped with tor.
+// They are written in the same format with user's language files.
+//
+//go:embed langs/*.json
+var builtinLangs embed.FS
+
+// languages are loaded languages, keyed by their extensions.
+var languages = make(map[string]*Language)
+
+// langList is loaded languages in loaded order.
+// Languages loaded later take precedence when detecting a language by filename or shebang.
+var langList = make([]*Language, 0)
 
 // NewLanguage finds a language from given extension.
 // It will return "unknown" language if it didn't find language for the extension.
 func NewLanguage(ext string) *Language {
-	gen, ok := langGenerator[ext]
+	lang, ok := languages[ext]
 	if ok {
-		lang := gen()
-		return lang
+		l := *lang
+		return &l
+	}
+	return unknownLanguage()
+}
+
+// DetectLanguage finds a language for a file,
+// by it's filename first, then it's extension, then shebang in it's first line.
+// It will return "unknown" language if it didn't find language for the file.
+func DetectLanguage(filename, firstLine string) *Language {
+	base := filepath.Base(filename)
+	for i := len(langList) - 1; i >= 0; i-- {
+		lang := langList[i]
+		for _, pat := range lang.Filenames {
+			if ok, _ := path.Match(pat, base); ok {
+				l := *lang
+				return &l
+			}
+		}
+	}
+	if ext := filepath.Ext(base); ext != "" {
+		if _, ok := languages[ext[1:]]; ok {
+			return NewLanguage(ext[1:])
+		}
+	}
+	if interp := shebang(firstLine); interp != "" {
+		// also try without the version, like "python" for "python3.11".
+		cands := []string{interp, strings.TrimRight(interp, "0123456789.")}
+		for _, cand := range cands {
+			for i := len(langList) - 1; i >= 0; i-- {
+				lang := langList[i]
+				for _, sb := range lang.Shebangs {
+					if sb == cand {
+						l := *lang
+						return &l
+					}
+				}
+			}
+		}
 	}
 	return unknownLanguage()
 }
 
+// shebang returns the interpreter's name from a shebang line, like "bash" for "#!/usr/bin/env bash".
+// It returns an empty string if the line is not a shebang.
+func shebang(line string) string {
+	if !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+	fields := strings.Fields(line[2:])
+	if len(fields) == 0 {
+		return ""
+	}
+	interp := path.Base(fields[0])
+	if interp != "env" {
+		return interp
+	}
+	for _, f := range fields[1:] {
+		// skip options of env, like -S.
+		if strings.HasPrefix(f, "-") || strings.Contains(f, "=") {
+			continue
+		}
+		return path.Base(f)
+	}
+	return ""
+}
+
 // Language is a set of tab configurations and syntaxes.
 type Language struct {
+	Name       string
+	Extensions []string
+	// Filenames are glob patterns of file names, like "Makefile" or "Dockerfile.*".
+	Filenames []string
+	// Shebangs are interpreter names in a shebang line, like "bash".
+	Shebangs   []string
 	TabToSpace bool
 	TabWidth   int
+	// Comment is a line comment prefix of the language, like "//".
+	// It is empty when the language doesn't have line comments.
+	Comment string
 	// syntaxes is not a map, because highlighting is affected by syntax order
 	syntaxes []Syntax
 }
@@ -37,59 +126,205 @@ func newLanguage(tabToSpace bool, tabWidth int) *Language {
 }
 
 // AddSyntax adds a syntax to the language.
-// It will become more useful when we really split syntax for languages
-// into their own configuration files.
 func (l *Language) AddSyntax(s Syntax) {
+	s.first = firstBytes(s.Re)
 	l.syntaxes = append(l.syntaxes, s)
 }
 
 // unknownLanguage is a fallback language.
 func unknownLanguage() *Language {
 	def := newLanguage(false, 4)
-	def.AddSyntax(Syntax{"trailing spaces", TypeTrailingSpaces, regexp.MustCompile(`^(?m)[ \t]+$`)})
+	def.Name = "unknown"
+	def.AddSyntax(Syntax{Name: "trailing spaces", Type: TypeTrailingSpaces, Re: regexp.MustCompile(`^[ \t]+$`)})
 	return def
 }
 
+// typeNames are names of syntax types in language files.
+var typeNames = map[string]Type{
+	"keyword":        TypeKeyword,
+	"string":         TypeString,
+	"rune":           TypeRune,
+	"int":            TypeInt,
+	"comment":        TypeComment,
+	"trailingSpaces": TypeTrailingSpaces,
+	"variable":       TypeVariable,
+}
+
+// TypeByName returns the syntax type of the name, as written in language files.
+func TypeByName(name string) (Type, bool) {
+	t, ok := typeNames[name]
+	return t, ok
+}
+
+// langFile is a language definition in a language file.
+// Syntaxes are matched in the order, so put a syntax earlier when it should win.
+// A regex should start with ^ to match at the parsing position.
+// Regexes are matched in a line, so a syntax that spans multiple lines should have end regex.
+type langFile struct {
+	Name       string       `json:"name"`
+	Extensions []string     `json:"extensions"`
+	Filenames  []string     `json:"filenames"`
+	Shebangs   []string     `json:"shebangs"`
+	TabToSpace bool         `json:"tabToSpace"`
+	TabWidth   int          `json:"tabWidth"`
+	Comment    string       `json:"comment"`
+	Syntaxes   []syntaxFile `json:"syntaxes"`
+}
+
+// syntaxFile is a syntax definition in a language file.
+// When End is not empty, the syntax is a region that starts with Regex, and ends with End.
+type syntaxFile struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Regex string `json:"regex"`
+	End   string `json:"end"`
+}
+
+// ParseLanguage parses a language definition from r.
+// It returns an error that tells which syntax is wrong, if there is.
+func ParseLanguage(r io.Reader) (*Language, error) {
+	var lf langFile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&lf); err != nil {
+		return nil, err
+	}
+	if lf.Name == "" {
+		return nil, fmt.Errorf("language name is empty")
+	}
+	if len(lf.Extensions) == 0 && len(lf.Filenames) == 0 && len(lf.Shebangs) == 0 {
+		return nil, fmt.Errorf("language %q has no extension, filename or shebang", lf.Name)
+	}
+	for _, pat := range lf.Filenames {
+		if _, err := path.Match(pat, ""); err != nil {
+			return nil, fmt.Errorf("invalid filename pattern %q: %v", pat, err)
+		}
+	}
+	if lf.TabWidth < 0 {
+		return nil, fmt.Errorf("invalid tab width: %v", lf.TabWidth)
+	}
+	if lf.TabWidth == 0 {
+		lf.TabWidth = 4
+	}
+	lang := newLanguage(lf.TabToSpace, lf.TabWidth)
+	lang.Name = lf.Name
+	lang.Extensions = lf.Extensions
+	lang.Filenames = lf.Filenames
+	lang.Shebangs = lf.Shebangs
+	lang.Comment = lf.Comment
+	for i, sf := range lf.Syntaxes {
+		name := sf.Name
+		if name == "" {
+			name = fmt.Sprintf("#%v", i)
+		}
+		typ, ok := typeNames[sf.Type]
+		if !ok {
+			return nil, fmt.Errorf("syntax %q: unknown type %q", name, sf.Type)
+		}
+		re, err := regexp.Compile(sf.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("syntax %q: invalid regex: %v", name, err)
+		}
+		syn := Syntax{Name: sf.Name, Type: typ, Re: re}
+		if sf.End != "" {
+			syn.End, err = regexp.Compile(sf.End)
+			if err != nil {
+				return nil, fmt.Errorf("syntax %q: invalid end regex: %v", name, err)
+			}
+		}
+		lang.AddSyntax(syn)
+	}
+	return lang, nil
+}
+
+// registerLanguage makes the language found by it's extensions, filenames and shebangs.
+// It replaces a language previously registered with the same name,
+// and overrides other languages registered with the extensions.
+func registerLanguage(lang *Language) {
+	for i, l := range langList {
+		if l.Name != lang.Name {
+			continue
+		}
+		for ext, el := range languages {
+			if el == l {
+				delete(languages, ext)
+			}
+		}
+		langList = append(langList[:i], langList[i+1:]...)
+		break
+	}
+	langList = append(langList, lang)
+	for _, ext := range lang.Extensions {
+		languages[ext] = lang
+	}
+}
+
+// LoadLanguages loads language files (*.json) in dir.
+// Languages from the files override built-in ones that have the same extensions.
+// It skips files that have errors, and returns the errors.
+// A missing dir is not an error.
+func LoadLanguages(dir string) []error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return []error{err}
+	}
+	sort.Strings(files)
+	errs := make([]error, 0)
+	for _, f := range files {
+		r, err := os.Open(f)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		lang, err := ParseLanguage(r)
+		r.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %v", f, err))
+			continue
+		}
+		registerLanguage(lang)
+	}
+	return errs
+}
+
+// Languages returns loaded languages sorted by their names.
+func Languages() []*Language {
+	langs := make([]*Language, len(langList))
+	copy(langs, langList)
+	sort.Slice(langs, func(i, j int) bool {
+		return langs[i].Name < langs[j].Name
+	})
+	return langs
+}
+
+func (l *Language) String() string {
+	s := l.Name + ":"
+	for _, ext := range l.Extensions {
+		s += " *." + ext
+	}
+	for _, f := range l.Filenames {
+		s += " " + f
+	}
+	for _, sb := range l.Shebangs {
+		s += " #!" + sb
+	}
+	return s
+}
+
 func init() {
-	langGenerator = make(map[string]func() *Language)
-
-	langGenerator["go"] = func() *Language {
-		golang := newLanguage(false, 4)
-		golang.AddSyntax(Syntax{"string", TypeString, regexp.MustCompile(`^(?m)".*?(?:[^\\]?"|$)`)})
-		golang.AddSyntax(Syntax{"raw string", TypeString, regexp.MustCompile(`^(?s)` + "`" + `.*?` + "(?:`|$)")})
-		golang.AddSyntax(Syntax{"rune", TypeRune, regexp.MustCompile(`^(?m)'.*?(?:[^\\]?'|$)`)})
-		golang.AddSyntax(Syntax{"comment", TypeComment, regexp.MustCompile(`^(?m)//.*`)})
-		golang.AddSyntax(Syntax{"multi line comment", TypeComment, regexp.MustCompile(`^(?s)/[*].*?(?:[*]/|$)`)})
-		golang.AddSyntax(Syntax{"trailing spaces", TypeTrailingSpaces, regexp.MustCompile(`^(?m)[ \t]+$`)})
-		golang.AddSyntax(Syntax{"package", TypeKeyword, regexp.MustCompile(`^package\s`)})
-		return golang
-	}
-
-	langGenerator["py"] = func() *Language {
-		py := newLanguage(false, 4)
-		py.AddSyntax(Syntax{"multi line string1", TypeString, regexp.MustCompile(`^(?s)""".*?(?:"""|$)`)})
-		py.AddSyntax(Syntax{"multi line string2", TypeString, regexp.MustCompile(`^(?s)'''.*?(?:'''|$)`)})
-		py.AddSyntax(Syntax{"string1", TypeString, regexp.MustCompile(`^(?m)".*?(?:[^\\]?"|$)`)})
-		py.AddSyntax(Syntax{"string2", TypeString, regexp.MustCompile(`^(?m)'.*?(?:[^\\]?'|$)`)})
-		py.AddSyntax(Syntax{"comment", TypeComment, regexp.MustCompile(`^(?m)#.*`)})
-		py.AddSyntax(Syntax{"trailing spaces", TypeTrailingSpaces, regexp.MustCompile(`^(?m)[ \t]+$`)})
-		return py
-	}
-
-	langGenerator["ts"] = func() *Language {
-		ts := newLanguage(true, 2)
-		ts.AddSyntax(Syntax{"raw string", TypeString, regexp.MustCompile(`^(?s)` + "`" + `.*?` + "(?:`|$)")})
-		ts.AddSyntax(Syntax{"string1", TypeString, regexp.MustCompile(`^(?m)".*?(?:[^\\]?"|$)`)})
-		ts.AddSyntax(Syntax{"string2", TypeString, regexp.MustCompile(`^(?m)'.*?(?:[^\\]?'|$)`)})
-		ts.AddSyntax(Syntax{"comment", TypeComment, regexp.MustCompile(`^(?m)//.*`)})
-		ts.AddSyntax(Syntax{"trailing spaces", TypeTrailingSpaces, regexp.MustCompile(`^(?m)[ \t]+$`)})
-		ts.AddSyntax(Syntax{"keywords", TypeKeyword, regexp.MustCompile(`^(import|export)\s`)})
-		return ts
-	}
-
-	langGenerator["elm"] = func() *Language {
-		elm := newLanguage(true, 2)
-		elm.AddSyntax(Syntax{"trailing spaces", TypeTrailingSpaces, regexp.MustCompile(`^(?m)[ \t]+$`)})
-		return elm
+	files, err := builtinLangs.ReadDir("langs")
+	if err != nil {
+		panic(err)
+	}
+	for _, f := range files {
+		data, err := builtinLangs.ReadFile(path.Join("langs", f.Name()))
+		if err != nil {
+			panic(err)
+		}
+		lang, err := ParseLanguage(strings.NewReader(string(data)))
+		if err != nil {
+			panic(fmt.Sprintf("built-in language %v: %v", f.Name(), err))
+		}
+		registerLanguage(lang)
 	}
 }
@@ -0,0 +1,127 @@
+package syntax
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLanguage(t *testing.T) {
+	cases := []struct {
+		in      string
+		wantErr string
+	}{
+		{
+			in:      `{"name": "sh", "extensions": ["sh"], "comment": "#", "syntaxes": [{"name": "comment", "type": "comment", "regex": "^#.*"}]}`,
+			wantErr: "",
+		},
+		{
+			in:      `{"name": "sh", "extensions": ["sh"], "syntaxes": [{"name": "string", "type": "string", "regex": "^(\".*"}]}`,
+			wantErr: `syntax "string": invalid regex`,
+		},
+		{
+			in:      `{"name": "sh", "extensions": ["sh"], "syntaxes": [{"name": "call", "type": "function", "regex": "^\\w+\\("}]}`,
+			wantErr: `syntax "call": unknown type "function"`,
+		},
+		{
+			in:      `{"name": "sh", "syntaxes": []}`,
+			wantErr: "has no extension",
+		},
+		{
+			in:      `{"name": "sh", "extensions": ["sh"], "keywords": []}`,
+			wantErr: "unknown field",
+		},
+	}
+	for _, c := range cases {
+		lang, err := ParseLanguage(strings.NewReader(c.in))
+		if c.wantErr == "" {
+			if err != nil {
+				t.Fatalf("ParseLanguage(%s): got error %v", c.in, err)
+			}
+			if lang.TabWidth != 4 || lang.Comment != "#" || len(lang.syntaxes) != 1 {
+				t.Fatalf("ParseLanguage(%s): got %+v", c.in, lang)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+			t.Fatalf("ParseLanguage(%s): got error %v, want %q", c.in, err, c.wantErr)
+		}
+	}
+}
+
+func TestLoadLanguages(t *testing.T) {
+	builtins, builtinList := languages, langList
+	defer func() {
+		languages, langList = builtins, builtinList
+	}()
+	languages = make(map[string]*Language)
+	for ext, l := range builtins {
+		languages[ext] = l
+	}
+	langList = append([]*Language{}, builtinList...)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"elm.json": `{"name": "my elm", "extensions": ["elm"], "tabWidth": 8}`,
+		"bad.json": `{"name": "bad", "extensions": ["bad"], "syntaxes": [{"name": "x", "type": "keyword", "regex": "["}]}`,
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	errs := LoadLanguages(dir)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "bad.json") {
+		t.Fatalf("LoadLanguages: got errors %v, want an error of bad.json", errs)
+	}
+	if l := NewLanguage("elm"); l.Name != "my elm" || l.TabWidth != 8 {
+		t.Fatalf("LoadLanguages: elm is not overridden, got %v", l)
+	}
+	if l := NewLanguage("bad"); l.Name != "unknown" {
+		t.Fatalf("LoadLanguages: got %v from a bad file", l)
+	}
+	if l := NewLanguage("go"); l.Name != "go" {
+		t.Fatalf("LoadLanguages: got %v, want built-in go", l)
+	}
+	if errs := LoadLanguages(filepath.Join(dir, "not-exist")); len(errs) != 0 {
+		t.Fatalf("LoadLanguages: got errors %v from a missing dir", errs)
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	cases := []struct {
+		filename  string
+		firstLine string
+		want      string
+	}{
+		{"main.go", "package main", "go"},
+		{"/src/tor/go.mod", "module github.com/kybin/tor", "go module"},
+		{"Makefile", "all: build", "makefile"},
+		{"build/Dockerfile.dev", "FROM alpine", "dockerfile"},
+		{"docker-compose.yml", "services:", "yaml"},
+		{"deploy", "#!/bin/bash", "shell"},
+		{"deploy", "#!/usr/bin/env -S python3.11 -u", "python"},
+		{"run.sh", "#!/usr/bin/env python3", "shell"},
+		{"README", "# tor", "unknown"},
+		{"notes", "", "unknown"},
+	}
+	for _, c := range cases {
+		if got := DetectLanguage(c.filename, c.firstLine).Name; got != c.want {
+			t.Fatalf("DetectLanguage(%q, %q): got %v, want %v", c.filename, c.firstLine, got, c.want)
+		}
+	}
+}
+
+func TestBuiltinLanguages(t *testing.T) {
+	want := []string{"c", "css", "dockerfile", "go", "html", "javascript", "json", "makefile", "markdown", "protobuf", "python", "rust", "shell", "sql", "typescript", "yaml"}
+	have := make(map[string]bool)
+	for _, l := range Languages() {
+		have[l.Name] = true
+	}
+	for _, name := range want {
+		if !have[name] {
+			t.Fatalf("Languages: %v is not a built-in language", name)
+		}
+	}
+}
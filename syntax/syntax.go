@@ -2,9 +2,10 @@ package syntax
 
 import (
 	"regexp"
+	rsyntax "regexp/syntax"
+	"unicode"
 	"unicode/utf8"
 
-	"github.com/gdamore/tcell/v2"
 	"github.com/kybin/tor/cell"
 )
 
@@ -17,173 +18,301 @@ const (
 	TypeInt
 	TypeComment
 	TypeTrailingSpaces
+	TypeVariable
 )
 
-// Byter could converted to []bytes.
-type Byter interface {
-	Bytes() []byte
+// Text is a text that could be read line by line.
+type Text interface {
+	NumLines() int
+	LineData(l int) string
 }
 
 // Parser is syntax parser.
+//
+// It parses a text line by line, and remembers the state at the start of each line.
+// A state is a syntax region that is not closed in previous lines, like a block comment.
+// When lines are changed, it parses from the first changed line again,
+// until the state at the start of a line is same as before.
 type Parser struct {
-	text        Byter
-	textChanged bool
-	lang        *Language
-	Matches     []Match
+	text Text
+	lang *Language
 
-	nextStart cell.Pt // next parse starting point, exclusive.
+	// lines are parse results of lines, that are valid only when parsed is true.
+	lines []lineState
+	// next is the first line that is not parsed yet.
+	next int
 }
 
-// NewParser creates a new Parser.
-func NewParser(text Byter, ext string) *Parser {
+// lineState is a parse result of a line.
+type lineState struct {
+	parsed bool
+	// start is the state at the start of the line, and end is the state at the end of the line.
+	// A state is index of the open region syntax + 1, or 0 if there is no open region.
+	start   int
+	end     int
+	matches []lineMatch
+}
+
+// lineMatch is a match in a line, in byte offsets.
+// It doesn't remember the line number, so it is still valid when lines above it are changed.
+type lineMatch struct {
+	syn  int // index of the syntax.
+	b, e int
+}
+
+// NewParser creates a new Parser that parses text as lang.
+func NewParser(text Text, lang *Language) *Parser {
 	p := &Parser{}
-	p.lang = NewLanguage(ext)
+	p.lang = lang
 	p.SetText(text)
 	return p
 }
 
 // SetText set it's text.
-// After done this, first ParseTo will clear current matches
-// and calculate matches from start.
-func (p *Parser) SetText(text Byter) {
+// After done this, first ParseTo will calculate matches from start.
+func (p *Parser) SetText(text Text) {
 	p.text = text
-	p.textChanged = true
+	p.lines = make([]lineState, text.NumLines())
+	p.next = 0
 }
 
-// ParseTo calculates it's matches to pt.
-// If a match started but not ended when reached to pt,
-// it will continue parsing to the match's end.
-func (p *Parser) ParseTo(pt cell.Pt) {
-	if p.textChanged {
-		p.nextStart = cell.Pt{0, 0}
-		p.Matches = []Match{}
-		p.textChanged = false
+// Changed tells the parser that lines [l, l+removed) of the text are replaced with inserted lines.
+// Lines those are not changed keep their parse results.
+func (p *Parser) Changed(l, removed, inserted int) {
+	if l > len(p.lines) {
+		l = len(p.lines)
+	}
+	if l+removed > len(p.lines) {
+		removed = len(p.lines) - l
+	}
+	n := len(p.lines)
+	if inserted > removed {
+		p.lines = append(p.lines, make([]lineState, inserted-removed)...)
+	}
+	if inserted != removed {
+		copy(p.lines[l+inserted:], p.lines[l+removed:n])
+		p.lines = p.lines[:n-removed+inserted]
+	}
+	for i := l; i < l+inserted; i++ {
+		p.lines[i] = lineState{}
 	}
+	if l < p.next {
+		p.next = l
+	}
+}
 
-	// move cursor to start position.
-	c := NewCursor(p.text.Bytes())
-	for c.Pos().Compare(p.nextStart) < 0 {
-		ok := c.Advance()
-		if !ok {
-			// already end of text. nothing to do.
-			return
+// ParseTo parses lines before line end, if they are not parsed yet.
+func (p *Parser) ParseTo(end int) {
+	if len(p.lines) != p.text.NumLines() {
+		// the text is changed without telling. parse it again.
+		p.SetText(p.text)
+	}
+	if end > len(p.lines) {
+		end = len(p.lines)
+	}
+	for p.next < end {
+		l := p.next
+		start := 0
+		if l != 0 {
+			start = p.lines[l-1].end
+		}
+		p.lines[l] = p.parseLine(p.text.LineData(l), start)
+		p.next = l + 1
+		// the next line doesn't need to be parsed again, if it starts with the same state.
+		// then skip to the next line that is not parsed.
+		if p.next < len(p.lines) && p.lines[p.next].parsed && p.lines[p.next].start == p.lines[l].end {
+			for p.next < len(p.lines) && p.lines[p.next].parsed {
+				p.next++
+			}
 		}
 	}
+}
 
-	matches := []Match{}
-Loop:
-	for {
-		if c.Pos().Compare(pt) >= 0 {
-			break
+// parseLine parses a line that starts with the state.
+func (p *Parser) parseLine(line string, state int) lineState {
+	ls := lineState{parsed: true, start: state, matches: []lineMatch{}}
+	b := 0
+	if state != 0 {
+		// continue the open region.
+		i := state - 1
+		e := len(line)
+		if loc := p.lang.syntaxes[i].End.FindStringIndex(line); loc != nil {
+			e = loc[1]
+			state = 0
 		}
-		for _, syn := range p.lang.syntaxes {
-			ms := syn.Re.FindSubmatch(c.Remain())
+		if e != 0 {
+			ls.matches = append(ls.matches, lineMatch{i, 0, e})
+		}
+		b = e
+	}
+Loop:
+	for state == 0 && b < len(line) {
+		remain := line[b:]
+		for i, syn := range p.lang.syntaxes {
+			if syn.first != nil && !syn.first[remain[0]] {
+				continue
+			}
+			ms := syn.Re.FindStringSubmatchIndex(remain)
 			if ms == nil {
 				continue
 			}
-			m := ms[0]
-			if len(ms) == 2 {
+			e := ms[1]
+			if len(ms) == 4 && ms[2] == 0 {
 				// if the match has subgroup, use a first one.
-				m = ms[1]
+				e = ms[3]
+			}
+			if syn.End != nil {
+				// region starts. find where it ends.
+				if loc := syn.End.FindStringIndex(remain[e:]); loc != nil {
+					e += loc[1]
+				} else {
+					e = len(remain)
+					state = i + 1
+				}
 			}
-			if string(m) == "" {
+			if e == 0 {
 				continue
 			}
-			start := c.Pos()
-			c.Skip(len(m))
-			end := c.Pos()
-			matches = append(matches, syn.NewMatch(start, end))
+			ls.matches = append(ls.matches, lineMatch{i, b, b + e})
+			b += e
 			continue Loop
 		}
-		if !c.Advance() {
-			break
+		// a syntax could not start in the middle of a word.
+		// ex) "if" keyword should not match in "elif".
+		r, size := utf8.DecodeRuneInString(remain)
+		b += size
+		if isWordRune(r) {
+			for b < len(line) {
+				r, size := utf8.DecodeRuneInString(line[b:])
+				if !isWordRune(r) {
+					break
+				}
+				b += size
+			}
 		}
 	}
-	p.Matches = append(p.Matches, matches...)
-	p.nextStart = cell.Pt{0, 0}
-	if len(p.Matches) != 0 {
-		p.nextStart = p.Matches[len(p.Matches)-1].Range.Max()
-	}
+	ls.end = state
+	return ls
 }
 
-// ClearFrom clears it's match from pt.
-// If there is an overwrap with a match,
-// it will clear that match too.
-func (p *Parser) ClearFrom(pt cell.Pt) {
-	clip := 0
-	for i, m := range p.Matches {
-		if m.Range.Max().Compare(pt) < 0 {
-			continue
-		}
-		clip = i
-		break
+// isWordRune reports whether r could be a part of a word.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// LineMatches returns matches in line l, in order.
+// Ranges of the matches are inside of the line.
+// It returns nil if the line is not parsed yet, so ParseTo should be called before.
+func (p *Parser) LineMatches(l int) []Match {
+	if l < 0 || l >= p.next {
+		return nil
 	}
-	if clip == 0 {
-		p.nextStart = cell.Pt{0, 0}
-		p.Matches = []Match{}
-		return
+	lms := p.lines[l].matches
+	matches := make([]Match, 0, len(lms))
+	for _, m := range lms {
+		syn := p.lang.syntaxes[m.syn]
+		matches = append(matches, syn.NewMatch(cell.Pt{l, m.b}, cell.Pt{l, m.e}))
 	}
-	p.nextStart = p.Matches[clip-1].Range.Max()
-	p.Matches = p.Matches[:clip]
+	return matches
 }
 
+// Matches returns matches in parsed lines.
+// A match that spans multiple lines is split into matches of each line.
+func (p *Parser) Matches() []Match {
+	matches := []Match{}
+	for l := 0; l < p.next; l++ {
+		matches = append(matches, p.LineMatches(l)...)
+	}
+	return matches
+}
+
+// Syntax is a syntax of a language.
+// When End is not nil, it is a region that starts with Re and ends with End.
+// A region could span multiple lines.
 type Syntax struct {
 	Name string
 	Type Type
 	Re   *regexp.Regexp
-}
-
-func (s Syntax) NewMatch(start, end cell.Pt) Match {
-	return Match{Name: s.Name, Type: s.Type, Range: cell.Range{start, end}}
-}
-
-type Cursor struct {
-	text []byte
-	b    int // byte offset
-	l    int // line offset
-	o    int // byte in line offset
-}
+	End  *regexp.Regexp
 
-func NewCursor(text []byte) *Cursor {
-	return &Cursor{text: text}
+	// first is bytes those a match of Re could start with.
+	// It is nil when a match could start with any byte.
+	first *[256]bool
 }
 
-func (c *Cursor) Pos() cell.Pt {
-	return cell.Pt{c.l, c.o}
-}
-
-func (c *Cursor) Remain() []byte {
-	if c.l == len(c.text) {
-		return []byte("")
+// firstBytes returns bytes those a match of re could start with.
+// Trying a regexp is slow, so the parser tries it only when the next byte is one of them.
+// It returns nil when it could start with any byte.
+func firstBytes(re *regexp.Regexp) *[256]bool {
+	r, err := rsyntax.Parse(re.String(), rsyntax.Perl)
+	if err != nil {
+		return nil
 	}
-	return c.text[c.b:]
-}
-
-func (c *Cursor) Advance() bool {
-	if c.b == len(c.text) {
-		return false
+	prog, err := rsyntax.Compile(r.Simplify())
+	if err != nil {
+		return nil
 	}
-	c.next()
-	return true
-}
-
-func (c *Cursor) Skip(b int) {
-	i := 0
-	for i < b {
-		_, size := c.next()
-		i += size
+	first := &[256]bool{}
+	addRune := func(r rune) {
+		if r >= utf8.RuneSelf {
+			// any leading byte of a multi-byte rune.
+			for b := utf8.RuneSelf; b < 256; b++ {
+				first[b] = true
+			}
+			return
+		}
+		first[r] = true
+	}
+	visited := make(map[uint32]bool)
+	// walk walks from an instruction to the ones that consume a rune, and adds the runes.
+	// It returns false when it meets an instruction that consumes any rune.
+	var walk func(pc uint32) bool
+	walk = func(pc uint32) bool {
+		if visited[pc] {
+			return true
+		}
+		visited[pc] = true
+		inst := prog.Inst[pc]
+		switch inst.Op {
+		case rsyntax.InstAlt, rsyntax.InstAltMatch:
+			return walk(inst.Out) && walk(inst.Arg)
+		case rsyntax.InstCapture, rsyntax.InstNop, rsyntax.InstEmptyWidth:
+			return walk(inst.Out)
+		case rsyntax.InstRune, rsyntax.InstRune1:
+			runes := inst.Rune
+			if len(runes) == 1 {
+				runes = []rune{runes[0], runes[0]}
+			}
+			for i := 0; i+1 < len(runes); i += 2 {
+				lo, hi := runes[i], runes[i+1]
+				if hi >= utf8.RuneSelf {
+					addRune(utf8.RuneSelf)
+					hi = utf8.RuneSelf - 1
+				}
+				for r := lo; r <= hi; r++ {
+					addRune(r)
+					if rsyntax.Flags(inst.Arg)&rsyntax.FoldCase != 0 {
+						for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+							addRune(f)
+						}
+					}
+				}
+			}
+			return true
+		case rsyntax.InstRuneAny, rsyntax.InstRuneAnyNotNL:
+			return false
+		}
+		// a match or fail doesn't consume a rune.
+		return true
 	}
+	if !walk(uint32(prog.Start)) {
+		return nil
+	}
+	return first
 }
 
-func (c *Cursor) next() (r rune, size int) {
-	r, size = utf8.DecodeRune(c.Remain())
-	c.b += size
-	c.o += size
-	if r == '\n' {
-		c.l += 1
-		c.o = 0
-	}
-	return r, size
+func (s Syntax) NewMatch(start, end cell.Pt) Match {
+	return Match{Name: s.Name, Type: s.Type, Range: cell.Range{start, end}}
 }
 
 type Match struct {
@@ -191,19 +320,3 @@ type Match struct {
 	Type  Type
 	Range cell.Range
 }
-
-type Attr struct {
-	Fg tcell.Color
-	Bg tcell.Color
-}
-
-type Theme map[Type]Attr
-
-var DefaultTheme = Theme{
-	TypeKeyword:        Attr{Fg: tcell.ColorYellow, Bg: tcell.ColorReset},
-	TypeString:         Attr{Fg: tcell.ColorRed, Bg: tcell.ColorReset},
-	TypeRune:           Attr{Fg: tcell.ColorYellow, Bg: tcell.ColorReset},
-	TypeInt:            Attr{Fg: tcell.ColorReset, Bg: tcell.ColorReset},
-	TypeComment:        Attr{Fg: tcell.ColorPurple, Bg: tcell.ColorReset},
-	TypeTrailingSpaces: Attr{Fg: tcell.ColorReset, Bg: tcell.ColorYellow},
-}
@@ -1,6 +1,10 @@
 package syntax
 
 import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/kybin/tor/cell"
@@ -32,22 +36,61 @@ func main() {
 `),
 			langName: "go",
 			want: []Match{
-				{Name: "package", Range: cell.Range{cell.Pt{0, 0}, cell.Pt{0, 8}}},
+				{Name: "keyword", Range: cell.Range{cell.Pt{0, 0}, cell.Pt{0, 7}}},
 				{Name: "comment", Range: cell.Range{cell.Pt{2, 0}, cell.Pt{2, 21}}},
-				{Name: "multi line comment", Range: cell.Range{cell.Pt{4, 0}, cell.Pt{8, 2}}},
+				{Name: "multi line comment", Range: cell.Range{cell.Pt{4, 0}, cell.Pt{4, 2}}},
+				{Name: "multi line comment", Range: cell.Range{cell.Pt{5, 0}, cell.Pt{5, 30}}},
+				{Name: "multi line comment", Range: cell.Range{cell.Pt{6, 0}, cell.Pt{6, 25}}},
+				{Name: "multi line comment", Range: cell.Range{cell.Pt{7, 0}, cell.Pt{7, 25}}},
+				{Name: "multi line comment", Range: cell.Range{cell.Pt{8, 0}, cell.Pt{8, 2}}},
+				{Name: "keyword", Range: cell.Range{cell.Pt{10, 0}, cell.Pt{10, 4}}},
 				{Name: "string", Range: cell.Range{cell.Pt{11, 6}, cell.Pt{11, 10}}},
 				{Name: "trailing spaces", Range: cell.Range{cell.Pt{11, 10}, cell.Pt{11, 13}}},
-				{Name: "string", Range: cell.Range{cell.Pt{12, 6}, cell.Pt{12, 9}}},
-				{Name: "string", Range: cell.Range{cell.Pt{12, 16}, cell.Pt{12, 37}}},
+				{Name: "string", Range: cell.Range{cell.Pt{12, 6}, cell.Pt{12, 37}}},
 				{Name: "rune", Range: cell.Range{cell.Pt{13, 6}, cell.Pt{13, 12}}},
 				{Name: "trailing spaces", Range: cell.Range{cell.Pt{14, 0}, cell.Pt{14, 1}}},
 			},
 		},
+		{
+			text: []byte(`if x1 == 0x1F:
+    pass
+elif info:  # done
+    return "{}".format(1.5)
+`),
+			langName: "py",
+			want: []Match{
+				{Name: "keyword", Range: cell.Range{cell.Pt{0, 0}, cell.Pt{0, 2}}},
+				{Name: "number", Range: cell.Range{cell.Pt{0, 9}, cell.Pt{0, 13}}},
+				{Name: "keyword", Range: cell.Range{cell.Pt{1, 4}, cell.Pt{1, 8}}},
+				{Name: "keyword", Range: cell.Range{cell.Pt{2, 0}, cell.Pt{2, 4}}},
+				{Name: "comment", Range: cell.Range{cell.Pt{2, 12}, cell.Pt{2, 18}}},
+				{Name: "keyword", Range: cell.Range{cell.Pt{3, 4}, cell.Pt{3, 10}}},
+				{Name: "string1", Range: cell.Range{cell.Pt{3, 11}, cell.Pt{3, 15}}},
+				{Name: "number", Range: cell.Range{cell.Pt{3, 23}, cell.Pt{3, 26}}},
+			},
+		},
+		{
+			text: []byte(`for f in "${files[@]}"; do # ${#x}
+	echo ${#f} $HOME
+done
+`),
+			langName: "sh",
+			want: []Match{
+				{Name: "keyword", Range: cell.Range{cell.Pt{0, 0}, cell.Pt{0, 3}}},
+				{Name: "keyword", Range: cell.Range{cell.Pt{0, 6}, cell.Pt{0, 8}}},
+				{Name: "string1", Range: cell.Range{cell.Pt{0, 9}, cell.Pt{0, 22}}},
+				{Name: "keyword", Range: cell.Range{cell.Pt{0, 24}, cell.Pt{0, 26}}},
+				{Name: "comment", Range: cell.Range{cell.Pt{0, 27}, cell.Pt{0, 34}}},
+				{Name: "variable", Range: cell.Range{cell.Pt{1, 6}, cell.Pt{1, 11}}},
+				{Name: "variable", Range: cell.Range{cell.Pt{1, 12}, cell.Pt{1, 17}}},
+				{Name: "keyword", Range: cell.Range{cell.Pt{2, 0}, cell.Pt{2, 4}}},
+			},
+		},
 	}
 	for _, c := range cases {
-		p := NewParser(&B{c.text}, c.langName)
-		p.ParseTo(cell.Pt{1000, 0})
-		got := p.Matches
+		p := NewParser(newLines(string(c.text)), NewLanguage(c.langName))
+		p.ParseTo(1000)
+		got := p.Matches()
 		if len(got) != len(c.want) {
 			t.Fatalf("(%v).ParseTo(end): got %v, want %v", p, got, c.want)
 		}
@@ -59,13 +102,20 @@ func main() {
 	}
 }
 
-// B implements Byter
-type B struct {
-	text []byte
+// lines implements Text.
+type lines []string
+
+func newLines(s string) *lines {
+	ls := lines(strings.Split(s, "\n"))
+	return &ls
+}
+
+func (ls *lines) NumLines() int {
+	return len(*ls)
 }
 
-func (b *B) Bytes() []byte {
-	return b.text
+func (ls *lines) LineData(l int) string {
+	return (*ls)[l]
 }
 
 // sameMatch returns whether those are same match.
@@ -73,3 +123,238 @@ func (b *B) Bytes() []byte {
 func sameMatch(m, n Match) bool {
 	return m.Name == n.Name && m.Range == n.Range
 }
+
+// countLines is a Text that counts how many lines are read.
+type countLines struct {
+	lines
+	read int
+}
+
+func (c *countLines) LineData(l int) string {
+	c.read++
+	return c.lines[l]
+}
+
+// set replaces lines [l, l+removed) with ins, and tells it to p.
+func (c *countLines) set(p *Parser, l, removed int, ins ...string) {
+	if removed == len(ins) {
+		copy(c.lines[l:], ins)
+		p.Changed(l, removed, len(ins))
+		return
+	}
+	lines := append([]string{}, c.lines[:l]...)
+	lines = append(lines, ins...)
+	c.lines = append(lines, c.lines[l+removed:]...)
+	p.Changed(l, removed, len(ins))
+}
+
+func TestParserChanged(t *testing.T) {
+	text := &countLines{}
+	for i := 0; i < 100; i++ {
+		text.lines = append(text.lines, "x := 1 // comment")
+	}
+	p := NewParser(text, NewLanguage("go"))
+	p.ParseTo(100)
+	if text.read != 100 {
+		t.Fatalf("ParseTo: read %d lines, want 100", text.read)
+	}
+	comments := func() int {
+		n := 0
+		for _, m := range p.Matches() {
+			if m.Type == TypeComment {
+				n++
+			}
+		}
+		return n
+	}
+
+	// an edit that doesn't change the state only parses the line.
+	text.read = 0
+	text.set(p, 50, 1, "y := 2")
+	p.ParseTo(100)
+	if text.read != 1 || comments() != 99 {
+		t.Fatalf("ParseTo: read %d lines and got %d comments, want 1 and 99", text.read, comments())
+	}
+
+	// an unclosed block comment makes following lines to be parsed again.
+	text.read = 0
+	text.set(p, 10, 0, "/*")
+	p.ParseTo(101)
+	if text.read != 91 {
+		t.Fatalf("ParseTo: read %d lines, want 91", text.read)
+	}
+	if m := p.Matches(); m[len(m)-1].Name != "multi line comment" || m[len(m)-1].Range.Max() != (cell.Pt{100, 17}) {
+		t.Fatalf("ParseTo: the last line is not inside of a block comment, got %v", m[len(m)-1])
+	}
+
+	// closing it makes the lines after it to be parsed again.
+	text.read = 0
+	text.set(p, 20, 1, "*/")
+	p.ParseTo(101)
+	if text.read != 81 {
+		t.Fatalf("ParseTo: read %d lines, want 81", text.read)
+	}
+	if m := p.Matches(); m[len(m)-1].Name != "comment" {
+		t.Fatalf("ParseTo: the last line is still inside of a block comment, got %v", m[len(m)-1])
+	}
+
+	// lines are parsed only to the end.
+	text.read = 0
+	text.set(p, 0, 0, "/*")
+	p.ParseTo(10)
+	if text.read != 10 {
+		t.Fatalf("ParseTo(10): read %d lines, want 10", text.read)
+	}
+}
+
+func TestLineMatches(t *testing.T) {
+	text := newLines("x := 1 /* a\nb */ s := \"c\"\n\"d\"")
+	p := NewParser(text, NewLanguage("go"))
+	if got := p.LineMatches(0); got != nil {
+		t.Fatalf("LineMatches(0): got %v before parsing, want nil", got)
+	}
+	p.ParseTo(2)
+	want := [][]Match{
+		{
+			{Name: "number", Range: cell.Range{cell.Pt{0, 5}, cell.Pt{0, 6}}},
+			{Name: "multi line comment", Range: cell.Range{cell.Pt{0, 7}, cell.Pt{0, 11}}},
+		},
+		{
+			{Name: "multi line comment", Range: cell.Range{cell.Pt{1, 0}, cell.Pt{1, 4}}},
+			{Name: "string", Range: cell.Range{cell.Pt{1, 10}, cell.Pt{1, 13}}},
+		},
+		nil, // not parsed yet.
+	}
+	for l, w := range want {
+		got := p.LineMatches(l)
+		if len(got) != len(w) {
+			t.Fatalf("LineMatches(%d): got %v, want %v", l, got, w)
+		}
+		for i := range got {
+			if !sameMatch(got[i], w[i]) {
+				t.Fatalf("LineMatches(%d): got %v, want %v", l, got, w)
+			}
+		}
+	}
+}
+
+func TestEscapedQuotes(t *testing.T) {
+	cases := []struct {
+		lang string
+		line string
+		want []Match
+	}{
+		{"go", `s := "a\"b" + "c"`, []Match{
+			{Name: "string", Range: cell.Range{cell.Pt{0, 5}, cell.Pt{0, 11}}},
+			{Name: "string", Range: cell.Range{cell.Pt{0, 14}, cell.Pt{0, 17}}},
+		}},
+		{"go", `r := '\''`, []Match{
+			{Name: "rune", Range: cell.Range{cell.Pt{0, 5}, cell.Pt{0, 9}}},
+		}},
+		{"py", `s = 'it\'s' + "\\"`, []Match{
+			{Name: "string2", Range: cell.Range{cell.Pt{0, 4}, cell.Pt{0, 11}}},
+			{Name: "string1", Range: cell.Range{cell.Pt{0, 14}, cell.Pt{0, 18}}},
+		}},
+		{"ts", `s = "a\"b"`, []Match{
+			{Name: "string1", Range: cell.Range{cell.Pt{0, 4}, cell.Pt{0, 10}}},
+		}},
+	}
+	for _, c := range cases {
+		p := NewParser(newLines(c.line), NewLanguage(c.lang))
+		p.ParseTo(1)
+		got := p.LineMatches(0)
+		if len(got) != len(c.want) {
+			t.Fatalf("%v %q: got %v, want %v", c.lang, c.line, got, c.want)
+		}
+		for i := range got {
+			if !sameMatch(got[i], c.want[i]) {
+				t.Fatalf("%v %q: got %v, want %v", c.lang, c.line, got, c.want)
+			}
+		}
+	}
+}
+
+// largeGoText returns a large go text made of go files of tor.
+func largeGoText(b *testing.B) *countLines {
+	files, err := filepath.Glob("../*.go")
+	if err != nil || len(files) == 0 {
+		b.Fatalf("could not find go files: %v", err)
+	}
+	text := &countLines{}
+	for len(text.lines) < 100000 {
+		for _, f := range files {
+			data, err := ioutil.ReadFile(f)
+			if err != nil {
+				b.Fatal(err)
+			}
+			text.lines = append(text.lines, strings.Split(string(data), "\n")...)
+		}
+	}
+	return text
+}
+
+func BenchmarkParseLargeGo(b *testing.B) {
+	text := largeGoText(b)
+	lang := NewLanguage("go")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := NewParser(text, lang)
+		p.ParseTo(len(text.lines))
+	}
+}
+
+// BenchmarkEditLargeGo parses a window at the end of a large go text, after typing in the window.
+func BenchmarkEditLargeGo(b *testing.B) {
+	text := largeGoText(b)
+	p := NewParser(text, NewLanguage("go"))
+	p.ParseTo(len(text.lines))
+	l := len(text.lines) - 50
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		text.set(p, l, 1, text.lines[l]+"x")
+		p.ParseTo(len(text.lines))
+	}
+}
+
+// BenchmarkEditLargeGoBlockComment opens and closes a block comment at the start of a large go text.
+// It needs to parse the whole text again.
+func BenchmarkEditLargeGoBlockComment(b *testing.B) {
+	text := largeGoText(b)
+	p := NewParser(text, NewLanguage("go"))
+	p.ParseTo(len(text.lines))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		text.set(p, 0, 0, "/*")
+		p.ParseTo(len(text.lines))
+		text.set(p, 0, 1)
+		p.ParseTo(len(text.lines))
+	}
+}
+
+func TestFirstBytes(t *testing.T) {
+	cases := []struct {
+		re   string
+		want string // "" means any byte.
+	}{
+		{`^(?i)(?:from|run)\b`, "FRfr"},
+		{`^[ \t]+$`, "\t "},
+		{`^/[*]`, "/"},
+		{`^b?r"`, "br"},
+		{`^(?:0[xX][0-9a-fA-F]+|[0-9]+)`, "0123456789"},
+		{`^.*`, ""},
+	}
+	for _, c := range cases {
+		first := firstBytes(regexp.MustCompile(c.re))
+		got := ""
+		if first != nil {
+			for b := 0; b < 256; b++ {
+				if first[b] {
+					got += string(rune(b))
+				}
+			}
+		}
+		if got != c.want {
+			t.Fatalf("firstBytes(%q): got %q, want %q", c.re, got, c.want)
+		}
+	}
+}
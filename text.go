@@ -6,6 +6,7 @@ import (
 	"unicode/utf8"
 
 	"github.com/kybin/tor/cell"
+	"github.com/kybin/tor/data"
 )
 
 // Line
@@ -13,7 +14,7 @@ type Line struct {
 	data string
 }
 
-func (ln *Line) Boc() int {
+func (ln Line) Boc() int {
 	remain := ln.data
 	b := 0
 	for len(remain) > 0 {
@@ -27,105 +28,146 @@ func (ln *Line) Boc() int {
 	return b
 }
 
-func (ln *Line) Insert(r string, b int) {
-	ln.data = ln.data[:b] + r + ln.data[b:]
-}
-
-func (ln *Line) Remove(from, to int) string {
-	deleted := ln.data[from:to]
-	ln.data = ln.data[:from] + ln.data[to:]
-	return deleted
-}
-
-// Text
+// Text is a façade of data.Text, that speaks in lines.
+// Edits on it are proportional to the edit size, not the text size.
 type Text struct {
-	lines      []Line
+	data       *data.Text
 	tabToSpace bool
 	tabWidth   int
 	edited     bool
 	writable   bool
 	lineEnding string
+
+	// onChange is called after lines [l, l+removed) are replaced with inserted lines.
+	onChange func(l, removed, inserted int)
+
+	// matches is cached numbers of matches of the last regexp that is searched.
+	matches *matchCounts
+
+	// recording is depth of nested recordings.
+	// While it is not 0, applied edits are collected in records.
+	recording int
+	records   []edit
 }
 
-func (t *Text) Line(l int) *Line {
-	return &t.lines[l]
+// NewText creates a new Text that has lines.
+func NewText(lines []string) *Text {
+	return &Text{data: data.NewText([]byte(strings.Join(lines, "\n")))}
+}
+
+// NumLines returns number of lines in the text.
+func (t *Text) NumLines() int {
+	return t.data.Lines()
+}
+
+// Line returns line l.
+func (t *Text) Line(l int) Line {
+	return Line{t.LineData(l)}
+}
+
+// LineData returns data of line l.
+func (t *Text) LineData(l int) string {
+	return string(t.data.Line(l))
+}
+
+// lineLen returns byte length of line l.
+func (t *Text) lineLen(l int) int {
+	return t.data.LineEnd(l) - t.data.LineStart(l)
 }
 
 func (t *Text) JoinNextLine(l int) {
-	t.lines = append(append(t.lines[:l], Line{t.lines[l].data + t.lines[l+1].data}), t.lines[l+2:]...)
+	t.Apply(deleteEdit{l, t.lineLen(l), "\n"})
 }
 
 func (t *Text) SplitLine(l, b int) {
-	prev := t.lines[l].data[:b]
-	next := t.lines[l].data[b:]
-	t.lines[l].data = prev
-	t.InsertLine(Line{next}, l)
+	t.Apply(insertEdit{l, b, "\n"})
 }
 
+// InsertLine inserts ln after line l.
 func (t *Text) InsertLine(ln Line, l int) {
-	t.lines = append(append(append([]Line{}, t.lines[:l+1]...), ln), t.lines[l+1:]...)
+	t.Apply(insertEdit{l, t.lineLen(l), "\n" + ln.data})
 }
 
 func (t *Text) RemoveLine(l int) string {
-	deleted := t.lines[l]
-	t.lines = append(append([]Line{}, t.lines[:l]...), t.lines[l+1:]...)
-	return deleted.data + "\n"
+	data := t.LineData(l)
+	if l == t.NumLines()-1 {
+		if l == 0 {
+			t.Apply(deleteEdit{l, 0, data})
+		} else {
+			// the last line doesn't have a newline. remove the prev one instead.
+			t.Apply(deleteEdit{l - 1, t.lineLen(l - 1), "\n" + data})
+		}
+		return data + "\n"
+	}
+	t.Apply(deleteEdit{l, 0, data + "\n"})
+	return data + "\n"
 }
 
 func (t *Text) RemoveRange(min, max cell.Pt) string {
-	deleted := ""
-	if min.L == max.L {
-		deleted = t.lines[min.L].data[min.O:max.O]
-	} else {
-		focusLines := t.lines[min.L : max.L+1]
-		for i, line := range focusLines {
-			if i == 0 {
-				deleted += line.data[min.O:]
-			} else if i == len(focusLines)-1 {
-				deleted += "\n"
-				deleted += line.data[:max.O]
-			} else {
-				deleted += "\n"
-				deleted += line.data
-			}
-		}
+	s := t.DataInside(min, max)
+	if s != "" {
+		t.Apply(deleteEdit{min.L, min.O, s})
 	}
-	t.lines = append(append(append([]Line{}, t.lines[:min.L]...), Line{t.lines[min.L].data[:min.O] + t.lines[max.L].data[max.O:]}), t.lines[max.L+1:]...)
-	return deleted
+	return s
 }
 
 func (t *Text) Insert(r string, l, b int) {
-	t.lines[l].Insert(r, b)
+	if r == "" {
+		return
+	}
+	t.Apply(insertEdit{l, b, r})
 }
 
 func (t *Text) Remove(l, from, to int) string {
-	return t.lines[l].Remove(from, to)
+	s := string(t.data.Range(t.data.Offset(l, from), t.data.Offset(l, to)))
+	if s != "" {
+		t.Apply(deleteEdit{l, from, s})
+	}
+	return s
 }
 
-func (t *Text) DataInside(min, max cell.Pt) string {
-	if min.L == max.L {
-		return t.lines[min.L].data[min.O:max.O]
+// changed tells the change of lines to onChange.
+func (t *Text) changed(l, removed, inserted int) {
+	if t.matches != nil {
+		t.matches.changed(l, removed, inserted)
 	}
-	data := ""
-	for l := min.L; l < max.L+1; l++ {
-		if l == min.L {
-			data += t.lines[l].data[min.O:]
-		} else if l == max.L {
-			data += t.lines[l].data[:max.O]
-		} else {
-			data += t.lines[l].data
-		}
-		if l != max.L {
-			data += "\n"
-		}
+	if t.onChange != nil {
+		t.onChange(l, removed, inserted)
 	}
-	return data
 }
 
-func (t *Text) Bytes() []byte {
-	datas := []string{}
-	for _, l := range t.lines {
-		datas = append(datas, l.data)
+// Apply applies an edit to the text. The edit is recorded if the text is recording.
+func (t *Text) Apply(e edit) {
+	e.apply(t)
+	if t.recording != 0 {
+		t.records = append(t.records, e)
+	}
+}
+
+// StartRecord starts recording edits applied to the text.
+// It returns a mark, that should be passed to the paired StopRecord.
+// Recordings could be nested.
+func (t *Text) StartRecord() int {
+	t.recording++
+	return len(t.records)
+}
+
+// StopRecord stops a recording started with mark,
+// and returns edits applied during the recording.
+func (t *Text) StopRecord(mark int) []edit {
+	edits := make([]edit, len(t.records)-mark)
+	copy(edits, t.records[mark:])
+	t.recording--
+	if t.recording == 0 {
+		t.records = nil
 	}
-	return []byte(strings.Join(datas, "\n"))
+	return edits
+}
+
+func (t *Text) DataInside(min, max cell.Pt) string {
+	return string(t.data.Range(t.data.Offset(min.L, min.O), t.data.Offset(max.L, max.O)))
+}
+
+func (t *Text) Bytes() []byte {
+	return t.data.Bytes()
 }
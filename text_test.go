@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/kybin/tor/cell"
@@ -8,81 +9,203 @@ import (
 
 func TestRemoveRange(t *testing.T) {
 	cases := []struct {
-		in       Text
+		in       []string
 		min, max cell.Pt
-		want     Text
+		want     []string
 	}{
 		{
-			Text{lines: []Line{
-				{"Hello, my name is yongbin."},
-				{"This is the test string."},
-				{"You are great."},
-			}},
+			[]string{
+				"Hello, my name is yongbin.",
+				"This is the test string.",
+				"You are great.",
+			},
 			cell.Pt{0, 6}, cell.Pt{2, 7},
-			Text{lines: []Line{
-				{"Hello, great."},
-			}},
+			[]string{
+				"Hello, great.",
+			},
 		},
 		{
-			Text{lines: []Line{
-				{"blizzard"},
-				{"	wow"},
-				{"	Diablo"},
-			}},
+			[]string{
+				"blizzard",
+				"	wow",
+				"	Diablo",
+			},
 			cell.Pt{0, 0}, cell.Pt{1, 0},
-			Text{lines: []Line{
-				{"	wow"},
-				{"	Diablo"},
-			}},
+			[]string{
+				"	wow",
+				"	Diablo",
+			},
 		},
 		{
-			Text{lines: []Line{
-				{"The delete built-in function"},
-				{"deletes the element"},
-				{"with the specified key (m[key]) from the map."},
-				{"If m is nil or there is no such element,"},
-				{"delete is a no-op."},
-			}},
+			[]string{
+				"The delete built-in function",
+				"deletes the element",
+				"with the specified key (m[key]) from the map.",
+				"If m is nil or there is no such element,",
+				"delete is a no-op.",
+			},
 			cell.Pt{0, 0}, cell.Pt{4, 18},
-			Text{lines: []Line{
-				{""},
-			}},
+			[]string{
+				"",
+			},
 		},
 		{
-			Text{lines: []Line{
-				{"Text is a set of lines."},
-				{"Lines is a slice of bytes."},
-			}},
+			[]string{
+				"Text is a set of lines.",
+				"Lines is a slice of bytes.",
+			},
 			cell.Pt{0, 10}, cell.Pt{0, 10},
-			Text{lines: []Line{
-				{"Text is a set of lines."},
-				{"Lines is a slice of bytes."},
-			}},
+			[]string{
+				"Text is a set of lines.",
+				"Lines is a slice of bytes.",
+			},
 		},
 		{
-			Text{lines: []Line{
-				{"		for o := viewer.min.o ; o < viewer.max.o ; o++ {"},
-				{"			SetCell(l, o, ' ', term.ColorDefault, term.ColorDefault)"},
-			}},
+			[]string{
+				"		for o := viewer.min.o ; o < viewer.max.o ; o++ {",
+				"			SetCell(l, o, ' ', term.ColorDefault, term.ColorDefault)",
+			},
 			cell.Pt{0, BFromO("		for o := viewer.min.o ; o < viewer.max.o ; o++ {", 17, 4)}, cell.Pt{1, BFromO("			SetCell(l, o, ' ', term.ColorDefault, term.ColorDefault)", 19, 4)},
-			Text{lines: []Line{
-				{"		for o := (l, o, ' ', term.ColorDefault, term.ColorDefault)"},
-			}},
+			[]string{
+				"		for o := (l, o, ' ', term.ColorDefault, term.ColorDefault)",
+			},
 		},
 	}
 	for _, c := range cases {
-		in := c.in
-		c.in.RemoveRange(c.min, c.max)
-		got := c.in
-		if len(c.in.lines) != len(c.in.lines) {
-			t.Fatalf("len(got.lines) != len(want.lines), len(got.lines)==%q, len(want.lines)==%q", len(c.in.lines), len(c.want.lines))
+		text := NewText(c.in)
+		text.RemoveRange(c.min, c.max)
+		got := textLines(text)
+		if len(got) != len(c.want) {
+			t.Fatalf("len(got.lines) != len(want.lines), len(got.lines)==%d, len(want.lines)==%d", len(got), len(c.want))
 		}
-		var wantl Line
-		for i, gotl := range c.in.lines {
-			wantl = c.want.lines[i]
-			if gotl.data != wantl.data {
-				t.Fatalf("%v.RemoveRange(%v, %v) == %v, want %v", in, c.min, c.max, got, c.want)
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Fatalf("%v.RemoveRange(%v, %v) == %v, want %v", c.in, c.min, c.max, got, c.want)
 			}
 		}
 	}
 }
+
+func TestTextEdit(t *testing.T) {
+	text := NewText([]string{"package main", "", "func main() {", "}"})
+	text.Insert("\tprintln(\"hi\")", 2, len("func main() {"))
+	text.SplitLine(2, len("func main() {"))
+	text.InsertLine(Line{"// main prints hi."}, 1)
+	removed := text.RemoveLine(5)
+	text.JoinNextLine(0)
+	text.Remove(0, 0, len("package "))
+
+	want := []string{"main", "// main prints hi.", "func main() {", "\tprintln(\"hi\")"}
+	got := textLines(text)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if removed != "}\n" {
+		t.Fatalf("RemoveLine: got %q, want %q", removed, "}\n")
+	}
+}
+
+// textLines returns lines of t as a string slice.
+func textLines(t *Text) []string {
+	lines := make([]string, 0, t.NumLines())
+	for l := 0; l < t.NumLines(); l++ {
+		lines = append(lines, t.LineData(l))
+	}
+	return lines
+}
+
+// sliceText is the previous Text implementation, which is a slice of lines.
+// It is here to compare performance with the current Text.
+type sliceText struct {
+	lines []Line
+}
+
+func (t *sliceText) SplitLine(l, b int) {
+	prev := t.lines[l].data[:b]
+	next := t.lines[l].data[b:]
+	t.lines[l].data = prev
+	t.lines = append(append(append([]Line{}, t.lines[:l+1]...), Line{next}), t.lines[l+1:]...)
+}
+
+func (t *sliceText) JoinNextLine(l int) {
+	t.lines = append(append(t.lines[:l], Line{t.lines[l].data + t.lines[l+1].data}), t.lines[l+2:]...)
+}
+
+func (t *sliceText) Insert(r string, l, b int) {
+	ln := &t.lines[l]
+	ln.data = ln.data[:b] + r + ln.data[b:]
+}
+
+// benchLines returns n lines of generated go code.
+func benchLines(n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = "\tfixture = append(fixture, Fixture{Name: \"generated\", Value: 42})"
+	}
+	return lines
+}
+
+const benchSize = 200000
+
+func BenchmarkTextSplitLine(b *testing.B) {
+	text := NewText(benchLines(benchSize))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l := (i * 7919) % (benchSize / 2)
+		text.SplitLine(l, 10)
+		text.JoinNextLine(l)
+	}
+}
+
+func BenchmarkSliceTextSplitLine(b *testing.B) {
+	text := &sliceText{}
+	for _, ln := range benchLines(benchSize) {
+		text.lines = append(text.lines, Line{ln})
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l := (i * 7919) % (benchSize / 2)
+		text.SplitLine(l, 10)
+		text.JoinNextLine(l)
+	}
+}
+
+func BenchmarkTextTyping(b *testing.B) {
+	text := NewText(benchLines(benchSize))
+	l := benchSize / 2
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		text.Insert("a", l, i%80)
+		if i%80 == 79 {
+			text.SplitLine(l, 80)
+			l++
+		}
+	}
+}
+
+func BenchmarkSliceTextTyping(b *testing.B) {
+	text := &sliceText{}
+	for _, ln := range benchLines(benchSize) {
+		text.lines = append(text.lines, Line{ln})
+	}
+	l := benchSize / 2
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		text.Insert("a", l, i%80)
+		if i%80 == 79 {
+			text.SplitLine(l, 80)
+			l++
+		}
+	}
+}
+
+func BenchmarkTextLineData(b *testing.B) {
+	text := NewText(benchLines(benchSize))
+	for l := 0; l < benchSize; l += 100 {
+		text.SplitLine(l, 10)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		text.LineData(i % text.NumLines())
+	}
+}
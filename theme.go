@@ -0,0 +1,312 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/kybin/tor/syntax"
+)
+
+// builtinThemes are themes those are shipped with tor.
+// They are written in the same format with user's theme files.
+//
+//go:embed themes/*.json
+var builtinThemes embed.FS
+
+// defaultTheme is the theme used when a theme is not chosen.
+const defaultTheme = "dark"
+
+// themeConfig is a config file that has the name of the chosen theme.
+const themeConfig = "theme"
+
+// Attr is foreground and background colors of a cell.
+// A zero Attr uses the terminal's default colors.
+type Attr struct {
+	Fg tcell.Color
+	Bg tcell.Color
+}
+
+// Style returns a tcell style that has the colors.
+func (a Attr) Style() tcell.Style {
+	return tcell.StyleDefault.Background(a.Bg).Foreground(a.Fg)
+}
+
+// Theme is colors for drawing tor.
+type Theme struct {
+	Name       string
+	Text       Attr
+	Selection  Attr
+	Search     Attr
+	Status     Attr
+	Error      Attr
+	LineNumber Attr
+	// CurrentLineNumber is for the line number of the cursor line.
+	CurrentLineNumber Attr
+	// Modified is for the gutter marker of modified lines.
+	Modified Attr
+	// Syntax is colors of syntax types. Text is used for a type that is not in it.
+	Syntax map[syntax.Type]Attr
+}
+
+// SyntaxAttr returns colors of a syntax type.
+func (th *Theme) SyntaxAttr(t syntax.Type) Attr {
+	if a, ok := th.Syntax[t]; ok {
+		return a
+	}
+	return th.Text
+}
+
+// Fit changes colors those a screen that shows n colors cannot show,
+// to the closest colors of the screen's palette.
+// n is usually from tcell.Screen.Colors, that is 1<<24 for a true color terminal.
+func (th *Theme) Fit(n int) {
+	if n >= 1<<24 {
+		return
+	}
+	if n > 256 {
+		n = 256
+	}
+	palette := make([]tcell.Color, n)
+	for i := range palette {
+		palette[i] = tcell.PaletteColor(i)
+	}
+	fit := func(c tcell.Color) tcell.Color {
+		if !c.Valid() {
+			// default or reset.
+			return c
+		}
+		if !c.IsRGB() && int(c&^tcell.ColorValid) < n {
+			return c
+		}
+		return tcell.FindColor(c, palette)
+	}
+	th.Text = Attr{fit(th.Text.Fg), fit(th.Text.Bg)}
+	th.Selection = Attr{fit(th.Selection.Fg), fit(th.Selection.Bg)}
+	th.Search = Attr{fit(th.Search.Fg), fit(th.Search.Bg)}
+	th.Status = Attr{fit(th.Status.Fg), fit(th.Status.Bg)}
+	th.Error = Attr{fit(th.Error.Fg), fit(th.Error.Bg)}
+	th.LineNumber = Attr{fit(th.LineNumber.Fg), fit(th.LineNumber.Bg)}
+	th.CurrentLineNumber = Attr{fit(th.CurrentLineNumber.Fg), fit(th.CurrentLineNumber.Bg)}
+	th.Modified = Attr{fit(th.Modified.Fg), fit(th.Modified.Bg)}
+	for t, a := range th.Syntax {
+		th.Syntax[t] = Attr{fit(a.Fg), fit(a.Bg)}
+	}
+}
+
+// themeFile is a theme in a theme file.
+// An attr that is not in the file is same as the base theme's.
+type themeFile struct {
+	Base              string              `json:"base"`
+	Text              *attrFile           `json:"text"`
+	Selection         *attrFile           `json:"selection"`
+	Search            *attrFile           `json:"search"`
+	Status            *attrFile           `json:"status"`
+	Error             *attrFile           `json:"error"`
+	LineNumber        *attrFile           `json:"lineNumber"`
+	CurrentLineNumber *attrFile           `json:"currentLineNumber"`
+	Modified          *attrFile           `json:"modified"`
+	Syntax            map[string]attrFile `json:"syntax"`
+}
+
+// attrFile is an attr in a theme file.
+// A color is one of these, and an empty color is the terminal's default.
+//
+//	"#ff8700"  a true color.
+//	"208"      a color of 256 color palette.
+//	"orange"   a color name of W3C.
+//	"default"  the terminal's default color.
+type attrFile struct {
+	Fg string `json:"fg"`
+	Bg string `json:"bg"`
+}
+
+// parseColor parses a color in a theme file.
+func parseColor(s string) (tcell.Color, error) {
+	switch s {
+	case "":
+		return tcell.ColorDefault, nil
+	case "default":
+		return tcell.ColorReset, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 || n > 255 {
+			return 0, fmt.Errorf("palette color should be in 0-255: %v", s)
+		}
+		return tcell.PaletteColor(n), nil
+	}
+	if strings.HasPrefix(s, "#") {
+		if len(s) != 7 {
+			return 0, fmt.Errorf("invalid hex color: %v", s)
+		}
+		v, err := strconv.ParseInt(s[1:], 16, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid hex color: %v", s)
+		}
+		return tcell.NewHexColor(int32(v)), nil
+	}
+	c, ok := tcell.ColorNames[strings.ToLower(s)]
+	if !ok {
+		return 0, fmt.Errorf("unknown color: %v", s)
+	}
+	return c, nil
+}
+
+// parseAttr parses an attr in a theme file.
+func parseAttr(af attrFile) (Attr, error) {
+	fg, err := parseColor(af.Fg)
+	if err != nil {
+		return Attr{}, err
+	}
+	bg, err := parseColor(af.Bg)
+	if err != nil {
+		return Attr{}, err
+	}
+	return Attr{Fg: fg, Bg: bg}, nil
+}
+
+// parseTheme parses a theme named name from r.
+// When the theme has a base, it is found from bases.
+func parseTheme(name string, r io.Reader, bases map[string]*Theme) (*Theme, error) {
+	var tf themeFile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&tf); err != nil {
+		return nil, err
+	}
+	th := &Theme{Syntax: make(map[syntax.Type]Attr)}
+	if tf.Base != "" {
+		base, ok := bases[tf.Base]
+		if !ok {
+			return nil, fmt.Errorf("unknown base theme: %v", tf.Base)
+		}
+		*th = *base
+		th.Syntax = make(map[syntax.Type]Attr)
+		for t, a := range base.Syntax {
+			th.Syntax[t] = a
+		}
+	}
+	th.Name = name
+	fields := []struct {
+		name string
+		af   *attrFile
+		attr *Attr
+	}{
+		{"text", tf.Text, &th.Text},
+		{"selection", tf.Selection, &th.Selection},
+		{"search", tf.Search, &th.Search},
+		{"status", tf.Status, &th.Status},
+		{"error", tf.Error, &th.Error},
+		{"lineNumber", tf.LineNumber, &th.LineNumber},
+		{"currentLineNumber", tf.CurrentLineNumber, &th.CurrentLineNumber},
+		{"modified", tf.Modified, &th.Modified},
+	}
+	for _, f := range fields {
+		if f.af == nil {
+			continue
+		}
+		a, err := parseAttr(*f.af)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", f.name, err)
+		}
+		*f.attr = a
+	}
+	for tname, af := range tf.Syntax {
+		t, ok := syntax.TypeByName(tname)
+		if !ok {
+			return nil, fmt.Errorf("syntax: unknown type %q", tname)
+		}
+		a, err := parseAttr(af)
+		if err != nil {
+			return nil, fmt.Errorf("syntax %v: %v", tname, err)
+		}
+		th.Syntax[t] = a
+	}
+	return th, nil
+}
+
+// themeDir is the directory for theme files, in config directory.
+const themeDir = "themes"
+
+// loadThemes loads built-in themes and theme files (*.json) in themeDir.
+// A theme's name is it's file name without the extension.
+// A theme file overrides a built-in theme that has the same name,
+// but it's base is always a built-in theme.
+// It skips files that have errors, and returns the errors.
+func loadThemes() (map[string]*Theme, []error) {
+	builtins := make(map[string]*Theme)
+	files, err := builtinThemes.ReadDir("themes")
+	if err != nil {
+		panic(err)
+	}
+	for _, f := range files {
+		data, err := builtinThemes.ReadFile(path.Join("themes", f.Name()))
+		if err != nil {
+			panic(err)
+		}
+		name := strings.TrimSuffix(f.Name(), ".json")
+		th, err := parseTheme(name, strings.NewReader(string(data)), nil)
+		if err != nil {
+			panic(fmt.Sprintf("built-in theme %v: %v", f.Name(), err))
+		}
+		builtins[name] = th
+	}
+	themes := make(map[string]*Theme)
+	for name, th := range builtins {
+		themes[name] = th
+	}
+	userFiles, err := filepath.Glob(filepath.Join(configDir, themeDir, "*.json"))
+	if err != nil {
+		return themes, []error{err}
+	}
+	sort.Strings(userFiles)
+	errs := make([]error, 0)
+	for _, f := range userFiles {
+		r, err := os.Open(f)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(f), ".json")
+		th, err := parseTheme(name, r, builtins)
+		r.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %v", f, err))
+			continue
+		}
+		themes[name] = th
+	}
+	return themes, errs
+}
+
+// themeNames returns sorted names of the themes.
+func themeNames(themes map[string]*Theme) []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// chooseTheme returns the theme chosen in the theme config, or the default theme.
+// When the chosen theme is not in themes, it returns the default theme with an error.
+func chooseTheme(themes map[string]*Theme) (*Theme, error) {
+	name := strings.TrimSpace(loadConfig(themeConfig))
+	if name == "" {
+		name = defaultTheme
+	}
+	th, ok := themes[name]
+	if !ok {
+		return themes[defaultTheme], fmt.Errorf("%v: unknown theme: %v", path.Join(configDir, themeConfig), name)
+	}
+	return th, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/kybin/tor/syntax"
+)
+
+func TestParseColor(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    tcell.Color
+		wantErr bool
+	}{
+		{in: "", want: tcell.ColorDefault},
+		{in: "default", want: tcell.ColorReset},
+		{in: "#ff8700", want: tcell.NewHexColor(0xff8700)},
+		{in: "208", want: tcell.PaletteColor(208)},
+		{in: "Yellow", want: tcell.ColorYellow},
+		{in: "256", wantErr: true},
+		{in: "#ff87", wantErr: true},
+		{in: "#gg8700", wantErr: true},
+		{in: "not-a-color", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := parseColor(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Fatalf("parseColor(%q): want error, got %v", c.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("parseColor(%q): got error %v", c.in, err)
+		}
+		if got != c.want {
+			t.Fatalf("parseColor(%q): got %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestParseTheme(t *testing.T) {
+	base := &Theme{
+		Name:      "base",
+		Selection: Attr{Fg: tcell.ColorReset, Bg: tcell.ColorGreen},
+		Syntax: map[syntax.Type]Attr{
+			syntax.TypeKeyword: {Fg: tcell.ColorYellow},
+			syntax.TypeComment: {Fg: tcell.ColorPurple},
+		},
+	}
+	bases := map[string]*Theme{"base": base}
+	cases := []struct {
+		in      string
+		wantErr string
+	}{
+		{
+			in:      `{"base": "base", "status": {"fg": "#000000", "bg": "#e0e0e0"}, "syntax": {"comment": {"fg": "245"}}}`,
+			wantErr: "",
+		},
+		{
+			in:      `{"base": "not-exist"}`,
+			wantErr: "unknown base theme",
+		},
+		{
+			in:      `{"status": {"fg": "blue-ish"}}`,
+			wantErr: "status: unknown color",
+		},
+		{
+			in:      `{"syntax": {"function": {"fg": "blue"}}}`,
+			wantErr: `unknown type "function"`,
+		},
+		{
+			in:      `{"cursor": {"fg": "blue"}}`,
+			wantErr: "unknown field",
+		},
+	}
+	for _, c := range cases {
+		th, err := parseTheme("mine", strings.NewReader(c.in), bases)
+		if c.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Fatalf("parseTheme(%s): got error %v, want %q", c.in, err, c.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("parseTheme(%s): got error %v", c.in, err)
+		}
+		if th.Name != "mine" || th.Selection != base.Selection || th.Status != (Attr{Fg: tcell.NewHexColor(0), Bg: tcell.NewHexColor(0xe0e0e0)}) {
+			t.Fatalf("parseTheme(%s): got %+v", c.in, th)
+		}
+		if th.SyntaxAttr(syntax.TypeKeyword).Fg != tcell.ColorYellow || th.SyntaxAttr(syntax.TypeComment).Fg != tcell.PaletteColor(245) {
+			t.Fatalf("parseTheme(%s): got syntax %v", c.in, th.Syntax)
+		}
+		if base.Syntax[syntax.TypeComment].Fg != tcell.ColorPurple {
+			t.Fatalf("parseTheme(%s): the base theme is changed", c.in)
+		}
+	}
+}
+
+func TestThemeFit(t *testing.T) {
+	newTheme := func() *Theme {
+		return &Theme{
+			Text:   Attr{Fg: tcell.ColorReset, Bg: tcell.ColorDefault},
+			Status: Attr{Fg: tcell.NewHexColor(0xff0000), Bg: tcell.PaletteColor(208)},
+		}
+	}
+	th := newTheme()
+	th.Fit(1 << 24)
+	if th.Text != newTheme().Text || th.Status != newTheme().Status {
+		t.Fatalf("Fit(1<<24): got %+v, want unchanged", th)
+	}
+
+	th = newTheme()
+	th.Fit(256)
+	if th.Text != newTheme().Text {
+		t.Fatalf("Fit(256): default colors are changed to %v", th.Text)
+	}
+	if th.Status.Fg != tcell.PaletteColor(9) || th.Status.Bg != tcell.PaletteColor(208) {
+		t.Fatalf("Fit(256): got %v", th.Status)
+	}
+
+	th = newTheme()
+	th.Fit(16)
+	if th.Status.Fg != tcell.PaletteColor(9) || th.Status.Bg.IsRGB() || int(th.Status.Bg&^tcell.ColorValid) >= 16 {
+		t.Fatalf("Fit(16): got %v", th.Status)
+	}
+}
+
+func TestLoadThemes(t *testing.T) {
+	useTempConfigDir(t)
+	dir := filepath.Join(configDir, themeDir)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"dark.json": `{"base": "dark", "selection": {"bg": "#005f87"}}`,
+		"bad.json":  `{"base": "dark", "selection": {"bg": "#005f8"}}`,
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	themes, errs := loadThemes()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "bad.json") {
+		t.Fatalf("loadThemes: got errors %v, want an error of bad.json", errs)
+	}
+	if got := themeNames(themes); strings.Join(got, " ") != "dark light" {
+		t.Fatalf("loadThemes: got themes %v", got)
+	}
+	dark := themes["dark"]
+	if dark.Selection.Bg != tcell.NewHexColor(0x005f87) || dark.SyntaxAttr(syntax.TypeKeyword).Fg != tcell.ColorYellow {
+		t.Fatalf("loadThemes: dark is not overridden from built-in dark, got %+v", dark)
+	}
+
+	if th, err := chooseTheme(themes); err != nil || th != dark {
+		t.Fatalf("chooseTheme: got %v, %v, want default theme", th, err)
+	}
+	if err := saveConfig(themeConfig, "light\n"); err != nil {
+		t.Fatal(err)
+	}
+	if th, err := chooseTheme(themes); err != nil || th.Name != "light" {
+		t.Fatalf("chooseTheme: got %v, %v, want light", th, err)
+	}
+	if err := saveConfig(themeConfig, "solarized"); err != nil {
+		t.Fatal(err)
+	}
+	if th, err := chooseTheme(themes); err == nil || th != dark {
+		t.Fatalf("chooseTheme: got %v, %v, want default theme with an error", th, err)
+	}
+}
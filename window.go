@@ -8,10 +8,15 @@ import "github.com/kybin/tor/cell"
 type Window struct {
 	min  cell.Pt
 	size cell.Pt
+
+	// wrap indicates long lines are wrapped to multiple rows, instead of scrolling horizontally.
+	wrap bool
+	// row is the first row of the top line (min.L) that is shown, when lines are wrapped.
+	row int
 }
 
 func NewWindow(size cell.Pt) *Window {
-	w := Window{cell.Pt{0, 0}, size}
+	w := Window{min: cell.Pt{0, 0}, size: size}
 	return &w
 }
 
@@ -27,6 +32,31 @@ func (w *Window) Move(t cell.Pt) {
 	w.min = w.min.Add(t)
 }
 
+// SetWrap sets whether it wraps long lines.
+func (w *Window) SetWrap(wrap bool) {
+	w.wrap = wrap
+	w.row = 0
+	w.min.O = 0
+}
+
+// WrapWidth returns width of rows that lines are wrapped at.
+// It returns 0 when it doesn't wrap lines.
+func (w *Window) WrapWidth() int {
+	if !w.wrap {
+		return 0
+	}
+	return w.size.O
+}
+
+// CursorPos returns the cursor's position from it's top left.
+// When it wraps lines, the line of the position is a row on screen.
+func (w *Window) CursorPos(c *Cursor) cell.Pt {
+	if w.wrap {
+		return w.cursorPosWrapped(c)
+	}
+	return c.Position().Sub(w.Min())
+}
+
 func (w *Window) Contains(c *Cursor) bool {
 	cp := c.Position()
 	if (w.Min().O <= cp.O && cp.O < w.Max().O) && (w.Min().L <= cp.L && cp.L < w.Max().L) {
@@ -36,13 +66,19 @@ func (w *Window) Contains(c *Cursor) bool {
 }
 
 // Follow makes Window follows to Cursor c.
+// The margin is reduced when the window is too small for it, like when a wide gutter is shown.
+// When it wraps lines, it follows by rows on screen.
 // It returns true if Window is really moved, or false.
 func (w *Window) Follow(c *Cursor, margin int) bool {
+	if w.wrap {
+		return w.followWrapped(c, margin)
+	}
 	var tl, to int
 	cp := c.Position()
 
-	minl := w.Min().L + margin
-	maxl := w.Max().L - margin
+	marginl := fitMargin(margin, w.size.L)
+	minl := w.Min().L + marginl
+	maxl := w.Max().L - marginl
 	if cp.L < minl {
 		tl = cp.L - minl
 	} else if cp.L >= maxl {
@@ -53,8 +89,9 @@ func (w *Window) Follow(c *Cursor, margin int) bool {
 		tl = -w.Min().L
 	}
 
-	mino := w.Min().O + margin
-	maxo := w.Max().O - margin
+	margino := fitMargin(margin, w.size.O)
+	mino := w.Min().O + margino
+	maxo := w.Max().O - margino
 	if cp.O < mino {
 		to = cp.O - mino
 	} else if cp.O >= maxo {
@@ -71,3 +108,14 @@ func (w *Window) Follow(c *Cursor, margin int) bool {
 	w.Move(cell.Pt{tl, to})
 	return true
 }
+
+// fitMargin returns a margin that leaves at least a cell for the cursor, in a window of size n.
+func fitMargin(margin, n int) int {
+	if 2*margin >= n {
+		margin = (n - 1) / 2
+	}
+	if margin < 0 {
+		margin = 0
+	}
+	return margin
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"unicode/utf8"
+
+	"github.com/kybin/tor/cell"
+)
+
+// wrapLine returns byte offsets where rows of the line start, when it is wrapped at width w.
+// The first row always starts at 0. A rune that doesn't fit in the rest of a row goes to the next row,
+// unless it is the first rune of the row.
+// When the last row is full, an empty row is added for the cursor at the end of the line.
+func wrapLine(line string, w, tabWidth int) []int {
+	starts := []int{0}
+	o := 0
+	for b, r := range line {
+		rw := vlen(string(r), tabWidth)
+		if o != 0 && o+rw > w {
+			starts = append(starts, b)
+			o = 0
+		}
+		o += rw
+	}
+	if o >= w {
+		starts = append(starts, len(line))
+	}
+	return starts
+}
+
+// wrapPos returns a row in starts that byte offset b is in, and visual column of b in the row.
+func wrapPos(line string, starts []int, b, tabWidth int) (row, col int) {
+	for row+1 < len(starts) && starts[row+1] <= b {
+		row++
+	}
+	return row, vlen(line[starts[row]:b], tabWidth)
+}
+
+// wrapB returns byte offset in a row of starts, that is at visual column col or left of it.
+// A position at the start of the next row is not in the row.
+func wrapB(line string, starts []int, row, col, tabWidth int) int {
+	b := starts[row]
+	end := len(line)
+	last := row == len(starts)-1
+	if !last {
+		end = starts[row+1]
+	}
+	o := 0
+	for b < end {
+		r, rlen := utf8.DecodeRuneInString(line[b:])
+		rw := vlen(string(r), tabWidth)
+		if o+rw > col || (!last && b+rlen == end) {
+			break
+		}
+		o += rw
+		b += rlen
+	}
+	return b
+}
+
+// numRows returns number of rows of line l, when lines are wrapped at width w.
+func numRows(t *Text, l, w int) int {
+	return len(wrapLine(t.LineData(l), w, t.tabWidth))
+}
+
+// upRows returns a row that is n rows above row of line l, in wrapped lines.
+// It stops at the first row of the text.
+func upRows(t *Text, l, row, n, w int) (int, int) {
+	for n > 0 {
+		if row >= n {
+			return l, row - n
+		}
+		if l == 0 {
+			return 0, 0
+		}
+		n -= row + 1
+		l--
+		row = numRows(t, l, w) - 1
+	}
+	return l, row
+}
+
+// rowsBetween returns number of rows from row r1 of line l1 to row r2 of line l2, in wrapped lines.
+// It counts rows only up to max, and returns max when there are more.
+// It returns a negative number when the second one is above.
+func rowsBetween(t *Text, l1, r1, l2, r2, max, w int) int {
+	if l2 < l1 || (l2 == l1 && r2 < r1) {
+		return -rowsBetween(t, l2, r2, l1, r1, max, w)
+	}
+	n := -r1
+	for l := l1; l < l2; l++ {
+		n += numRows(t, l, w)
+		if n >= max {
+			return max
+		}
+	}
+	n += r2
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// moveRow moves the cursor d rows up (negative) or down (positive) in wrapped lines.
+// It tries to keep the cursor's column in a row.
+func (c *Cursor) moveRow(d int) {
+	tw := c.text.tabWidth
+	starts := wrapLine(c.LineData(), c.wrapWidth, tw)
+	row, col := wrapPos(c.LineData(), starts, c.b, tw)
+	if c.rowColAt != c.BytePos() {
+		c.rowCol = col
+	}
+	row += d
+	for row < 0 {
+		if c.OnFirstLine() {
+			return
+		}
+		c.l--
+		starts = wrapLine(c.LineData(), c.wrapWidth, tw)
+		row += len(starts)
+	}
+	for row >= len(starts) {
+		if c.OnLastLine() {
+			return
+		}
+		row -= len(starts)
+		c.l++
+		starts = wrapLine(c.LineData(), c.wrapWidth, tw)
+	}
+	c.SetB(wrapB(c.LineData(), starts, row, c.rowCol, tw))
+	c.rowColAt = c.BytePos()
+}
+
+// followWrapped makes the window follows to cursor c, when lines are wrapped.
+func (w *Window) followWrapped(c *Cursor, margin int) bool {
+	oldMin, oldRow := w.min, w.row
+	t := c.text
+	w.min.O = 0
+	if w.min.L >= t.NumLines() {
+		w.min.L = t.NumLines() - 1
+	}
+	if n := numRows(t, w.min.L, w.size.O); w.row >= n {
+		w.row = n - 1
+	}
+	margin = fitMargin(margin, w.size.L)
+	crow, _ := wrapPos(c.LineData(), wrapLine(c.LineData(), w.size.O, t.tabWidth), c.b, t.tabWidth)
+	d := rowsBetween(t, w.min.L, w.row, c.l, crow, w.size.L, w.size.O)
+	if d < margin {
+		w.min.L, w.row = upRows(t, c.l, crow, margin, w.size.O)
+	} else if d >= w.size.L-margin {
+		w.min.L, w.row = upRows(t, c.l, crow, w.size.L-margin-1, w.size.O)
+	}
+	return w.min != oldMin || w.row != oldRow
+}
+
+// cursorPosWrapped returns the cursor's position from the window's top left, when lines are wrapped.
+func (w *Window) cursorPosWrapped(c *Cursor) cell.Pt {
+	t := c.text
+	crow, col := wrapPos(c.LineData(), wrapLine(c.LineData(), w.size.O, t.tabWidth), c.b, t.tabWidth)
+	return cell.Pt{rowsBetween(t, w.min.L, w.row, c.l, crow, w.size.L, w.size.O), col}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kybin/tor/cell"
+)
+
+func TestWrapLine(t *testing.T) {
+	cases := []struct {
+		line string
+		want []int
+	}{
+		{"", []int{0}},
+		{"abc", []int{0}},
+		{"abcd", []int{0, 4}},
+		{"abcdefghij", []int{0, 4, 8}},
+		// a wide rune that doesn't fit in the rest goes to the next row.
+		{"abc가나", []int{0, 3, 9}},
+		// a tab is tabWidth(2) wide.
+		{"abc\tde", []int{0, 3, 6}},
+		{"\t\t\t\t", []int{0, 2, 4}},
+	}
+	for _, c := range cases {
+		got := wrapLine(c.line, 4, 2)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("wrapLine(%q, 4, 2): got %v, want %v", c.line, got, c.want)
+		}
+	}
+}
+
+func TestWrapPos(t *testing.T) {
+	line := "abc가나d"
+	starts := wrapLine(line, 4, 4) // 0, 3, 9
+	cases := []struct {
+		b        int
+		row, col int
+	}{
+		{0, 0, 0},
+		{2, 0, 2},
+		{3, 1, 0},
+		{6, 1, 2},
+		{9, 2, 0},
+		{10, 2, 1},
+	}
+	for _, c := range cases {
+		row, col := wrapPos(line, starts, c.b, 4)
+		if row != c.row || col != c.col {
+			t.Fatalf("wrapPos(%q, %v, %v): got %v, %v, want %v, %v", line, starts, c.b, row, col, c.row, c.col)
+		}
+	}
+	bcases := []struct {
+		row, col int
+		want     int
+	}{
+		{0, 1, 1},
+		// the start of the next row is not in the row.
+		{0, 3, 2},
+		{1, 1, 3},
+		{1, 3, 6},
+		{1, 4, 6},
+		{2, 5, 10},
+	}
+	for _, c := range bcases {
+		if got := wrapB(line, starts, c.row, c.col, 4); got != c.want {
+			t.Fatalf("wrapB(%q, %v, %v, %v): got %v, want %v", line, starts, c.row, c.col, got, c.want)
+		}
+	}
+}
+
+func TestCursorMoveRow(t *testing.T) {
+	text := NewText([]string{"0123456789", "ab", "abcdef"})
+	c := NewCursor(text)
+	c.wrapWidth = 4
+	c.SetBytePos(cell.Pt{0, 1})
+	want := []cell.Pt{{0, 5}, {0, 9}, {1, 1}, {2, 1}, {2, 5}, {2, 5}}
+	for _, w := range want {
+		c.MoveDown()
+		if got := c.BytePos(); got != w {
+			t.Fatalf("MoveDown: got %v, want %v", got, w)
+		}
+	}
+	c.SetBytePos(cell.Pt{0, 7})
+	// keeps the column through a short row.
+	want = []cell.Pt{{0, 10}, {1, 2}, {2, 3}}
+	for _, w := range want {
+		c.MoveDown()
+		if got := c.BytePos(); got != w {
+			t.Fatalf("MoveDown: got %v, want %v", got, w)
+		}
+	}
+	want = []cell.Pt{{1, 2}, {0, 10}, {0, 7}, {0, 3}, {0, 3}}
+	for _, w := range want {
+		c.MoveUp()
+		if got := c.BytePos(); got != w {
+			t.Fatalf("MoveUp: got %v, want %v", got, w)
+		}
+	}
+}
+
+func TestWindowFollowWrapped(t *testing.T) {
+	lines := make([]string, 0)
+	for i := 0; i < 20; i++ {
+		lines = append(lines, "0123456789")
+	}
+	text := NewText(lines)
+	c := NewCursor(text)
+	c.wrapWidth = 4
+	w := NewWindow(cell.Pt{6, 4})
+	w.SetWrap(true)
+	for i := 0; i < 10; i++ {
+		c.MoveDown()
+	}
+	w.Follow(c, 1)
+	// each line has 3 rows. the cursor is at the 11th row, the second row of line 3.
+	if w.min.L != 2 || w.row != 0 {
+		t.Fatalf("Follow: got top at line %v row %v, want line 2 row 0", w.min.L, w.row)
+	}
+	if got := w.CursorPos(c); got != (cell.Pt{4, 0}) {
+		t.Fatalf("CursorPos: got %v, want {4 0}", got)
+	}
+	c.MoveUp()
+	c.MoveUp()
+	c.MoveUp()
+	c.MoveUp()
+	w.Follow(c, 1)
+	if w.min.L != 1 || w.row != 2 {
+		t.Fatalf("Follow: got top at line %v row %v, want line 1 row 2", w.min.L, w.row)
+	}
+	if got := w.CursorPos(c); got != (cell.Pt{1, 0}) {
+		t.Fatalf("CursorPos: got %v, want {1 0}", got)
+	}
+	c.MoveEof()
+	w.Follow(c, 1)
+	if got := w.CursorPos(c); got != (cell.Pt{4, 2}) {
+		t.Fatalf("CursorPos: got %v at the end, want {4 2}", got)
+	}
+}